@@ -17,31 +17,409 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spacebin-org/spirit/internal/app"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/backup"
+	"github.com/spacebin-org/spirit/internal/pkg/broker"
+	"github.com/spacebin-org/spirit/internal/pkg/client"
 	"github.com/spacebin-org/spirit/internal/pkg/config"
 	"github.com/spacebin-org/spirit/internal/pkg/database"
 	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/importer"
+	"github.com/spacebin-org/spirit/internal/pkg/scheduler"
+	"github.com/spacebin-org/spirit/internal/pkg/tracing"
 )
 
+var jobs *scheduler.Scheduler
+
 func init() {
+	flag.StringVar(&config.Path, "config", config.Path, "path to a TOML, YAML or JSON config file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [serve|backup|restore|import|paste|migrate|config validate] [command flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+// setup loads the config and connects to the database, every command but
+// `paste`, `config` and `migrate` needs them. It refuses to go on if the
+// database schema doesn't match this build.
+func setup() {
 	// Load config
 	if err := config.Load(); err != nil {
 		log.Fatalf("Couldn't load configuration file: %v", err)
 	}
 
-	// Start server and initialize database
+	// Initialize database
 	database.Init()
 
-	// Start expire document cron job
-	document.ExpireDocument().Start()
+	// Tables are brought up to date on every start, even when the stored
+	// version matches, so columns added without a bump aren't missed
+	if config.Config().Database.AutoMigrate {
+		if err := database.Migrate(); err != nil {
+			log.Fatalf("Couldn't migrate database: %v", err)
+		}
+
+		return
+	}
+
+	if err := database.CheckSchema(); err != nil {
+		switch {
+		case errors.Is(err, database.ErrSchemaOutdated):
+			log.Fatalf("Refusing to start: %v, run `%s migrate` first", err, os.Args[0])
+		case errors.Is(err, database.ErrSchemaTooNew):
+			log.Fatalf("Refusing to start: %v, it was migrated by a newer version of spirit", err)
+		default:
+			log.Fatalf("Couldn't read database schema version: %v", err)
+		}
+	}
 }
 
 func main() {
-	app := app.Start()
-	address := fmt.Sprintf("%s:%d", config.Config.Server.Host, config.Config.Server.Port)
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "", "serve":
+		setup()
+		serve()
+	case "backup":
+		setup()
+		runBackup(flag.Args()[1:])
+	case "restore":
+		setup()
+		runRestore(flag.Args()[1:])
+	case "import":
+		setup()
+		runImport(flag.Args()[1:])
+	case "paste":
+		runPaste(flag.Args()[1:])
+	case "config":
+		runConfig(flag.Args()[1:])
+	case "migrate":
+		runMigrate()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// runMigrate brings the database schema up to date
+func runMigrate() {
+	if err := config.Load(); err != nil {
+		log.Fatalf("Couldn't load configuration file: %v", err)
+	}
+
+	database.Init()
+
+	from, err := database.StoredSchemaVersion()
+
+	if err == nil {
+		err = database.Migrate()
+	}
+
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
+	}
+
+	if from == database.SchemaVersion {
+		log.Printf("Database schema is already at version %d", from)
+		return
+	}
+
+	log.Printf("Migrated database schema from version %d to %d", from, database.SchemaVersion)
+}
+
+// runConfig checks the config without starting anything, for CI pipelines
+func runConfig(args []string) {
+	if len(args) != 1 || args[0] != "validate" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := config.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s is valid\n", config.Path)
+}
+
+// runPaste uploads a file, or stdin, to an instance and prints its URL
+func runPaste(args []string) {
+	flags := flag.NewFlagSet("paste", flag.ExitOnError)
+	server := flags.String("server", envOr("SPACEBIN_URL", "https://spaceb.in"), "instance to paste to, or $SPACEBIN_URL")
+	token := flags.String("token", os.Getenv("SPACEBIN_TOKEN"), "auth token, or $SPACEBIN_TOKEN")
+	language := flags.String("language", "none", "highlighter to use, e.g. go or python")
+	expires := flags.Duration("expires", 0, "how long to keep the document for, e.g. 24h")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s paste [flags] [file|-]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var content []byte
+	var err error
+
+	switch path := flags.Arg(0); path {
+	case "", "-":
+		content, err = io.ReadAll(os.Stdin)
+	default:
+		content, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		log.Fatalf("Couldn't read document: %v", err)
+	}
+
+	c := &client.Client{Server: *server, Token: *token}
+	url, err := c.Paste(string(content), *language, *expires)
+
+	if err != nil {
+		log.Fatalf("Couldn't create document: %v", err)
+	}
+
+	fmt.Println(url)
+}
+
+// envOr returns the environment variable `key`, or `fallback` if it's unset
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// runBackup writes every document and its metadata to an archive
+func runBackup(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("out", "spacebin.tar.zst", "archive to write, compressed if it ends in .gz or .zst")
+	flags.Parse(args)
+
+	f, err := os.Create(*out)
+
+	if err != nil {
+		log.Fatalf("Couldn't create backup: %v", err)
+	}
+
+	w, err := backup.Compress(*out, f)
+
+	if err != nil {
+		log.Fatalf("Couldn't create backup: %v", err)
+	}
+
+	manifest, err := backup.Write(context.Background(), w)
+
+	if err == nil {
+		err = w.Close()
+	}
+
+	if err == nil {
+		err = f.Close()
+	}
+
+	if err != nil {
+		os.Remove(*out)
+		log.Fatalf("Couldn't write backup: %v", err)
+	}
+
+	log.Printf("Backed up %d documents to %s", manifest.Counts["documents"], *out)
+}
+
+// runRestore loads an archive written by `backup` into the database
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := flags.String("in", "spacebin.tar.zst", "archive to read, decompressed if it ends in .gz or .zst")
+	flags.Parse(args)
 
-	log.Fatal(app.Listen(address))
+	f, err := os.Open(*in)
+
+	if err != nil {
+		log.Fatalf("Couldn't open backup: %v", err)
+	}
+
+	defer f.Close()
+
+	r, err := backup.Decompress(*in, f)
+
+	if err != nil {
+		log.Fatalf("Couldn't read backup: %v", err)
+	}
+
+	defer r.Close()
+
+	manifest, err := backup.Read(context.Background(), r)
+
+	if err != nil {
+		log.Fatalf("Couldn't restore backup: %v", err)
+	}
+
+	log.Printf("Restored %d documents from %s", manifest.Counts["documents"], *in)
+}
+
+// runImport creates documents from another pastebin's data directory
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := flags.String("hastebin", "", "hastebin file store directory to import")
+	keysPath := flags.String("keys", "", "optional file with one known hastebin key per line, so IDs can be kept")
+	flags.Parse(args)
+
+	if *dir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var keys []string
+
+	if *keysPath != "" {
+		var err error
+
+		if keys, err = importer.ReadKeys(*keysPath); err != nil {
+			log.Fatalf("Couldn't read keys: %v", err)
+		}
+	}
+
+	result, err := importer.Hastebin(context.Background(), *dir, keys)
+
+	if result != nil {
+		// Print where every document went, so old links can be redirected
+		for _, doc := range result.Imported {
+			fmt.Printf("%s	%s	%s\n", doc.File, doc.Key, doc.ID)
+		}
+
+		for _, skipped := range result.Skipped {
+			log.Printf("Skipped %s: %s", skipped.File, skipped.Reason)
+		}
+	}
+
+	if err != nil {
+		log.Fatalf("Couldn't import documents: %v", err)
+	}
+
+	log.Printf("Imported %d documents, skipped %d", len(result.Imported), len(result.Skipped))
+}
+
+func serve() {
+	// Start recurring jobs
+	jobs = scheduler.New()
+
+	if err := jobs.Add("expire_documents", config.Config().Jobs.Expiry, document.ExpireDocuments); err != nil {
+		log.Fatalf("Couldn't schedule jobs: %v", err)
+	}
+
+	if err := jobs.Add("prune_views", config.Config().Jobs.Expiry, document.PruneViews); err != nil {
+		log.Fatalf("Couldn't schedule jobs: %v", err)
+	}
+
+	if err := jobs.Add("purge_trash", config.Config().Jobs.Expiry, document.PurgeTrash); err != nil {
+		log.Fatalf("Couldn't schedule jobs: %v", err)
+	}
+
+	if err := jobs.Add("prune_orphans", config.Config().Jobs.Expiry, document.PruneOrphans); err != nil {
+		log.Fatalf("Couldn't schedule jobs: %v", err)
+	}
+
+	if err := jobs.Add("prune_share_links", config.Config().Jobs.Expiry, document.PruneShareLinks); err != nil {
+		log.Fatalf("Couldn't schedule jobs: %v", err)
+	}
+
+	if err := jobs.Add("prune_idempotency_keys", config.Config().Jobs.Expiry, document.PruneIdempotencyKeys); err != nil {
+		log.Fatalf("Couldn't schedule jobs: %v", err)
+	}
+
+	jobs.Start()
+
+	// Write counted document views in batches
+	document.StartViews()
+
+	// Start exporting traces, if enabled
+	shutdownTracing, err := tracing.Init(context.Background())
+
+	if err != nil {
+		log.Fatalf("Couldn't start tracing: %v", err)
+	}
+
+	// Publish document events to a message broker, if enabled
+	broker.Start()
+
+	server := app.Start()
+
+	// Listen in the background so we're free to wait for a shutdown signal
+	go func() {
+		if err := app.Listen(server); err != nil {
+			log.Fatalf("Couldn't start server: %v", err)
+		}
+	}()
+
+	// Reload safe-to-change settings on SIGHUP
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+
+		for range hup {
+			if err := config.Reload(); err != nil {
+				log.Printf("Couldn't reload configuration: %v", err)
+				audit.System(context.Background(), audit.ConfigReloadFailed, err.Error())
+				continue
+			}
+
+			log.Println("Reloaded configuration")
+			audit.System(context.Background(), audit.ConfigReloaded, "")
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down, draining connections...")
+
+	timeout := time.Duration(config.Config().Server.ShutdownTimeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Stop accepting new connections and wait for in-flight requests
+	drained := make(chan error, 1)
+
+	go func() {
+		drained <- app.Shutdown(server)
+	}()
+
+	select {
+	case err := <-drained:
+		if err != nil {
+			log.Printf("Error when shutting down server: %v", err)
+		}
+	case <-ctx.Done():
+		log.Println("Timed out waiting for connections to drain")
+	}
+
+	// Let running jobs finish before the database goes away
+	select {
+	case <-jobs.Stop().Done():
+	case <-ctx.Done():
+	}
+
+	// Write views and send events that are still queued
+	document.StopViews(ctx)
+	broker.Stop(ctx)
+
+	// Flush any buffered spans
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Error when flushing traces: %v", err)
+	}
+
+	if err := database.Close(); err != nil {
+		log.Printf("Error when closing database: %v", err)
+	}
 }
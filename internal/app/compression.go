@@ -0,0 +1,80 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/valyala/fasthttp"
+)
+
+// compression negotiates gzip, brotli or deflate with the client for
+// responses of at least `server.compression_min_size` bytes whose type
+// starts with one of `server.compression_types`
+func compression() fiber.Handler {
+	server := config.Config().Server
+
+	var brotli, gzip int
+
+	switch server.CompresssionLevel {
+	case compress.LevelBestSpeed:
+		brotli, gzip = fasthttp.CompressBrotliBestSpeed, fasthttp.CompressBestSpeed
+	case compress.LevelDefault:
+		brotli, gzip = fasthttp.CompressBrotliDefaultCompression, fasthttp.CompressDefaultCompression
+	case compress.LevelBestCompression:
+		brotli, gzip = fasthttp.CompressBrotliBestCompression, fasthttp.CompressBestCompression
+	default:
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	compressor := fasthttp.CompressHandlerBrotliLevel(func(*fasthttp.RequestCtx) {}, brotli, gzip)
+
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		res := c.Response()
+
+		// The size of streamed bodies isn't known upfront
+		if !res.IsBodyStream() && len(res.Body()) < server.CompressionMinSize {
+			return nil
+		}
+
+		if compressible(string(res.Header.ContentType()), server.CompressionTypes) {
+			compressor(c.Context())
+		}
+
+		return nil
+	}
+}
+
+// compressible reports whether `contentType` starts with one of `types`
+func compressible(contentType string, types []string) bool {
+	for _, t := range types {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+)
+
+// degraded answers requests that failed because the database couldn't be
+// reached with a 503, and tells clients when to retry if the breaker is
+// open. Requests that got by without it, e.g. from the cache, are left
+// alone.
+func degraded() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := database.Track(c.UserContext())
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		if err == nil || !database.WasUnavailable(ctx) {
+			return err
+		}
+
+		if wait := database.RetryAfter(); wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		}
+
+		return fiber.NewError(fiber.StatusServiceUnavailable, database.ErrUnavailable.Error())
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// securityHeaders sets security-related headers on every response
+func securityHeaders() fiber.Handler {
+	headers := config.Config().Server.Headers
+
+	// Configurable headers, an empty value means the header isn't sent
+	configured := [][2]string{
+		{"X-Frame-Options", headers.FrameOptions},
+		{"X-Content-Type-Options", headers.ContentTypeOptions},
+		{"Referrer-Policy", headers.ReferrerPolicy},
+		{"Strict-Transport-Security", headers.StrictTransportSecurity},
+		{"Content-Security-Policy", headers.ContentSecurityPolicy},
+	}
+
+	return func(c *fiber.Ctx) error {
+		// Set some security headers
+		c.Set("X-Download-Options", "noopen")
+		c.Set("X-DNS-Prefetch-Control", "off")
+		c.Set("X-XSS-Protection", "1; mode=block")
+
+		for _, header := range configured {
+			if header[1] != "" {
+				c.Set(header[0], header[1])
+			}
+		}
+
+		// Go to next middleware
+		return c.Next()
+	}
+}
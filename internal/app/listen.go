@@ -0,0 +1,147 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/netcat"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// redirect serves ACME challenges and redirects to HTTPS while TLS is enabled
+var redirect *http.Server
+
+// tcp accepts documents over plain TCP when it's enabled
+var tcp *netcat.Server
+
+// Listen serves `app` over plain HTTP, or over HTTPS with certificates from
+// Let's Encrypt when TLS is enabled. It blocks until the server is shut down.
+func Listen(app *fiber.App) error {
+	host := config.Config().Server.Host
+
+	if tcp != nil {
+		go func() {
+			if err := tcp.ListenAndServe(fmt.Sprintf("%s:%d", host, config.Config().Server.TCP.Port)); err != nil {
+				log.Fatalf("Couldn't start TCP listener: %v", err)
+			}
+		}()
+	}
+
+	if !config.Config().Server.TLS.Enabled {
+		return app.Listen(fmt.Sprintf("%s:%d", host, config.Config().Server.Port))
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.Config().Server.TLS.Domains...),
+		Cache:      autocert.DirCache(config.Config().Server.TLS.CacheDir),
+		Email:      config.Config().Server.TLS.Email,
+	}
+
+	// Answer ACME challenges and redirect everything else to HTTPS
+	redirect = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", host, config.Config().Server.Port),
+		Handler: manager.HTTPHandler(http.HandlerFunc(redirectToHTTPS)),
+	}
+
+	go func() {
+		if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Couldn't start HTTP redirect server: %v", err)
+		}
+	}()
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, config.Config().Server.TLS.Port))
+
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := manager.TLSConfig()
+
+	if err := clientAuth(tlsConfig); err != nil {
+		ln.Close()
+
+		return err
+	}
+
+	return app.Listener(tls.NewListener(ln, tlsConfig))
+}
+
+// clientAuth lets clients present certificates issued by the CAs in
+// `server.tls.client_auth.ca_file`, endpoints requiring one check it
+func clientAuth(tlsConfig *tls.Config) error {
+	path := config.Config().Server.TLS.ClientAuth.CAFile
+
+	if path == "" {
+		return nil
+	}
+
+	pem, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", path)
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return nil
+}
+
+// redirectToHTTPS sends the client to the same URL on the HTTPS listener
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+
+	if err != nil {
+		host = r.Host
+	}
+
+	if port := config.Config().Server.TLS.Port; port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+func Shutdown(app *fiber.App) error {
+	if redirect != nil {
+		redirect.Close()
+	}
+
+	if tcp != nil {
+		tcp.Close()
+	}
+
+	return app.Shutdown()
+}
@@ -17,44 +17,134 @@
 package app
 
 import (
+	"log"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/spacebin-org/spirit/internal/pkg/accesslog"
+	"github.com/spacebin-org/spirit/internal/pkg/account"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/capabilities"
+	"github.com/spacebin-org/spirit/internal/pkg/challenge"
+	"github.com/spacebin-org/spirit/internal/pkg/collection"
+	"github.com/spacebin-org/spirit/internal/pkg/comment"
 	"github.com/spacebin-org/spirit/internal/pkg/config"
 	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+	"github.com/spacebin-org/spirit/internal/pkg/feed"
+	"github.com/spacebin-org/spirit/internal/pkg/gist"
+	"github.com/spacebin-org/spirit/internal/pkg/health"
+	"github.com/spacebin-org/spirit/internal/pkg/ipfilter"
+	"github.com/spacebin-org/spirit/internal/pkg/maintenance"
+	"github.com/spacebin-org/spirit/internal/pkg/metrics"
+	"github.com/spacebin-org/spirit/internal/pkg/moderation"
+	"github.com/spacebin-org/spirit/internal/pkg/netcat"
+	"github.com/spacebin-org/spirit/internal/pkg/oembed"
+	"github.com/spacebin-org/spirit/internal/pkg/profiling"
+	"github.com/spacebin-org/spirit/internal/pkg/ratelimit"
+	"github.com/spacebin-org/spirit/internal/pkg/robots"
+	"github.com/spacebin-org/spirit/internal/pkg/spam"
+	"github.com/spacebin-org/spirit/internal/pkg/stats"
+	"github.com/spacebin-org/spirit/internal/pkg/timeout"
+	"github.com/spacebin-org/spirit/internal/pkg/tracing"
+	"github.com/spacebin-org/spirit/internal/pkg/uploader"
 )
 
 func registerRouter(app *fiber.App) {
 	// Setup middlewares
-	app.Use(compress.New(compress.Config{
-		Level: config.Config.Server.CompresssionLevel,
+	app.Use(compression())
+
+	if config.Config().Tracing.Enabled {
+		app.Use(tracing.Middleware())
+	}
+
+	if config.Config().Metrics.Enabled {
+		app.Use(metrics.Middleware())
+	}
+
+	// Tag every request with an ID, which is echoed back in `X-Request-ID`
+	// and included in access logs and error responses
+	app.Use(requestid.New(requestid.Config{
+		ContextKey: accesslog.ContextKey,
 	}))
+	app.Use(accesslog.New())
+
+	app.Use(securityHeaders())
 
-	app.Use(limiter.New(limiter.Config{
-		Duration: config.Config.Server.Ratelimits.Duration,
-		Max:      config.Config.Server.Ratelimits.Requests,
+	filter, err := ipfilter.New(
+		config.Config().Server.IPFilter.Allow,
+		config.Config().Server.IPFilter.Deny,
+	)
+
+	if err != nil {
+		log.Fatalf("Invalid IP filter: %v", err)
+	}
+
+	app.Use(filter)
+
+	// Only the JSON API is opened up to other origins
+	app.Use("/v1", cors.New(cors.Config{
+		AllowOrigins:     strings.Join(config.Config().Server.CORS.AllowOrigins, ","),
+		AllowMethods:     strings.Join(config.Config().Server.CORS.AllowMethods, ","),
+		AllowHeaders:     strings.Join(config.Config().Server.CORS.AllowHeaders, ","),
+		ExposeHeaders:    strings.Join(config.Config().Server.CORS.ExposeHeaders, ","),
+		AllowCredentials: config.Config().Server.CORS.AllowCredentials,
+		MaxAge:           config.Config().Server.CORS.MaxAge,
 	}))
 
-	app.Use(cors.New())
-	app.Use(logger.New())
-
-	// Custom middleware to set security-related headers
-	app.Use(func(c *fiber.Ctx) error {
-		// Set some security headers
-		c.Set("X-Download-Options", "noopen")
-		c.Set("X-DNS-Prefetch-Control", "off")
-		c.Set("X-Frame-Options", "SAMEORIGIN")
-		c.Set("X-XSS-Protection", "1; mode=block")
-		c.Set("X-Content-Type-Options", "nosniff")
-		c.Set("Referrer-Policy", "no-referrer-when-downgrade")
-		c.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains; preload")
-		c.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none';")
-
-		// Go to next middleware
-		return c.Next()
-	})
-
-	document.Register(app)
+	app.Use(maintenance.Middleware())
+	app.Use(degraded())
+	app.Use(timeout.Middleware())
+
+	verifier, err := challenge.New()
+
+	if err != nil {
+		log.Fatalf("Couldn't set up challenges: %v", err)
+	}
+
+	filters, err := spam.New()
+
+	if err != nil {
+		log.Fatalf("Invalid spam filter: %v", err)
+	}
+
+	if config.Config().Server.TCP.Enabled {
+		if tcp, err = netcat.New(filters); err != nil {
+			log.Fatalf("Couldn't set up TCP listener: %v", err)
+		}
+	}
+
+	health.Register(app)
+	auth.Register(app)
+	challenge.Register(app, verifier)
+	document.Register(app, verifier, filters)
+	collection.Register(app)
+	comment.Register(app, filters)
+	moderation.Register(app)
+	audit.Register(app)
+	maintenance.Register(app)
+	features.Register(app)
+	ratelimit.Register(app)
+	capabilities.Register(app)
+	stats.Register(app)
+	account.Register(app)
+	gist.Register(app)
+	uploader.Register(app)
+	oembed.Register(app)
+	feed.Register(app)
+	robots.Register(app)
+
+	if config.Config().Metrics.Enabled {
+		metrics.Register(app)
+	}
+
+	if config.Config().Profiling.Enabled {
+		profiling.Register(app)
+	}
+
+	// Matches every path, so it goes last
+	document.RegisterShortLinks(app)
 }
@@ -17,7 +17,10 @@
 package app
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/accesslog"
 	"github.com/spacebin-org/spirit/internal/pkg/config"
 	"github.com/spacebin-org/spirit/internal/pkg/domain"
 )
@@ -25,7 +28,14 @@ import (
 // Start initializes the server
 func Start() *fiber.App {
 	app := fiber.New(fiber.Config{
-		Prefork: config.Config.Server.Prefork,
+		Prefork: config.Config().Server.Prefork,
+		// Oversized bodies are rejected while reading them, before they're
+		// buffered or parsed, and reach the error handler below as a 413
+		BodyLimit: config.Config().Server.BodyLimit,
+		// Slow or idle clients can't hold connections open forever
+		ReadTimeout:  time.Duration(config.Config().Server.Timeouts.Read) * time.Millisecond,
+		WriteTimeout: time.Duration(config.Config().Server.Timeouts.Write) * time.Millisecond,
+		IdleTimeout:  time.Duration(config.Config().Server.Timeouts.Idle) * time.Millisecond,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			// Default 500 status code
 			code := fiber.StatusInternalServerError
@@ -40,9 +50,10 @@ func Start() *fiber.App {
 
 			// Return statuscode with error message
 			return c.Status(code).JSON(&domain.Response{
-				Error:   err.Error(),
-				Payload: domain.Payload{},
-				Status:  code,
+				Error:     err.Error(),
+				Payload:   domain.Payload{},
+				Status:    code,
+				RequestID: accesslog.RequestID(c),
 			})
 		},
 	})
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+)
+
+// ContextKey is the key the request ID is stored under in `c.Locals`
+const ContextKey = "requestid"
+
+// Logger writes one JSON line per request to stdout
+var Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+// RequestID returns the ID assigned to the current request
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(ContextKey).(string)
+
+	return id
+}
+
+// New creates the access log middleware. It must run after the requestid
+// middleware so every line can be correlated with the `X-Request-ID` header.
+func New() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// Errors are turned into responses by the error handler after the
+		// middleware chain has finished, so resolve the status here
+		status := c.Response().StatusCode()
+
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		event := Logger.Info()
+
+		if status >= 500 {
+			event = Logger.Error()
+		}
+
+		if err != nil {
+			event = event.Err(err)
+		}
+
+		event.
+			Str("request_id", RequestID(c)).
+			Str("method", c.Method()).
+			Str("path", c.Path()).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("size", len(c.Response().Body())).
+			Str("ip", clientip.IP(c).String()).
+			Msg("request")
+
+		return err
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package account
+
+import (
+	"context"
+
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+	"gorm.io/gorm"
+)
+
+// Erasure reports what was removed along with an account's data
+type Erasure struct {
+	Account            string `json:"account"`
+	DocumentsDeleted   int64  `json:"documents_deleted"`
+	DocumentsDetached  int64  `json:"documents_detached"` // Kept, but no longer tied to the account.
+	GitHubTokenRemoved bool   `json:"github_token_removed"`
+}
+
+// Erase removes everything stored about `owner`. Their documents are
+// deleted when `documents` is true, otherwise they're kept anonymously, and
+// so are their entries in the audit log.
+func Erase(ctx context.Context, owner string, documents bool) (*Erasure, error) {
+	erasure := Erasure{Account: owner}
+	deleted := []models.Document{}
+	detached := []models.Document{}
+
+	err := database.Transaction(ctx, func(tx *gorm.DB) error {
+		res := tx.Where("owner = ?", owner).Delete(&models.GitHubToken{})
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		erasure.GitHubTokenRemoved = res.RowsAffected > 0
+
+		if err := tx.Where("owner = ?", owner).Delete(&models.Star{}).Error; err != nil {
+			return err
+		}
+
+		collections := tx.Model(&models.Collection{}).Select("id").Where("owner = ?", owner)
+
+		if err := tx.Where("collection_id IN (?)", collections).Delete(&models.CollectionDocument{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("owner = ?", owner).Delete(&models.Collection{}).Error; err != nil {
+			return err
+		}
+
+		// Comments are cleared rather than deleted so replies stay threaded
+		err := tx.Model(&models.Comment{}).Where("author = ?", owner).
+			Updates(map[string]interface{}{"deleted": true, "body": "", "author": "", "author_ip": ""}).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Annotation{}).Where("author = ?", owner).Update("author", "").Error; err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.AuditEvent{}).Where("actor = ?", owner).
+			Updates(map[string]interface{}{"actor": audit.ErasedActor, "ip": ""}).Error
+
+		if err != nil {
+			return err
+		}
+
+		// Links to documents that are kept would still let others in
+		if err := tx.Where("created_by = ?", owner).Delete(&models.ShareLink{}).Error; err != nil {
+			return err
+		}
+
+		err = tx.Where("caller_hash = ?", models.HashCaller("token:"+owner)).Delete(&models.IdempotencyKey{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		if !documents {
+			if err := tx.Omit("content").Where("owner = ?", owner).Find(&detached).Error; err != nil {
+				return err
+			}
+
+			res = tx.Model(&models.Document{}).Where("owner = ?", owner).
+				Updates(map[string]interface{}{"owner": "", "creator_ip": ""})
+			erasure.DocumentsDetached = res.RowsAffected
+
+			return res.Error
+		}
+
+		// Other accounts' comments, stars, share links and collection
+		// entries go with the documents
+		if err := tx.Omit("content").Where("owner = ?", owner).Find(&deleted).Error; err != nil {
+			return err
+		}
+
+		ids := make([]string, len(deleted))
+
+		for i := range deleted {
+			ids[i] = deleted[i].ID
+		}
+
+		erasure.DocumentsDeleted, err = retention.Purge(tx, ids)
+
+		return err
+	})
+
+	if err != nil {
+		return &erasure, err
+	}
+
+	for i := range deleted {
+		events.Publish(ctx, events.Event{Type: events.Purged, Document: &deleted[i], Actor: owner})
+	}
+
+	for i := range detached {
+		detached[i].Owner, detached[i].CreatorIP = "", ""
+		events.Publish(ctx, events.Event{Type: events.Updated, Document: &detached[i], Actor: owner, Detail: "owner"})
+	}
+
+	return &erasure, nil
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package account
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// seed migrates a new sqlite database and stores data of the accounts
+// alice and bob in it
+func seed(t *testing.T) {
+	t.Helper()
+
+	configtest.Load(t, "")
+	database.Init()
+
+	t.Cleanup(func() {
+		database.Close()
+	})
+
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	rows := []interface{}{
+		&models.Document{ID: "alicedoc", Content: "a", Owner: "alice", CreatorIP: "192.0.2.1", CreatedAt: now},
+		&models.Document{ID: "bobsdocs", Content: "b", Owner: "bob", CreatorIP: "192.0.2.2", CreatedAt: now},
+		&models.Star{Owner: "alice", DocumentID: "bobsdocs", CreatedAt: now},
+		&models.Comment{DocumentID: "bobsdocs", Author: "alice", AuthorIP: "192.0.2.1", Body: "hi", CreatedAt: now},
+		&models.ShareLink{DocumentID: "bobsdocs", TokenHash: "by alice", CreatedBy: "alice", CreatedAt: now},
+		&models.ShareLink{DocumentID: "bobsdocs", TokenHash: "by bob", CreatedBy: "bob", CreatedAt: now},
+		&models.AuditEvent{Actor: "alice", Action: audit.DocumentDeleted, IP: "192.0.2.1", CreatedAt: now},
+		&models.AuditEvent{Actor: "bob", Action: audit.DocumentDeleted, IP: "192.0.2.2", CreatedAt: now},
+		&models.IdempotencyKey{KeyHash: "alice", CallerHash: models.HashCaller("token:alice"), DocumentID: "alicedoc"},
+		&models.IdempotencyKey{KeyHash: "bob", CallerHash: models.HashCaller("token:bob"), DocumentID: "bobsdocs"},
+	}
+
+	for _, row := range rows {
+		if err := database.DBConn.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// count returns how many rows of `model` match `query`
+func count(t *testing.T, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+
+	var n int64
+
+	if err := database.DBConn.Model(model).Where(query, args...).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestErase(t *testing.T) {
+	for name, documents := range map[string]bool{"deleting documents": true, "keeping documents": false} {
+		documents := documents
+
+		t.Run(name, func(t *testing.T) {
+			seed(t)
+
+			erasure, err := Erase(context.Background(), "alice", documents)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if documents && (erasure.DocumentsDeleted != 1 || count(t, &models.Document{}, "id = ?", "alicedoc") != 0) {
+				t.Errorf("documents deleted: %+v", erasure)
+			}
+
+			if !documents && (erasure.DocumentsDetached != 1 || count(t, &models.Document{}, "id = ? AND owner = '' AND creator_ip = ''", "alicedoc") != 1) {
+				t.Errorf("documents detached: %+v", erasure)
+			}
+
+			// Nothing identifying alice is left
+			left := []struct {
+				name  string
+				model interface{}
+				query string
+			}{
+				{"stars", &models.Star{}, "owner = 'alice'"},
+				{"comments", &models.Comment{}, "author = 'alice' OR author_ip = '192.0.2.1'"},
+				{"share links", &models.ShareLink{}, "created_by = 'alice'"},
+				{"audit events", &models.AuditEvent{}, "actor = 'alice' OR ip = '192.0.2.1'"},
+				{"idempotency keys", &models.IdempotencyKey{}, "key_hash = 'alice'"},
+			}
+
+			for _, l := range left {
+				if n := count(t, l.model, l.query); n != 0 {
+					t.Errorf("%d %s of alice left", n, l.name)
+				}
+			}
+
+			// bob's are kept
+			kept := []struct {
+				name  string
+				model interface{}
+				query string
+			}{
+				{"documents", &models.Document{}, "owner = 'bob'"},
+				{"share links", &models.ShareLink{}, "created_by = 'bob'"},
+				{"audit events", &models.AuditEvent{}, "actor = 'bob' AND ip = '192.0.2.2'"},
+				{"idempotency keys", &models.IdempotencyKey{}, "key_hash = 'bob'"},
+			}
+
+			for _, k := range kept {
+				if n := count(t, k.model, k.query); n != 1 {
+					t.Errorf("%d %s of bob kept, want 1", n, k.name)
+				}
+			}
+
+			if n := count(t, &models.AuditEvent{}, "actor = ?", audit.ErasedActor); n != 1 {
+				t.Errorf("%d audit events anonymized, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package account
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// ManifestEntry describes one exported document
+type ManifestEntry struct {
+	ID        string `json:"id"`
+	File      string `json:"file"` // Path of the content inside the archive.
+	Extension string `json:"extension"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// Manifest is written to `manifest.json` at the root of an export
+type Manifest struct {
+	Account    string          `json:"account"`
+	ExportedAt int64           `json:"exported_at"`
+	Documents  []ManifestEntry `json:"documents"`
+}
+
+// EraseRequest is the body of DELETE /v1/account
+type EraseRequest struct {
+	Token string `json:"token" form:"token"` // The account's token, unless a fresh JWT is used.
+}
+
+// eraseAuthAge is how many seconds ago a JWT used to erase an account may
+// have been exchanged
+const eraseAuthAge = 5 * 60
+
+// Register loads the account endpoints
+func Register(app *fiber.App) {
+	// Group middleware would also apply to other routes under /v1/account,
+	// so auth is required per route
+	api := app.Group("/v1/account")
+
+	// Streams a zip of every document created with the caller's token
+	api.Get("/export", auth.Require(), func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+		ctx := c.UserContext()
+
+		// Fail early if the database can't be reached, once streaming starts
+		// the status can't be changed anymore
+		var count int64
+		err := database.DBConn.WithContext(ctx).Model(&models.Document{}).
+			Where("owner = ? AND deleted_at = 0", identity.Name).Count(&count).Error
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		c.Set(fiber.HeaderContentType, "application/zip")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(
+			"attachment; filename=\"spacebin-%s-%s.zip\"", identity.Name, time.Now().Format("20060102"),
+		))
+
+		c.Status(200).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			if err := export(w, identity.Name); err != nil {
+				log.Printf("Export for %s failed: %v", identity.Name, err)
+			}
+		})
+
+		return nil
+	})
+
+	// Erases the caller's data. Tokens live in the config, so the token
+	// itself keeps working until an operator removes it.
+	api.Delete("/", auth.Require(), func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+
+		// The account is named again so it isn't erased by accident
+		if c.Query("confirm") != identity.Name {
+			return fiber.NewError(400, "confirm must be set to the account name")
+		}
+
+		b := new(EraseRequest)
+
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(b); err != nil {
+				return fiber.NewError(400, err.Error())
+			}
+		}
+
+		// A leaked access JWT isn't enough to erase the account
+		if !auth.Reauthenticated(c, b.Token, eraseAuthAge) {
+			return fiber.NewError(403, "send the account's token, or use a JWT exchanged in the last 5 minutes")
+		}
+
+		erasure, err := Erase(c.UserContext(), identity.Name, config.Config().Auth.EraseDocuments)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		// Recorded without the account's name or address, which were just
+		// erased from the rest of the audit log
+		audit.Record(c.UserContext(), models.AuditEvent{
+			Actor:  audit.ErasedActor,
+			Action: audit.AccountErased,
+			Detail: fmt.Sprintf("%d documents deleted, %d detached", erasure.DocumentsDeleted, erasure.DocumentsDetached),
+		})
+
+		return c.Status(200).JSON(erasure)
+	})
+}
+
+// export writes every document owned by `owner` and a manifest to `w`
+func export(w *bufio.Writer, owner string) error {
+	zw := zip.NewWriter(w)
+	manifest := Manifest{Account: owner, ExportedAt: time.Now().Unix(), Documents: []ManifestEntry{}}
+
+	rows, err := database.DBConn.Model(&models.Document{}).Where("owner = ? AND deleted_at = 0", owner).Order("created_at").Rows()
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		document := models.Document{}
+
+		if err := database.DBConn.ScanRows(rows, &document); err != nil {
+			return err
+		}
+
+		entry := ManifestEntry{
+			ID:        document.ID,
+			File:      "documents/" + document.ID + ".txt",
+			Extension: document.Extension,
+			CreatedAt: document.CreatedAt,
+			UpdatedAt: document.UpdatedAt,
+			ExpiresAt: document.ExpiresAt,
+		}
+
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     entry.File,
+			Method:   zip.Deflate,
+			Modified: time.Unix(document.CreatedAt, 0),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Write([]byte(document.Content)); err != nil {
+			return err
+		}
+
+		manifest.Documents = append(manifest.Documents, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "manifest.json",
+		Method:   zip.Deflate,
+		Modified: time.Unix(manifest.ExportedAt, 0),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(&manifest); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
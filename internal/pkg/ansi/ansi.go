@@ -0,0 +1,224 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * A small highlighter coloring code with ANSI escape codes for terminals.
+ * It knows the comment syntax and keywords of the most common languages
+ * and colors their strings and numbers, which is enough to make `curl`
+ * output readable without a full lexer for each language.
+
+ * Chroma would know many more languages, but it isn't among Spirit's
+ * dependencies and coloring raw content is off by default, so it doesn't
+ * seem worth adding for now.
+ */
+
+package ansi
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Escape codes of the colors tokens are drawn in
+const (
+	reset   = "\x1b[0m"
+	comment = "\x1b[90m"
+	str     = "\x1b[32m"
+	number  = "\x1b[33m"
+	keyword = "\x1b[35m"
+)
+
+// syntax is what Highlight knows about a language
+type syntax struct {
+	line     []string // starting comments running to the end of the line
+	block    [2]string
+	keywords map[string]bool
+}
+
+// words makes a set of the words in `s`
+func words(s string) map[string]bool {
+	m := map[string]bool{}
+
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+
+	return m
+}
+
+var (
+	cLike  = syntax{line: []string{"//"}, block: [2]string{"/*", "*/"}}
+	hashes = syntax{line: []string{"#"}}
+)
+
+// syntaxes are keyed by the highlighter names of document extensions
+var syntaxes = map[string]syntax{
+	"go":         {cLike.line, cLike.block, words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false")},
+	"javascript": {cLike.line, cLike.block, words("async await break case catch class const continue default delete do else export extends finally for function if import in instanceof let new of return static super switch this throw try typeof var void while yield null undefined true false")},
+	"typescript": {cLike.line, cLike.block, words("abstract any as async await boolean break case catch class const continue declare default do else enum export extends finally for from function if implements import in interface keyof let namespace new number private protected public readonly return string switch this throw try type typeof var void while null undefined true false")},
+	"rust":       {cLike.line, cLike.block, words("as async await break const continue crate dyn else enum extern fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait type unsafe use where while true false")},
+	"c":          {cLike.line, cLike.block, words("auto break case char const continue default do double else enum extern float for goto if int long register return short signed sizeof static struct switch typedef union unsigned void volatile while NULL")},
+	"cpp":        {cLike.line, cLike.block, words("auto bool break case catch char class const constexpr continue default delete do double else enum explicit extern false float for friend if inline int long namespace new nullptr operator private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void volatile while")},
+	"java":       {cLike.line, cLike.block, words("abstract boolean break byte case catch char class continue default do double else enum extends final finally float for if implements import instanceof int interface long new package private protected public return short static super switch synchronized this throw throws try void volatile while null true false")},
+	"kotlin":     {cLike.line, cLike.block, words("as break class continue do else false for fun if in interface is null object package return super this throw true try typealias val var when while")},
+	"csharp":     {cLike.line, cLike.block, words("abstract as base bool break case catch class const continue default do double else enum false finally for foreach if in int interface internal is namespace new null object override private protected public return static string struct switch this throw true try using var virtual void while")},
+	"php":        {append(cLike.line, "#"), cLike.block, words("abstract array as break case catch class const continue default do echo else elseif extends final for foreach function if implements interface namespace new private protected public return static switch throw try use var while null true false")},
+	"css":        {nil, cLike.block, nil},
+	"python":     {hashes.line, [2]string{}, words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False")},
+	"ruby":       {hashes.line, [2]string{}, words("begin break case class def do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield")},
+	"bash":       {hashes.line, [2]string{}, words("case do done elif else esac fi for function if in local return select then until while export")},
+	"perl":       {hashes.line, [2]string{}, words("else elsif for foreach if last local my next our package return sub unless until use while")},
+	"yaml":       {hashes.line, [2]string{}, words("true false null yes no")},
+	"toml":       {hashes.line, [2]string{}, words("true false")},
+	"sql":        {[]string{"--"}, cLike.block, words("SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT INNER OUTER ON AND OR NOT NULL AS ORDER BY GROUP HAVING LIMIT OFFSET PRIMARY KEY select from where insert into values update set delete create table drop alter index join left right inner outer on and or not null as order by group having limit offset primary key")},
+	"haskell":    {[]string{"--"}, [2]string{"{-", "-}"}, words("case class data deriving do else if import in instance let module newtype of then type where")},
+}
+
+func init() {
+	syntaxes["jsx"] = syntaxes["javascript"]
+	syntaxes["tsx"] = syntaxes["typescript"]
+	syntaxes["scala"] = syntaxes["kotlin"]
+	syntaxes["objc"] = syntaxes["c"]
+	syntaxes["shell-session"] = syntaxes["bash"]
+	syntaxes["powershell"] = hashes
+	syntaxes["crystal"] = syntaxes["ruby"]
+	syntaxes["julia"] = hashes
+}
+
+// Highlight returns `content` colored for a terminal, as code written in
+// `language`, a highlighter name like the extension of documents. Content
+// in languages it doesn't know is returned as it is.
+func Highlight(content, language string) string {
+	s, ok := syntaxes[language]
+
+	if !ok {
+		return content
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(content); {
+		rest := content[i:]
+		n, color := token(rest, s)
+
+		if color == "" {
+			b.WriteString(rest[:n])
+		} else {
+			paint(&b, rest[:n], color)
+		}
+
+		i += n
+	}
+
+	return b.String()
+}
+
+// token returns the length and color of the token `s` starts with
+func token(s string, syn syntax) (int, string) {
+	for _, start := range syn.line {
+		if strings.HasPrefix(s, start) {
+			if end := strings.IndexByte(s, '\n'); end >= 0 {
+				return end, comment
+			}
+
+			return len(s), comment
+		}
+	}
+
+	if syn.block[0] != "" && strings.HasPrefix(s, syn.block[0]) {
+		if end := strings.Index(s[len(syn.block[0]):], syn.block[1]); end >= 0 {
+			return len(syn.block[0]) + end + len(syn.block[1]), comment
+		}
+
+		return len(s), comment
+	}
+
+	switch c := s[0]; {
+	case c == '"' || c == '\'' || c == '`':
+		return quoted(s), str
+	case c >= '0' && c <= '9':
+		n := strings.IndexFunc(s, func(r rune) bool {
+			return !unicode.IsDigit(r) && !unicode.IsLetter(r) && r != '.' && r != '_'
+		})
+
+		if n < 0 {
+			n = len(s)
+		}
+
+		return n, number
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		n := strings.IndexFunc(s, func(r rune) bool {
+			return !unicode.IsDigit(r) && !unicode.IsLetter(r) && r != '_'
+		})
+
+		if n < 0 {
+			n = len(s)
+		}
+
+		if syn.keywords[s[:n]] {
+			return n, keyword
+		}
+
+		return n, ""
+	}
+
+	// Anything else is passed through a character at a time, keeping
+	// multibyte characters whole
+	for n := 1; n < len(s); n++ {
+		if s[n]&0xc0 != 0x80 {
+			return n, ""
+		}
+	}
+
+	return len(s), ""
+}
+
+// quoted returns the length of the string literal `s` starts with. Only
+// backticks may span lines, the others end with the line when unclosed.
+func quoted(s string) int {
+	quote := s[0]
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case '\n':
+			if quote != '`' {
+				return i
+			}
+		case quote:
+			return i + 1
+		}
+	}
+
+	return len(s)
+}
+
+// paint writes `s` in `color`, resetting it at the end of every line so
+// pagers and partial output don't bleed colors
+func paint(b *strings.Builder, s, color string) {
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		if line != "" {
+			b.WriteString(color + line + reset)
+		}
+	}
+}
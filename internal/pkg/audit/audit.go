@@ -0,0 +1,126 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"context"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// Actions that are audited
+const (
+	ConfigReloaded       = "config.reload"
+	ConfigReloadFailed   = "config.reload_failed"
+	ReportResolved       = "report.resolve"
+	BanRemoved           = "ban.remove"
+	CommentHidden        = "comment.hide"
+	CommentUnhidden      = "comment.unhide"
+	AccountErased        = "account.erase"
+	GitHubLinked         = "github.link"
+	GitHubUnlinked       = "github.unlink"
+	DocumentExportedGist = "document.export_gist"
+	DocumentDeleted      = "document.delete"
+	DocumentRestored     = "document.restore"
+	MaintenanceEnabled   = "maintenance.enable"
+	MaintenanceDisabled  = "maintenance.disable"
+	FeatureOverridden    = "feature.override"
+	FeatureReset         = "feature.reset"
+	RateLimitOverridden  = "ratelimit.override"
+	RateLimitReset       = "ratelimit.reset"
+)
+
+// SystemActor is the actor of events that weren't caused by a request
+const SystemActor = "system"
+
+// ErasedActor replaces the actor of events by accounts that were erased
+const ErasedActor = "erased"
+
+// Filter narrows down which events Query returns
+type Filter struct {
+	Actor  string
+	Action string
+	Since  int64 // Unix timestamp, inclusive.
+	Until  int64 // Unix timestamp, exclusive, 0 for no end.
+	Limit  int
+}
+
+// Record stores `event`. Failures are logged rather than returned, so the
+// action being audited isn't undone by them.
+func Record(ctx context.Context, event models.AuditEvent) {
+	if err := database.DBConn.WithContext(ctx).Create(&event).Error; err != nil {
+		log.Printf("Couldn't record audit event %s by %s: %v", event.Action, event.Actor, err)
+	}
+}
+
+// System records `action` by the server itself
+func System(ctx context.Context, action, detail string) {
+	Record(ctx, models.AuditEvent{Actor: SystemActor, Action: action, Detail: detail})
+}
+
+// FromRequest records `action` on `target` by whoever made the request
+func FromRequest(c *fiber.Ctx, action, target, detail string) {
+	actor := "anonymous"
+
+	if identity := auth.FromRequest(c); identity != nil {
+		actor = identity.Name
+	}
+
+	FromRequestAs(c, actor, action, target, detail)
+}
+
+// FromRequestAs is FromRequest for requests where the actor isn't known
+// from the auth token
+func FromRequestAs(c *fiber.Ctx, actor, action, target, detail string) {
+	event := models.AuditEvent{
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Detail: detail,
+	}
+
+	if ip := clientip.IP(c); ip != nil {
+		event.IP = ip.String()
+	}
+
+	Record(c.UserContext(), event)
+}
+
+// Query returns the events matching `filter`, newest first
+func Query(ctx context.Context, filter Filter) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+	query := database.DBConn.WithContext(ctx).Where("created_at >= ?", filter.Since)
+
+	if filter.Until != 0 {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	return events, query.Order("id DESC").Limit(filter.Limit).Find(&events).Error
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+)
+
+// Register loads the endpoint administrators query the audit log with
+func Register(app *fiber.App) {
+	app.Get("/v1/admin/audit", auth.RequireAdmin(), func(c *fiber.Ctx) error {
+		filter := Filter{Actor: c.Query("actor"), Action: c.Query("action")}
+		var err error
+
+		if filter.Since, err = strconv.ParseInt(c.Query("since", "0"), 10, 64); err != nil {
+			return fiber.NewError(400, "since must be a unix timestamp")
+		}
+
+		if filter.Until, err = strconv.ParseInt(c.Query("until", "0"), 10, 64); err != nil {
+			return fiber.NewError(400, "until must be a unix timestamp")
+		}
+
+		if filter.Limit, err = strconv.Atoi(c.Query("limit", "100")); err != nil || filter.Limit < 1 || filter.Limit > 1000 {
+			return fiber.NewError(400, "limit must be between 1 and 1000")
+		}
+
+		events, err := Query(c.UserContext(), filter)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{"events": events})
+	})
+}
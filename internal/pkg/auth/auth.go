@@ -0,0 +1,191 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Roles a token can have
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles within an organization
+const (
+	OrgMember     = "member"
+	OrgMaintainer = "maintainer"
+)
+
+// Identity is who a request was authenticated as
+type Identity struct {
+	Name      string
+	Role      string
+	RateLimit string // Overrides `server.ratelimits.authenticated` when set.
+}
+
+// IsAdmin reports whether the identity may use administrative endpoints
+func (i *Identity) IsAdmin() bool {
+	return i != nil && i.Role == RoleAdmin
+}
+
+// OrgRole returns the role of the identity in organization `org`, or "" if
+// it isn't a member
+func (i *Identity) OrgRole(org string) string {
+	if i == nil {
+		return ""
+	}
+
+	return OrgRole(org, i.Name)
+}
+
+// OrgRole returns the role of the token named `name` in organization
+// `org`, or "" if it isn't a member
+func OrgRole(org, name string) string {
+	for _, o := range config.Config().Auth.Organizations {
+		if o.Name != org {
+			continue
+		}
+
+		for _, maintainer := range o.Maintainers {
+			if maintainer == name {
+				return OrgMaintainer
+			}
+		}
+
+		for _, member := range o.Members {
+			if member == name {
+				return OrgMember
+			}
+		}
+	}
+
+	return ""
+}
+
+// Bearer extracts the token from an `Authorization: Bearer <token>` header
+func Bearer(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// FromRequest returns the identity of the token sent with the request, or
+// nil for anonymous requests and unknown or rejected tokens
+func FromRequest(c *fiber.Ctx) *Identity {
+	if identity, ok := c.Locals(identityKey).(*Identity); ok {
+		return identity
+	}
+
+	identity := Authenticate(c, Bearer(c))
+	c.Locals(identityKey, identity)
+
+	return identity
+}
+
+// FromToken returns the identity `token`, or the access JWT, belongs to,
+// or nil if it's unknown. Hooks aren't run, see Authenticate.
+func FromToken(token string) *Identity {
+	if token == "" {
+		return nil
+	}
+
+	if isJWT(token) {
+		identity, _ := fromJWT(token, useAccess)
+
+		return identity
+	}
+
+	for _, t := range config.Config().Auth.Tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return &Identity{Name: t.Name, Role: t.Role, RateLimit: t.RateLimit}
+		}
+	}
+
+	return nil
+}
+
+// Require rejects requests that weren't made with a known token
+func Require() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if FromRequest(c) == nil {
+			return fiber.NewError(fiber.StatusUnauthorized)
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireAdmin rejects requests that weren't made with an admin token, or
+// without a client certificate if `server.tls.client_auth.admin` is set
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := RequireClientCert(c, config.Config().Server.TLS.ClientAuth.Admin); err != nil {
+			return err
+		}
+
+		identity := FromRequest(c)
+
+		if identity == nil {
+			return fiber.NewError(fiber.StatusUnauthorized)
+		}
+
+		if !identity.IsAdmin() {
+			return fiber.NewError(fiber.StatusForbidden)
+		}
+
+		return c.Next()
+	}
+}
+
+// Reauthenticated reports whether the caller proved they hold their
+// credentials within the last `within` seconds, for actions a leaked
+// access JWT shouldn't be enough for: either `token` is the caller's token
+// itself, or the request was made with a JWT exchanged for it since then
+func Reauthenticated(c *fiber.Ctx, token string, within int64) bool {
+	identity := FromRequest(c)
+
+	if identity == nil {
+		return false
+	}
+
+	if token != "" && !isJWT(token) {
+		owner := FromToken(token)
+
+		return owner != nil && owner.Name == identity.Name
+	}
+
+	bearer := Bearer(c)
+
+	if !isJWT(bearer) {
+		return false
+	}
+
+	_, grant := fromJWT(bearer, useAccess)
+
+	return grant.Subject == identity.Name && grant.AuthTime >= time.Now().Unix()-within
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// identityKey is the key the identity of a request is stored under in
+// `c.Locals`, so hooks run once per request
+const identityKey = "identity"
+
+// Hook is run whenever a request's token is recognized. Returning an error
+// rejects the token, the request is then handled as an anonymous one.
+type Hook func(c *fiber.Ctx, identity *Identity) error
+
+var hooks []Hook
+
+// OnAuth registers `hook` to run on authenticated requests, in the order
+// hooks were registered. Plugins must register their hooks before the
+// server starts.
+func OnAuth(hook Hook) {
+	hooks = append(hooks, hook)
+}
+
+// Authenticate returns the identity `token` belongs to if every hook
+// accepts it, nil otherwise. Admin tokens only act as admins with a client
+// certificate when `server.tls.client_auth.admin` is set, everywhere else
+// they're handled like user tokens.
+func Authenticate(c *fiber.Ctx, token string) *Identity {
+	identity := FromToken(token)
+
+	if identity == nil {
+		return nil
+	}
+
+	if identity.IsAdmin() && RequireClientCert(c, config.Config().Server.TLS.ClientAuth.Admin) != nil {
+		identity.Role = RoleUser
+	}
+
+	for _, hook := range hooks {
+		if err := hook(c, identity); err != nil {
+			return nil
+		}
+	}
+
+	return identity
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// What a JWT can be used for, its "use" claim
+const (
+	useAccess  = "access"
+	useRefresh = "refresh"
+)
+
+// jwtHeader is the only header JWTs are issued and accepted with, so the
+// algorithm can't be swapped
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// claims are the payload of a JWT
+type claims struct {
+	Subject     string `json:"sub"` // Name of the token it was issued for.
+	Fingerprint string `json:"fpr"` // Of that token, see fingerprint.
+	Use         string `json:"use"`
+	AuthTime    int64  `json:"auth_time"` // When the token was exchanged, kept through refreshes.
+	IssuedAt    int64  `json:"iat"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+// jwtEnabled reports whether `auth.jwt.key` is set
+func jwtEnabled() bool {
+	return config.Config().Auth.JWT.Key != ""
+}
+
+// isJWT reports whether `token` looks like a JWT rather than one of the
+// `auth.tokens`. Only the header JWTs are issued with is recognized, so
+// tokens that merely contain dots still work.
+func isJWT(token string) bool {
+	return strings.HasPrefix(token, jwtHeader+".")
+}
+
+// fingerprint identifies `token` without giving it away, so JWTs stop
+// working once the token they were issued for is changed
+func fingerprint(token string) string {
+	sum := sha256.Sum256([]byte("spirit jwt:" + token))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// grantFor returns the claims a session for the token named `name` starts
+// with, or false if there's no such token
+func grantFor(name string) (claims, bool) {
+	for _, t := range config.Config().Auth.Tokens {
+		if t.Name == name && t.Token != "" {
+			return claims{Subject: name, Fingerprint: fingerprint(t.Token), AuthTime: time.Now().Unix()}, true
+		}
+	}
+
+	return claims{}, false
+}
+
+// issue returns a JWT for the session `c` that can be used for `use`
+// during `ttl` seconds, or until the session reaches
+// `auth.jwt.max_session`, and when it expires
+func issue(c claims, use string, ttl int64) (string, int64, error) {
+	now := time.Now().Unix()
+
+	c.Use = use
+	c.IssuedAt = now
+	c.ExpiresAt = now + ttl
+
+	if end := c.AuthTime + config.Config().Auth.JWT.MaxSession; c.ExpiresAt > end {
+		c.ExpiresAt = end
+	}
+
+	payload, err := json.Marshal(&c)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return unsigned + "." + sign(unsigned), c.ExpiresAt, nil
+}
+
+// sign returns the signature of the header and payload in `unsigned`, made
+// with `auth.jwt.key`
+func sign(unsigned string) string {
+	return signWith(config.Config().Auth.JWT.Key, unsigned)
+}
+
+func signWith(key, unsigned string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(unsigned))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// fromJWT returns the identity a valid JWT for `use` was issued for, and
+// its claims. Its role is read from the config, so JWTs of removed or
+// changed tokens stop working.
+func fromJWT(token, use string) (*Identity, claims) {
+	parts := strings.Split(token, ".")
+
+	if !jwtEnabled() || len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, claims{}
+	}
+
+	if !verify(parts[0]+"."+parts[1], parts[2]) {
+		return nil, claims{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, claims{}
+	}
+
+	c := claims{}
+
+	if err := json.Unmarshal(payload, &c); err != nil || c.Use != use || c.ExpiresAt <= time.Now().Unix() {
+		return nil, claims{}
+	}
+
+	current, ok := grantFor(c.Subject)
+
+	if !ok || !hmac.Equal([]byte(c.Fingerprint), []byte(current.Fingerprint)) {
+		return nil, claims{}
+	}
+
+	return named(c.Subject), c
+}
+
+// verify reports whether `sig` is the signature of `unsigned`. After
+// `auth.jwt.key` is rotated the previous key is accepted until every JWT it
+// signed has expired.
+func verify(unsigned, sig string) bool {
+	if hmac.Equal([]byte(sig), []byte(sign(unsigned))) {
+		return true
+	}
+
+	old, ok := config.Retired("auth.jwt.key")
+	window := time.Duration(config.Config().Auth.JWT.RefreshTTL) * time.Second
+
+	return ok && time.Since(old.RetiredAt) < window && hmac.Equal([]byte(sig), []byte(signWith(old.Key, unsigned)))
+}
+
+// named returns the identity of the token named `name`, or nil if there's
+// none
+func named(name string) *Identity {
+	for _, t := range config.Config().Auth.Tokens {
+		if t.Name == name {
+			return &Identity{Name: t.Name, Role: t.Role, RateLimit: t.RateLimit}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+)
+
+const jwtConfig = `
+[[auth.tokens]]
+name = "alice"
+token = "alice-token"
+role = "user"
+
+[auth.jwt]
+key = "%s"
+ttl = 900
+refresh_ttl = 3600
+max_session = 7200
+`
+
+const (
+	jwtKey     = "0123456789abcdef0123456789abcdef"
+	rotatedKey = "fedcba9876543210fedcba9876543210"
+)
+
+func jwtConfigWith(key string) string {
+	return strings.Replace(jwtConfig, "%s", key, 1)
+}
+
+func TestIsJWT(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"jwt", jwtHeader + ".payload.sig", true},
+		{"plain token", "change-me", false},
+		{"token with dots", "a.b.c", false},
+		{"header only", jwtHeader, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isJWT(tt.token); got != tt.want {
+				t.Errorf("isJWT(%q) = %v, want %v", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromJWT(t *testing.T) {
+	configtest.Load(t, jwtConfigWith(jwtKey))
+
+	grant, ok := grantFor("alice")
+
+	if !ok {
+		t.Fatal("no grant for alice")
+	}
+
+	issued := func(c claims, use string, ttl int64) string {
+		token, _, err := issue(c, use, ttl)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	access := issued(grant, useAccess, 900)
+	parts := strings.Split(access, ".")
+
+	stranger := grant
+	stranger.Subject = "mallory"
+
+	stale := grant
+	stale.Fingerprint = fingerprint("old-token")
+
+	tests := []struct {
+		name  string
+		token string
+		use   string
+		want  string // Name of the identity, empty if the token is refused.
+	}{
+		{"access token", access, useAccess, "alice"},
+		{"refresh token", issued(grant, useRefresh, 3600), useRefresh, "alice"},
+		{"wrong use", access, useRefresh, ""},
+		{"expired", issued(grant, useAccess, -1), useAccess, ""},
+		{"tampered payload", parts[0] + "." + parts[1] + "e30." + parts[2], useAccess, ""},
+		{"other key", parts[0] + "." + parts[1] + "." + signWith(rotatedKey, parts[0]+"."+parts[1]), useAccess, ""},
+		{"unknown token", issued(stranger, useAccess, 900), useAccess, ""},
+		{"token changed since", issued(stale, useAccess, 900), useAccess, ""},
+		{"not a jwt", "a.b.c", useAccess, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, _ := fromJWT(tt.token, tt.use)
+			got := ""
+
+			if identity != nil {
+				got = identity.Name
+			}
+
+			if got != tt.want {
+				t.Errorf("fromJWT() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssueCapsSession(t *testing.T) {
+	configtest.Load(t, jwtConfigWith(jwtKey))
+
+	grant, _ := grantFor("alice")
+	grant.AuthTime = time.Now().Unix() - 7000
+
+	_, exp, err := issue(grant, useRefresh, 3600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := grant.AuthTime + 7200; exp != want {
+		t.Errorf("expires at %d, want the end of the session at %d", exp, want)
+	}
+}
+
+func TestVerifyAfterRotation(t *testing.T) {
+	configtest.Load(t, jwtConfigWith(jwtKey))
+
+	grant, _ := grantFor("alice")
+	before, _, err := issue(grant, useAccess, 900)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configtest.Reload(t, jwtConfigWith(rotatedKey))
+
+	after, _, err := issue(grant, useAccess, 900)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{"signed before": before, "signed after": after} {
+		if identity, _ := fromJWT(token, useAccess); identity == nil {
+			t.Errorf("%s the rotation: refused", name)
+		}
+	}
+}
+
+func TestReauthenticated(t *testing.T) {
+	configtest.Load(t, jwtConfigWith(jwtKey)+`
+[[auth.tokens]]
+name = "bob"
+token = "bob-token"
+role = "user"
+`)
+
+	issued := func(authAge int64) string {
+		grant, _ := grantFor("alice")
+		grant.AuthTime -= authAge
+
+		token, _, err := issue(grant, useAccess, 900)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		bearer string
+		token  string // Sent along with the request.
+		want   bool
+	}{
+		{"token itself", "alice-token", "alice-token", true},
+		{"token with a jwt", issued(3600), "alice-token", true},
+		{"fresh jwt", issued(60), "", true},
+		{"old jwt", issued(3600), "", false},
+		{"bearer token only", "alice-token", "", false},
+		{"other account's token", "alice-token", "bob-token", false},
+		{"wrong token", "alice-token", "guess", false},
+		{"jwt as the token", issued(3600), issued(60), false},
+		{"anonymous", "", "alice-token", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := false
+
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				got = Reauthenticated(c, tt.token, 300)
+				return nil
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+
+			if tt.bearer != "" {
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.bearer)
+			}
+
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Reauthenticated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import "github.com/gofiber/fiber/v2"
+
+// VerifiedClient reports whether the client presented a certificate issued
+// by one of the CAs in `server.tls.client_auth.ca_file`. The certificate
+// itself was verified during the TLS handshake.
+func VerifiedClient(c *fiber.Ctx) bool {
+	state := c.Context().TLSConnectionState()
+
+	return state != nil && len(state.VerifiedChains) > 0
+}
+
+// RequireClientCert rejects requests without a verified client certificate
+// when `required` is set
+func RequireClientCert(c *fiber.Ctx, required bool) error {
+	if required && !VerifiedClient(c) {
+		return fiber.NewError(fiber.StatusForbidden, "a client certificate is required")
+	}
+
+	return nil
+}
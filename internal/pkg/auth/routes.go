@@ -0,0 +1,113 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// RefreshRequest is the body of POST /v1/auth/refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+// Session is a pair of JWTs, the access token is sent like any other token
+type Session struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds until the access token expires
+}
+
+// Register loads the endpoints issuing JWTs, when `auth.jwt.key` is set
+func Register(app *fiber.App) {
+	if !jwtEnabled() {
+		return
+	}
+
+	api := app.Group("/v1/auth")
+
+	// JWTs can't be exchanged for new ones, or they'd never expire
+	api.Post("/token", func(c *fiber.Ctx) error {
+		if isJWT(Bearer(c)) {
+			return fiber.NewError(400, "only auth tokens can be exchanged, use /v1/auth/refresh to renew JWTs")
+		}
+
+		identity := FromRequest(c)
+
+		if identity == nil {
+			return fiber.NewError(fiber.StatusUnauthorized)
+		}
+
+		// Identities can come from elsewhere, like client certificates
+		grant, ok := grantFor(identity.Name)
+
+		if !ok || Bearer(c) == "" {
+			return fiber.NewError(400, "only auth tokens can be exchanged")
+		}
+
+		return session(c, grant)
+	})
+
+	api.Post("/refresh", func(c *fiber.Ctx) error {
+		b := new(RefreshRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		identity, grant := fromJWT(b.RefreshToken, useRefresh)
+
+		if identity == nil {
+			return fiber.NewError(401, "invalid or expired refresh token")
+		}
+
+		for _, hook := range hooks {
+			if err := hook(c, identity); err != nil {
+				return fiber.NewError(fiber.StatusUnauthorized)
+			}
+		}
+
+		return session(c, grant)
+	})
+}
+
+// session responds with a new pair of JWTs for the session `grant`
+func session(c *fiber.Ctx, grant claims) error {
+	options := config.Config().Auth.JWT
+	access, expiresAt, err := issue(grant, useAccess, options.TTL)
+
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	refresh, _, err := issue(grant, useRefresh, options.RefreshTTL)
+
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	return c.Status(200).JSON(&Session{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresAt - time.Now().Unix(),
+	})
+}
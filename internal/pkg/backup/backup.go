@@ -0,0 +1,448 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * Backups are tar archives which don't depend on the database they were
+ * taken from, so they can also be used to move an instance to another
+ * dialect. An archive contains:
+
+ *  - manifest.json: the format version and when the backup was taken
+ *  - one JSON lines file per table, e.g. documents.jsonl, with an object
+ *    per row keyed by column names
+
+ * Archives ending in .gz or .zst are compressed accordingly.
+ */
+
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Version of the archive format, bumped on incompatible changes. Rows of
+// version 1 archives were keyed by the JSON names of model fields, which
+// left out the ones never served.
+const Version = 2
+
+// Manifest describes an archive
+type Manifest struct {
+	Version   int            `json:"version"`
+	CreatedAt int64          `json:"created_at"`
+	Counts    map[string]int `json:"counts"` // Number of rows per table.
+}
+
+// table is a table included in backups
+type table struct {
+	name string
+	new  func() interface{}
+}
+
+// tables are written in this order, and restored in the same order. Job
+// locks, idempotency keys and the schema version are left out, they only
+// matter to the database they're in.
+var tables = []table{
+	{"documents", func() interface{} { return &models.Document{} }},
+	{"reports", func() interface{} { return &models.Report{} }},
+	{"bans", func() interface{} { return &models.Ban{} }},
+	{"document_tags", func() interface{} { return &models.DocumentTag{} }},
+	{"stars", func() interface{} { return &models.Star{} }},
+	{"collections", func() interface{} { return &models.Collection{} }},
+	{"collection_documents", func() interface{} { return &models.CollectionDocument{} }},
+	{"comments", func() interface{} { return &models.Comment{} }},
+	{"annotations", func() interface{} { return &models.Annotation{} }},
+	{"share_links", func() interface{} { return &models.ShareLink{} }},
+	{"document_views", func() interface{} { return &models.DocumentView{} }},
+	{"audit_events", func() interface{} { return &models.AuditEvent{} }},
+	{"git_hub_tokens", func() interface{} { return &models.GitHubToken{} }},
+	{"feature_flags", func() interface{} { return &models.FeatureFlag{} }},
+	{"rate_limits", func() interface{} { return &models.RateLimit{} }},
+}
+
+// columns returns the fields of `t` stored in the database
+func columns(tx *gorm.DB, t table) ([]*schema.Field, error) {
+	stmt := &gorm.Statement{DB: tx}
+
+	if err := stmt.Parse(t.new()); err != nil {
+		return nil, err
+	}
+
+	fields := make([]*schema.Field, 0, len(stmt.Schema.Fields))
+
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+// Compress wraps `w` with the compression picked from the extension of `path`
+func Compress(path string, w io.Writer) (io.WriteCloser, error) {
+	switch compression(path) {
+	case "gz":
+		return gzip.NewWriter(w), nil
+	case "zst":
+		return zstd.NewWriter(w)
+	}
+
+	return nopCloser{w}, nil
+}
+
+// Decompress wraps `r` with the decompression picked from the extension of
+// `path`
+func Decompress(path string, r io.Reader) (io.ReadCloser, error) {
+	switch compression(path) {
+	case "gz":
+		return gzip.NewReader(r)
+	case "zst":
+		d, err := zstd.NewReader(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	}
+
+	return io.NopCloser(r), nil
+}
+
+func compression(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".tgz":
+		return "gz"
+	case ".zst", ".tzst":
+		return "zst"
+	}
+
+	return ""
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Write archives every table to `w`
+func Write(ctx context.Context, w io.Writer) (*Manifest, error) {
+	manifest := &Manifest{Version: Version, CreatedAt: time.Now().Unix(), Counts: map[string]int{}}
+
+	// Tables are spooled to temporary files first, tar needs to know the
+	// size of an entry before writing it and the manifest goes first
+	spools := make([]*os.File, 0, len(tables))
+
+	defer func() {
+		for _, f := range spools {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	err := database.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, t := range tables {
+			f, err := os.CreateTemp("", "spirit-backup-*.jsonl")
+
+			if err != nil {
+				return err
+			}
+
+			spools = append(spools, f)
+
+			if manifest.Counts[t.name], err = dumpTable(tx, t, f); err != nil {
+				return fmt.Errorf("error when backing up %s: %w", t.name, err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	tw := tar.NewWriter(w)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeEntry(tw, "manifest.json", int64(len(data)), bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	for i, t := range tables {
+		size, err := spools[i].Seek(0, io.SeekCurrent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := spools[i].Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		if err := writeEntry(tw, t.name+".jsonl", size, spools[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, tw.Close()
+}
+
+// dumpTable writes every row of `t` to `w` as JSON lines
+func dumpTable(tx *gorm.DB, t table, w io.Writer) (int, error) {
+	fields, err := columns(tx, t)
+
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Model(t.new()).Rows()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	count := 0
+
+	for rows.Next() {
+		row := t.new()
+
+		if err := tx.ScanRows(rows, row); err != nil {
+			return count, err
+		}
+
+		values := make(map[string]interface{}, len(fields))
+
+		for _, field := range fields {
+			values[field.DBName], _ = field.ValueOf(reflect.ValueOf(row))
+		}
+
+		if err := enc.Encode(values); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+
+	return err
+}
+
+// Read restores an archive from `r` into the database. Rows that already
+// exist are left untouched, so restoring the same archive twice is safe.
+// Everything is restored in a single transaction.
+func Read(ctx context.Context, r io.Reader) (*Manifest, error) {
+	tr := tar.NewReader(r)
+	manifest := &Manifest{Counts: map[string]int{}}
+	seenManifest := false
+
+	err := database.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for {
+			header, err := tr.Next()
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if header.Name == "manifest.json" {
+				if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+					return fmt.Errorf("invalid manifest: %w", err)
+				}
+
+				if manifest.Version > Version {
+					return fmt.Errorf("archive format version %d is newer than %d", manifest.Version, Version)
+				}
+
+				seenManifest = true
+
+				continue
+			}
+
+			if !seenManifest {
+				return errors.New("archive has to start with manifest.json")
+			}
+
+			t, ok := tableFor(header.Name)
+
+			if !ok {
+				return fmt.Errorf("unexpected file %s in archive", header.Name)
+			}
+
+			if err := restoreTable(tx, t, manifest.Version, tr); err != nil {
+				return fmt.Errorf("error when restoring %s: %w", t.name, err)
+			}
+		}
+
+		if !seenManifest {
+			return errors.New("archive has no manifest.json")
+		}
+
+		// IDs are restored as they were, so the sequences handing out new
+		// ones have to be moved past them
+		if tx.Dialector.Name() == "postgres" {
+			return resetSequences(tx)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func tableFor(name string) (table, bool) {
+	for _, t := range tables {
+		if t.name+".jsonl" == name {
+			return t, true
+		}
+	}
+
+	return table{}, false
+}
+
+// resetSequences moves the sequence of every auto-incremented ID past the
+// highest one in its table
+func resetSequences(tx *gorm.DB) error {
+	for _, t := range tables {
+		stmt := &gorm.Statement{DB: tx}
+
+		if err := stmt.Parse(t.new()); err != nil {
+			return err
+		}
+
+		field := stmt.Schema.PrioritizedPrimaryField
+
+		if field == nil || !field.AutoIncrement {
+			continue
+		}
+
+		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', '%[2]s'), COALESCE(MAX(%[2]s), 0) + 1, false) FROM %[1]s",
+			stmt.Schema.Table, field.DBName)
+
+		if err := tx.Exec(query).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func restoreTable(tx *gorm.DB, t table, version int, r io.Reader) error {
+	fields, err := columns(tx, t)
+
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	// Documents can be far larger than the default token size
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		row := t.new()
+
+		if version < 2 {
+			if err := json.Unmarshal(scanner.Bytes(), row); err != nil {
+				return err
+			}
+		} else if err := unmarshalRow(scanner.Bytes(), fields, row); err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// unmarshalRow sets the `fields` of `row` from a JSON object keyed by
+// column names. Columns missing from it keep their zero value.
+func unmarshalRow(data []byte, fields []*schema.Field, row interface{}) error {
+	values := map[string]json.RawMessage{}
+
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		value, ok := values[field.DBName]
+
+		if !ok {
+			continue
+		}
+
+		if err := json.Unmarshal(value, field.ReflectValueOf(reflect.ValueOf(row)).Addr().Interface()); err != nil {
+			return fmt.Errorf("column %s: %w", field.DBName, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package broker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+)
+
+// Publisher sends messages to a message broker
+type Publisher interface {
+	Publish(subject string, data []byte) error
+	Close() error
+}
+
+// Message is the JSON published for every event
+type Message struct {
+	Type     string   `json:"type"`
+	Document Document `json:"document"`
+	Actor    string   `json:"actor"`
+	Detail   string   `json:"detail,omitempty"`
+	At       int64    `json:"at"`
+}
+
+// Document is what messages tell about a document, its content and the
+// creator's IP are never published. Neither is the ID of a document that
+// isn't listed publicly, since knowing it is what grants access: IDHash lets
+// consumers match it against IDs they already know instead.
+type Document struct {
+	ID           string `json:"id,omitempty"`
+	IDHash       string `json:"id_hash"`
+	Extension    string `json:"extension,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Public       bool   `json:"public,omitempty"`
+	Private      bool   `json:"private,omitempty"`
+}
+
+var (
+	// mu guards closed, so nothing is sent on queue once Stop closed it
+	mu     sync.Mutex
+	closed bool
+	queue  chan Message
+	done   chan struct{}
+)
+
+// Start publishes every document event to the broker configured in
+// `broker`, if any. Events are queued and sent in the background, so a slow
+// broker never holds up requests. Only NATS is supported, over plain TCP.
+func Start() {
+	options := config.Config().Broker
+
+	if options.Driver == "" {
+		return
+	}
+
+	publisher := &NATS{
+		Address:  options.Address,
+		Token:    options.Token,
+		User:     options.User,
+		Password: options.Password,
+		Timeout:  time.Duration(options.Timeout) * time.Millisecond,
+	}
+
+	queue = make(chan Message, options.Buffer)
+	done = make(chan struct{})
+
+	events.Subscribe(enqueue)
+
+	go run(publisher, options.Subject)
+}
+
+// Stop publishes the events still queued, unless `ctx` is done first
+func Stop(ctx context.Context) {
+	if queue == nil {
+		return
+	}
+
+	mu.Lock()
+	closed = true
+	close(queue)
+	mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func enqueue(ctx context.Context, event events.Event) {
+	sum := sha256.Sum256([]byte(event.Document.ID))
+	msg := Message{
+		Type: event.Type,
+		Document: Document{
+			IDHash:       hex.EncodeToString(sum[:]),
+			Extension:    event.Document.Extension,
+			Owner:        event.Document.Owner,
+			Organization: event.Document.Organization,
+			Public:       event.Document.Public,
+			Private:      event.Document.Private,
+		},
+		Actor:  event.Actor,
+		Detail: event.Detail,
+		At:     event.At.Unix(),
+	}
+
+	if (event.Document.Public && !event.Document.Private) || config.Config().Broker.AllIDs {
+		msg.Document.ID = event.Document.ID
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if closed {
+		return
+	}
+
+	select {
+	case queue <- msg:
+	default:
+		log.Printf("Broker queue is full, dropped %s event of %s", event.Type, event.Document.ID)
+	}
+}
+
+func run(publisher Publisher, prefix string) {
+	defer close(done)
+	defer publisher.Close()
+
+	for msg := range queue {
+		data, err := json.Marshal(&msg)
+
+		if err == nil {
+			err = publisher.Publish(prefix+"."+msg.Type, data)
+		}
+
+		if err != nil {
+			log.Printf("Couldn't publish %s event of %s: %v", msg.Type, msg.Document.IDHash, err)
+		}
+	}
+}
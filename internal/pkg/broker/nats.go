@@ -0,0 +1,233 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package broker
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/version"
+)
+
+// NATS publishes messages with the core NATS protocol. It connects on the
+// first message and again whenever the connection was lost. Connections
+// aren't encrypted, so the token or password are sent in the clear, and
+// servers requiring TLS are refused.
+type NATS struct {
+	Address  string // host:port
+	Token    string
+	User     string
+	Password string
+	Timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+// natsInfo is the part of the server's INFO message we care about
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is the CONNECT message sent to the server
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	Token    string `json:"auth_token,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"pass,omitempty"`
+}
+
+// Publish sends `data` on `subject`. A message failing on a connection
+// that went stale is retried once on a new one.
+func (n *NATS) Publish(subject string, data []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reused := n.conn != nil
+	err := n.publish(subject, data)
+
+	if err != nil && reused {
+		err = n.publish(subject, data)
+	}
+
+	return err
+}
+
+// Close closes the connection, if there's one
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		return nil
+	}
+
+	err := n.conn.Close()
+	n.conn = nil
+
+	return err
+}
+
+func (n *NATS) publish(subject string, data []byte) error {
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+
+	n.conn.SetWriteDeadline(time.Now().Add(n.Timeout))
+	fmt.Fprintf(n.w, "PUB %s %d\r\n", subject, len(data))
+	n.w.Write(data)
+	n.w.WriteString("\r\n")
+
+	if err := n.w.Flush(); err != nil {
+		n.conn.Close()
+		n.conn = nil
+
+		return err
+	}
+
+	return nil
+}
+
+// connect opens a connection and authenticates, n.mu must be held
+func (n *NATS) connect() error {
+	conn, err := net.DialTimeout("tcp", n.Address, n.Timeout)
+
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(n.Timeout))
+	r := bufio.NewReader(conn)
+
+	if err := n.handshake(conn, r); err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	conn.SetDeadline(time.Time{})
+	n.conn = conn
+	n.w = bufio.NewWriter(conn)
+
+	go n.read(conn, r)
+
+	return nil
+}
+
+func (n *NATS) handshake(conn net.Conn, r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: expected INFO, got %q", strings.TrimSpace(line))
+	}
+
+	info := natsInfo{}
+
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return fmt.Errorf("nats: invalid INFO: %w", err)
+	}
+
+	if info.TLSRequired {
+		return errors.New("nats: the server requires TLS, which isn't supported")
+	}
+
+	connect, err := json.Marshal(&natsConnect{
+		Name:     "spirit",
+		Lang:     "go",
+		Version:  version.Version,
+		Protocol: 1,
+		Token:    n.Token,
+		User:     n.User,
+		Password: n.Password,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// The server answers the PING once it accepted CONNECT, or with an
+	// error if it didn't
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		return err
+	}
+
+	line, err = r.ReadString('\n')
+
+	if err != nil {
+		return err
+	}
+
+	if line = strings.TrimSpace(line); line != "PONG" {
+		return fmt.Errorf("nats: %s", line)
+	}
+
+	return nil
+}
+
+// read answers the server's keepalive PINGs and logs errors it sends,
+// until the connection is closed
+func (n *NATS) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+
+		if err != nil {
+			break
+		}
+
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			n.mu.Lock()
+
+			if n.conn == conn {
+				n.w.WriteString("PONG\r\n")
+				n.w.Flush()
+			}
+
+			n.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("NATS server error: %s", line)
+		}
+	}
+
+	n.mu.Lock()
+
+	if n.conn == conn {
+		n.conn.Close()
+		n.conn = nil
+	}
+
+	n.mu.Unlock()
+}
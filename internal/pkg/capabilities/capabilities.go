@@ -0,0 +1,128 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capabilities
+
+import (
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/codeimage"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+	"github.com/spacebin-org/spirit/internal/pkg/version"
+)
+
+// Capabilities are the public settings of an instance, so clients don't
+// have to hard-code them
+type Capabilities struct {
+	Version string `json:"version"`
+
+	// Limits for documents the caller creates, in bytes and characters,
+	// 0 for none
+	MaxDocumentLength int `json:"max_document_length"`
+	MaxLines          int `json:"max_lines"`
+	MaxLineLength     int `json:"max_line_length"`
+	MaxTags           int `json:"max_tags"`
+
+	ID struct {
+		Format   string `json:"format"`             // "random", "words", "uuid" or "nanoid"
+		Length   int    `json:"length,omitempty"`   // of random IDs
+		Alphabet string `json:"alphabet,omitempty"` // of random IDs
+	} `json:"id"`
+
+	Expiry struct {
+		MaxAge int64 `json:"max_age"` // in seconds, 0 keeps documents forever
+		Custom bool  `json:"custom"`  // clients can ask for a shorter expiry
+	} `json:"expiry"`
+
+	Auth struct {
+		Enabled       bool   `json:"enabled"`       // whether tokens are configured
+		Authenticated bool   `json:"authenticated"` // whether the caller sent one
+		JWT           bool   `json:"jwt"`           // whether tokens can be exchanged for JWTs
+		Challenge     string `json:"challenge"`     // "none", "pow" or "captcha"
+	} `json:"auth"`
+
+	Visibilities []string        `json:"visibilities"`
+	Languages    []string        `json:"languages"`
+	Themes       Themes          `json:"themes"`
+	Features     map[string]bool `json:"features"`
+
+	Compat struct {
+		Hastebin bool `json:"hastebin"`
+		Pastebin bool `json:"pastebin"`
+	} `json:"compat"`
+}
+
+// Themes are the names of the themes each renderer supports
+type Themes struct {
+	Embed []string `json:"embed"`
+	Image []string `json:"image"`
+}
+
+// Register loads the capability discovery endpoint
+func Register(app *fiber.App) {
+	app.Get("/v1/config", func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+		documents := config.Config().Documents
+
+		caps := Capabilities{
+			Version:           version.Version,
+			MaxDocumentLength: document.MaxLength(identity),
+			MaxLines:          documents.MaxLines,
+			MaxLineLength:     documents.MaxLineLength,
+			MaxTags:           documents.MaxTags,
+			Visibilities:      []string{document.VisibilityPublic, document.VisibilityUnlisted, document.VisibilityPrivate},
+			Languages:         document.Languages(),
+			Themes:            Themes{Embed: document.EmbedThemes(), Image: imageThemes()},
+			Features:          features.All(),
+		}
+
+		caps.ID.Format = documents.IDFormat
+
+		if documents.IDFormat == document.IDRandom {
+			caps.ID.Length = documents.IDLength
+			caps.ID.Alphabet = documents.IDAlphabet
+		}
+
+		caps.Expiry.MaxAge = documents.MaxAge
+		caps.Expiry.Custom = true
+
+		caps.Auth.Enabled = len(config.Config().Auth.Tokens) > 0
+		caps.Auth.Authenticated = identity != nil
+		caps.Auth.JWT = config.Config().Auth.JWT.Key != ""
+		caps.Auth.Challenge = config.Config().Challenge.Mode
+
+		caps.Compat.Hastebin = documents.HastebinCompat
+		caps.Compat.Pastebin = documents.PastebinCompat
+
+		return c.Status(200).JSON(&caps)
+	})
+}
+
+func imageThemes() []string {
+	names := make([]string, 0, len(codeimage.Themes))
+
+	for name := range codeimage.Themes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
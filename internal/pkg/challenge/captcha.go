@@ -0,0 +1,61 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package challenge
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+)
+
+var captchaClient = &http.Client{Timeout: 5 * time.Second}
+
+// Captcha verifies tokens against a provider's `siteverify` endpoint
+type Captcha struct {
+	VerifyURL string
+	Secret    string
+}
+
+// Verify asks the provider whether `response` is a valid token
+func (v *Captcha) Verify(c *fiber.Ctx, response string) error {
+	res, err := captchaClient.PostForm(v.VerifyURL, url.Values{
+		"secret":   {v.Secret},
+		"response": {response},
+		"remoteip": {clientip.IP(c).String()},
+	})
+
+	if err != nil {
+		return errors.New("couldn't verify captcha")
+	}
+
+	defer res.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil || !result.Success {
+		return errors.New("captcha is invalid")
+	}
+
+	return nil
+}
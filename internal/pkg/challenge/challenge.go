@@ -0,0 +1,83 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * Anonymous clients can be asked to solve a challenge before creating a
+ * document, which makes scripted floods expensive. Two kinds are supported:
+
+ *  - "pow": a hashcash-style proof of work. The client fetches a challenge
+ *    from `GET /v1/challenge` and searches for a nonce so that
+ *    sha256("<challenge>:<nonce>") starts with `difficulty` zero bits.
+ *  - "captcha": a token from any CAPTCHA provider implementing the common
+ *    `siteverify` API (hCaptcha, reCAPTCHA, Cloudflare Turnstile).
+
+ * Either way the answer is sent in the `X-Challenge-Response` header, as
+ * "<challenge>:<nonce>" for proof of work or as the provider's token.
+ */
+
+package challenge
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Header carries the client's answer to the challenge
+const Header = "X-Challenge-Response"
+
+// Verifier checks a client's answer to a challenge
+type Verifier interface {
+	Verify(c *fiber.Ctx, response string) error
+}
+
+// New returns the verifier for the configured mode, or nil when challenges
+// are disabled
+func New() (Verifier, error) {
+	switch config.Config().Challenge.Mode {
+	case "pow":
+		return NewProofOfWork()
+	case "captcha":
+		return &Captcha{
+			VerifyURL: config.Config().Challenge.Captcha.VerifyURL,
+			Secret:    config.Config().Challenge.Captcha.Secret,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// Require rejects anonymous requests that don't carry a valid answer to the
+// challenge. Authenticated requests are let through.
+func Require(v Verifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if v == nil || auth.FromRequest(c) != nil {
+			return c.Next()
+		}
+
+		response := c.Get(Header)
+
+		if response == "" {
+			return fiber.NewError(fiber.StatusForbidden, "a challenge response is required")
+		}
+
+		if err := v.Verify(c, response); err != nil {
+			return fiber.NewError(fiber.StatusForbidden, err.Error())
+		}
+
+		return c.Next()
+	}
+}
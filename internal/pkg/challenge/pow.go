@@ -0,0 +1,154 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package challenge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// ProofOfWork issues and verifies hashcash-style challenges. Challenges are
+// signed, so nothing needs to be stored until one is redeemed.
+type ProofOfWork struct {
+	Difficulty int
+	Expiry     time.Duration
+
+	secret []byte
+
+	mu   sync.Mutex
+	used map[string]time.Time // redeemed challenges, until they expire
+}
+
+// NewProofOfWork creates a verifier from the config. Without a configured
+// secret a random one is used, so challenges don't survive restarts.
+func NewProofOfWork() (*ProofOfWork, error) {
+	secret := []byte(config.Config().Challenge.PoW.Secret)
+
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ProofOfWork{
+		Difficulty: config.Config().Challenge.PoW.Difficulty,
+		Expiry:     time.Duration(config.Config().Challenge.PoW.Expiry) * time.Millisecond,
+		secret:     secret,
+		used:       map[string]time.Time{},
+	}, nil
+}
+
+// Issue creates a new challenge in the form "<expiry>.<random>.<signature>"
+func (p *ProofOfWork) Issue() (string, time.Time, error) {
+	random := make([]byte, 16)
+
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expires := time.Now().Add(p.Expiry)
+	body := strconv.FormatInt(expires.Unix(), 10) + "." + hex.EncodeToString(random)
+
+	return body + "." + p.sign(body), expires, nil
+}
+
+func (p *ProofOfWork) sign(body string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(body))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a "<challenge>:<nonce>" response
+func (p *ProofOfWork) Verify(c *fiber.Ctx, response string) error {
+	sep := strings.LastIndex(response, ":")
+
+	if sep < 0 {
+		return errors.New("challenge response must be <challenge>:<nonce>")
+	}
+
+	challenge := response[:sep]
+	parts := strings.Split(challenge, ".")
+
+	if len(parts) != 3 || !hmac.Equal([]byte(p.sign(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return errors.New("challenge is invalid")
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+
+	if err != nil || time.Now().Unix() > expiry {
+		return errors.New("challenge has expired")
+	}
+
+	hash := sha256.Sum256([]byte(response))
+
+	if leadingZeros(hash[:]) < p.Difficulty {
+		return fmt.Errorf("proof of work needs %d leading zero bits", p.Difficulty)
+	}
+
+	return p.redeem(challenge, time.Unix(expiry, 0))
+}
+
+// redeem makes sure every challenge can only be used once
+func (p *ProofOfWork) redeem(challenge string, expires time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	for key, expiry := range p.used {
+		if now.After(expiry) {
+			delete(p.used, key)
+		}
+	}
+
+	if _, ok := p.used[challenge]; ok {
+		return errors.New("challenge has already been used")
+	}
+
+	p.used[challenge] = expires
+
+	return nil
+}
+
+func leadingZeros(hash []byte) int {
+	zeros := 0
+
+	for _, b := range hash {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+
+		zeros += 8
+	}
+
+	return zeros
+}
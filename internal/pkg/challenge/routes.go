@@ -0,0 +1,45 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package challenge
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Register loads the endpoint handing out proof of work challenges. It's a
+// no-op for other verifiers.
+func Register(app *fiber.App, v Verifier) {
+	pow, ok := v.(*ProofOfWork)
+
+	if !ok {
+		return
+	}
+
+	app.Get("/v1/challenge", func(c *fiber.Ctx) error {
+		challenge, expires, err := pow.Issue()
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{
+			"challenge":  challenge,
+			"difficulty": pow.Difficulty,
+			"expires_at": expires.Unix(),
+		})
+	})
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/domain"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Client creates documents on a Spacebin instance
+type Client struct {
+	Server string // Base URL of the instance.
+	Token  string // Optional auth token.
+}
+
+// Paste creates a document and returns its URL. An expiry of 0 leaves it to
+// the instance's retention rules.
+func (c *Client) Paste(content, extension string, expiry time.Duration) (string, error) {
+	base := strings.TrimSuffix(c.Server, "/")
+
+	body, err := json.Marshal(map[string]interface{}{
+		"content":   content,
+		"extension": extension,
+		"expiry":    int64(expiry / time.Second),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", base+"/v1/documents/", bytes.NewReader(body))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := httpClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	var response domain.Response
+
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("unexpected response from %s: %s", base, res.Status)
+	}
+
+	if response.Error != "" {
+		return "", errors.New(response.Error)
+	}
+
+	if response.Payload.ID == nil {
+		return "", fmt.Errorf("%s didn't return a document ID", base)
+	}
+
+	return links.Document(base, *response.Payload.ID), nil
+}
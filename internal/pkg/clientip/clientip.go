@@ -0,0 +1,148 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientip
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// ParseNetworks parses a list of CIDRs, bare addresses are treated as a
+// network containing only that address
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: entry}
+			}
+
+			bits := 8 * net.IPv6len
+
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Contains reports whether `ip` is inside any of `networks`
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parsed is the trusted proxy list of a config
+type parsed struct {
+	config   *config.Schema
+	networks []*net.IPNet
+}
+
+// trusted holds the last parsed list
+var trusted atomic.Value
+
+// trustedProxies parses the trusted proxy list when the config it's read
+// from changed, so reloads apply to it. The list is checked when the config
+// is loaded, so errors can't happen here.
+func trustedProxies() []*net.IPNet {
+	current := config.Config()
+
+	if last, ok := trusted.Load().(parsed); ok && last.config == current {
+		return last.networks
+	}
+
+	networks, _ := ParseNetworks(current.Server.Proxy.Trusted)
+	trusted.Store(parsed{config: current, networks: networks})
+
+	return networks
+}
+
+// IP returns the address of the client that made the request.
+//
+// The configured proxy header is only honored when the request comes from a
+// trusted proxy. For `X-Forwarded-For` the list is read right to left,
+// skipping trusted proxies, so clients can't spoof an address by prepending
+// to the header.
+func IP(c *fiber.Ctx) net.IP {
+	remote := c.Context().RemoteIP()
+	proxies := trustedProxies()
+
+	header := config.Config().Server.Proxy.Header
+
+	if header == "" || !Contains(proxies, remote) {
+		return remote
+	}
+
+	value := c.Get(header)
+
+	if value == "" {
+		return remote
+	}
+
+	if !strings.EqualFold(header, fiber.HeaderXForwardedFor) {
+		if ip := net.ParseIP(strings.TrimSpace(value)); ip != nil {
+			return ip
+		}
+
+		return remote
+	}
+
+	hops := strings.Split(value, ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+
+		if ip == nil {
+			break
+		}
+
+		if !Contains(proxies, ip) {
+			return ip
+		}
+
+		remote = ip
+	}
+
+	return remote
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientip
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"192.168.1.1", "192.168.1.1/32", false},
+		{"::1", "::1/128", false},
+		{"2001:db8::/32", "2001:db8::/32", false},
+		{"10.0.0.0/33", "", true},
+		{"localhost", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			networks, err := ParseNetworks([]string{tt.entry})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetworks() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err == nil && networks[0].String() != tt.want {
+				t.Errorf("ParseNetworks() = %s, want %s", networks[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"::ffff:10.0.0.1", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := Contains(networks, net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+// clientIP returns what IP makes of a request from `remote` with `header`
+// set to `value`, unless it's empty
+func clientIP(remote, header, value string) string {
+	app := fiber.New()
+	req := fasthttp.Request{}
+
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+
+	fctx := fasthttp.RequestCtx{}
+	fctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remote)}, nil)
+
+	c := app.AcquireCtx(&fctx)
+	defer app.ReleaseCtx(c)
+
+	return IP(c).String()
+}
+
+func TestIPForwardedFor(t *testing.T) {
+	configtest.Load(t, `
+[server.proxy]
+trusted = ["10.0.0.0/8", "192.168.1.1"]
+header = "X-Forwarded-For"
+`)
+
+	tests := []struct {
+		name   string
+		remote string
+		value  string
+		want   string
+	}{
+		{"direct", "203.0.113.5", "", "203.0.113.5"},
+		{"spoofed without a proxy", "203.0.113.5", "198.51.100.7", "203.0.113.5"},
+		{"proxy without a header", "10.0.0.1", "", "10.0.0.1"},
+		{"proxy", "10.0.0.1", "198.51.100.7", "198.51.100.7"},
+		{"proxy given as an address", "192.168.1.1", "198.51.100.7", "198.51.100.7"},
+		{"prepended by the client", "10.0.0.1", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"chain of proxies", "10.0.0.1", "198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"only proxies", "10.0.0.1", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"garbage after the client", "10.0.0.1", "198.51.100.7, junk", "10.0.0.1"},
+		{"garbage before the client", "10.0.0.1", "junk, 198.51.100.7", "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientIP(tt.remote, fiber.HeaderXForwardedFor, tt.value); got != tt.want {
+				t.Errorf("IP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPRealIP(t *testing.T) {
+	configtest.Load(t, `
+[server.proxy]
+trusted = ["10.0.0.0/8"]
+header = "X-Real-IP"
+`)
+
+	tests := []struct {
+		name   string
+		remote string
+		value  string
+		want   string
+	}{
+		{"direct", "203.0.113.5", "198.51.100.7", "203.0.113.5"},
+		{"proxy", "10.0.0.1", "198.51.100.7", "198.51.100.7"},
+		{"padded", "10.0.0.1", " 198.51.100.7 ", "198.51.100.7"},
+		{"list", "10.0.0.1", "1.2.3.4, 198.51.100.7", "10.0.0.1"},
+		{"garbage", "10.0.0.1", "junk", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientIP(tt.remote, "X-Real-IP", tt.value); got != tt.want {
+				t.Errorf("IP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPReload(t *testing.T) {
+	configtest.Load(t, "[server.proxy]\ntrusted = [\"10.0.0.0/8\"]\nheader = \"X-Forwarded-For\"\n")
+
+	if got := clientIP("10.0.0.1", fiber.HeaderXForwardedFor, "198.51.100.7"); got != "198.51.100.7" {
+		t.Fatalf("IP() = %s behind a trusted proxy", got)
+	}
+
+	configtest.Reload(t, "[server.proxy]\ntrusted = [\"192.168.0.0/16\"]\nheader = \"X-Forwarded-For\"\n")
+
+	if got := clientIP("10.0.0.1", fiber.HeaderXForwardedFor, "198.51.100.7"); got != "10.0.0.1" {
+		t.Errorf("IP() = %s behind a proxy that's no longer trusted", got)
+	}
+
+	if got := clientIP("192.168.0.1", fiber.HeaderXForwardedFor, "198.51.100.7"); got != "198.51.100.7" {
+		t.Errorf("IP() = %s behind a newly trusted proxy", got)
+	}
+}
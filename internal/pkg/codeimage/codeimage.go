@@ -0,0 +1,140 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package codeimage renders code to PNG images in the style of a window,
+// like carbon.now.sh does, to be put into slides and posts. Text is drawn
+// with a built-in bitmap font covering printable ASCII, other characters
+// show up as question marks.
+package codeimage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// Layout, in pixels of the font before scaling
+const (
+	scale      = 2
+	cellWidth  = 6 // glyphs are 5 wide, plus spacing
+	cellHeight = 10
+	padding    = 12
+	titleBar   = 18
+)
+
+// Theme are the colors an image is drawn with
+type Theme struct {
+	Frame      color.RGBA // around the window
+	Background color.RGBA
+	Foreground color.RGBA
+	Gutter     color.RGBA // line numbers and the title
+}
+
+// Themes available to Render
+var Themes = map[string]Theme{
+	"light": {
+		Frame:      color.RGBA{0xab, 0xb8, 0xc3, 0xff},
+		Background: color.RGBA{0xff, 0xff, 0xff, 0xff},
+		Foreground: color.RGBA{0x24, 0x29, 0x2e, 0xff},
+		Gutter:     color.RGBA{0x95, 0x9d, 0xa5, 0xff},
+	},
+	"dark": {
+		Frame:      color.RGBA{0x3b, 0x4a, 0x5a, 0xff},
+		Background: color.RGBA{0x0d, 0x11, 0x17, 0xff},
+		Foreground: color.RGBA{0xc9, 0xd1, 0xd9, 0xff},
+		Gutter:     color.RGBA{0x6e, 0x76, 0x81, 0xff},
+	},
+}
+
+// Window buttons, left to right
+var buttons = []color.RGBA{
+	{0xff, 0x5f, 0x56, 0xff},
+	{0xff, 0xbd, 0x2e, 0xff},
+	{0x27, 0xc9, 0x3f, 0xff},
+}
+
+// Render draws `lines`, numbered from `first`, in a window titled `title`
+// and returns it as a PNG
+func Render(title string, lines []string, first int, theme Theme) ([]byte, error) {
+	gutter := len(strconv.Itoa(first+len(lines)-1)) + 2
+	columns := len(title) + 12
+
+	for i := range lines {
+		lines[i] = strings.ReplaceAll(lines[i], "\t", "    ")
+
+		if n := gutter + len([]rune(lines[i])); n > columns {
+			columns = n
+		}
+	}
+
+	width := columns*cellWidth + 2*padding
+	height := titleBar + len(lines)*cellHeight + padding
+	img := image.NewRGBA(image.Rect(0, 0, (width+2*padding)*scale, (height+2*padding)*scale))
+
+	draw.Draw(img, img.Bounds(), &image.Uniform{theme.Frame}, image.Point{}, draw.Src)
+	fill(img, padding, padding, width, height, theme.Background)
+
+	for i, c := range buttons {
+		fill(img, 2*padding+i*10, padding+7, 6, 6, c)
+	}
+
+	text(img, 2*padding+36, padding+5, title, theme.Gutter)
+
+	for i, line := range lines {
+		y := padding + titleBar + i*cellHeight
+		number := strconv.Itoa(first + i)
+
+		text(img, 2*padding+(gutter-2-len(number))*cellWidth, y, number, theme.Gutter)
+		text(img, 2*padding+gutter*cellWidth, y, line, theme.Foreground)
+	}
+
+	var b bytes.Buffer
+
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// fill paints a rectangle, given in unscaled pixels
+func fill(img *image.RGBA, x, y, w, h int, c color.RGBA) {
+	r := image.Rect(x*scale, y*scale, (x+w)*scale, (y+h)*scale)
+	draw.Draw(img, r, &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+// text draws `s` with its top left corner at `x`, `y`
+func text(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+
+		for col, bits := range glyphs[r-' '] {
+			for row := 0; row < 8; row++ {
+				if bits&(1<<row) != 0 {
+					fill(img, x+col, y+row, 1, 1, c)
+				}
+			}
+		}
+
+		x += cellWidth
+	}
+}
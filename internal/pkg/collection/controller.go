@@ -0,0 +1,185 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collection
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxDocuments is how many documents a collection can hold
+const MaxDocuments = 500
+
+// Errors returned when changing a collection
+var (
+	ErrNotOwner = errors.New("only the creator of a collection can change it")
+	ErrFull     = errors.New("collection is full")
+)
+
+// Create makes an empty collection named `name` for `owner`. Its ID is
+// generated like a document's.
+func Create(ctx context.Context, owner, name string) (*models.Collection, error) {
+	for attempt := 0; attempt <= config.Config().Documents.IDRetries; attempt++ {
+		collection := models.Collection{ID: document.NewID(), Name: name, Owner: owner}
+
+		var count int64
+		err := database.DBConn.WithContext(ctx).Model(&models.Collection{}).Where("id = ?", collection.ID).Count(&count).Error
+
+		if err != nil {
+			return nil, err
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		return &collection, database.DBConn.WithContext(ctx).Create(&collection).Error
+	}
+
+	return nil, document.ErrNoFreeID
+}
+
+// Get retrieves the collection `id` and the documents in it that can still
+// be served to `identity`, in the order they were added
+func Get(ctx context.Context, identity *auth.Identity, id string) (*models.Collection, []models.Document, error) {
+	collection := models.Collection{}
+
+	if err := database.DBConn.WithContext(ctx).Where("id = ?", id).First(&collection).Error; err != nil {
+		return nil, nil, err
+	}
+
+	ids := []string{}
+	err := database.DBConn.WithContext(ctx).Model(&models.CollectionDocument{}).
+		Where("collection_id = ?", id).Order("created_at").Pluck("document_id", &ids).Error
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	documents, err := document.GetDocuments(ctx, identity, ids)
+
+	return &collection, documents, err
+}
+
+// GetOwned lists the collections of `owner`, newest first
+func GetOwned(ctx context.Context, owner string) ([]models.Collection, error) {
+	collections := []models.Collection{}
+	err := database.DBConn.WithContext(ctx).Where("owner = ?", owner).Order("created_at DESC").Find(&collections).Error
+
+	return collections, err
+}
+
+// Rename changes the name of collection `id` on behalf of `identity`
+func Rename(ctx context.Context, identity *auth.Identity, id, name string) (*models.Collection, error) {
+	collection := models.Collection{}
+
+	err := database.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := editable(tx, identity, id, &collection); err != nil {
+			return err
+		}
+
+		return tx.Model(&collection).Update("name", name).Error
+	})
+
+	return &collection, err
+}
+
+// Delete removes collection `id` on behalf of `identity`. The documents in
+// it are kept.
+func Delete(ctx context.Context, identity *auth.Identity, id string) error {
+	return database.Transaction(ctx, func(tx *gorm.DB) error {
+		collection := models.Collection{}
+
+		if err := editable(tx, identity, id, &collection); err != nil {
+			return err
+		}
+
+		if err := tx.Where("collection_id = ?", id).Delete(&models.CollectionDocument{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&collection).Error
+	})
+}
+
+// AddDocument puts the document `documentID` in collection `id` on behalf
+// of `identity`. Adding a document twice does nothing.
+func AddDocument(ctx context.Context, identity *auth.Identity, id, documentID string) error {
+	if _, err := document.GetDocumentInfo(ctx, identity, documentID); err != nil {
+		return err
+	}
+
+	return database.Transaction(ctx, func(tx *gorm.DB) error {
+		collection := models.Collection{}
+
+		if err := editable(tx, identity, id, &collection); err != nil {
+			return err
+		}
+
+		var count int64
+
+		if err := tx.Model(&models.CollectionDocument{}).Where("collection_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count >= MaxDocuments {
+			return ErrFull
+		}
+
+		entry := models.CollectionDocument{CollectionID: id, DocumentID: documentID, CreatedAt: time.Now().Unix()}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error
+	})
+}
+
+// RemoveDocument takes the document `documentID` out of collection `id` on
+// behalf of `identity`
+func RemoveDocument(ctx context.Context, identity *auth.Identity, id, documentID string) error {
+	return database.Transaction(ctx, func(tx *gorm.DB) error {
+		collection := models.Collection{}
+
+		if err := editable(tx, identity, id, &collection); err != nil {
+			return err
+		}
+
+		return tx.Where("collection_id = ? AND document_id = ?", id, documentID).
+			Delete(&models.CollectionDocument{}).Error
+	})
+}
+
+// editable loads collection `id` into `collection` if `identity` may
+// change it
+func editable(tx *gorm.DB, identity *auth.Identity, id string, collection *models.Collection) error {
+	if err := tx.Where("id = ?", id).First(collection).Error; err != nil {
+		return err
+	}
+
+	if collection.Owner != identity.Name && !identity.IsAdmin() {
+		return ErrNotOwner
+	}
+
+	return nil
+}
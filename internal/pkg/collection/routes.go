@@ -0,0 +1,154 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collection
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"gorm.io/gorm"
+)
+
+// Response describes a collection and the documents in it
+type Response struct {
+	models.Collection
+	URL       string               `json:"url"`
+	Documents []document.ListEntry `json:"documents"`
+}
+
+// Register loads the collection endpoints. Anyone with the link can see a
+// collection, only its creator can change it.
+func Register(app *fiber.App) {
+	api := app.Group("/v1/collections")
+
+	api.Post("/", auth.Require(), func(c *fiber.Ctx) error {
+		b := new(CollectionRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if err := b.Validate(); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		collection, err := Create(c.UserContext(), auth.FromRequest(c).Name, b.Name)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(201).JSON(response(links.Base(c), collection, nil))
+	})
+
+	api.Get("/:id", func(c *fiber.Ctx) error {
+		collection, documents, err := Get(c.UserContext(), auth.FromRequest(c), c.Params("id"))
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(404, err.Error())
+		}
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(response(links.Base(c), collection, documents))
+	})
+
+	api.Patch("/:id", auth.Require(), func(c *fiber.Ctx) error {
+		b := new(CollectionRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if err := b.Validate(); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		collection, err := Rename(c.UserContext(), auth.FromRequest(c), c.Params("id"), b.Name)
+
+		if err != nil {
+			return changeError(err)
+		}
+
+		return c.Status(200).JSON(collection)
+	})
+
+	api.Delete("/:id", auth.Require(), func(c *fiber.Ctx) error {
+		if err := Delete(c.UserContext(), auth.FromRequest(c), c.Params("id")); err != nil {
+			return changeError(err)
+		}
+
+		return c.SendStatus(204)
+	})
+
+	api.Put("/:id/documents/:document", auth.Require(), func(c *fiber.Ctx) error {
+		if err := AddDocument(c.UserContext(), auth.FromRequest(c), c.Params("id"), c.Params("document")); err != nil {
+			return changeError(err)
+		}
+
+		return c.SendStatus(204)
+	})
+
+	api.Delete("/:id/documents/:document", auth.Require(), func(c *fiber.Ctx) error {
+		if err := RemoveDocument(c.UserContext(), auth.FromRequest(c), c.Params("id"), c.Params("document")); err != nil {
+			return changeError(err)
+		}
+
+		return c.SendStatus(204)
+	})
+
+	app.Get("/v1/account/collections", auth.Require(), func(c *fiber.Ctx) error {
+		collections, err := GetOwned(c.UserContext(), auth.FromRequest(c).Name)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{"collections": collections})
+	})
+}
+
+// response describes `collection` holding `documents` for the API
+func response(base string, collection *models.Collection, documents []models.Document) Response {
+	entries := make([]document.ListEntry, 0, len(documents))
+
+	for i := range documents {
+		entries = append(entries, document.NewListEntry(base, &documents[i]))
+	}
+
+	return Response{Collection: *collection, URL: links.Collection(base, collection.ID), Documents: entries}
+}
+
+// changeError maps errors from changing a collection to a response
+func changeError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fiber.NewError(404, err.Error())
+	case errors.Is(err, ErrNotOwner):
+		return fiber.NewError(403, err.Error())
+	case errors.Is(err, ErrFull):
+		return fiber.NewError(409, err.Error())
+	default:
+		return fiber.NewError(500, err.Error())
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package comment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/markdown"
+	"gorm.io/gorm"
+)
+
+// Errors returned when changing comments
+var (
+	ErrNoParent  = errors.New("the comment being replied to isn't on this document")
+	ErrNotAuthor = errors.New("only the author of a comment, or whoever manages the document, can delete it")
+)
+
+// Thread is a comment and the replies to it
+type Thread struct {
+	ID        uint      `json:"id"`
+	ParentID  uint      `json:"parent_id,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Body      string    `json:"body"` // Markdown as it was written.
+	HTML      string    `json:"html"` // The body rendered to HTML.
+	Deleted   bool      `json:"deleted,omitempty"`
+	Hidden    bool      `json:"hidden,omitempty"` // By a moderator, the body isn't served.
+	CreatedAt int64     `json:"created_at"`
+	Replies   []*Thread `json:"replies,omitempty"`
+}
+
+// Create stores `comment`, checking that the comment it replies to is on the
+// same document
+func Create(ctx context.Context, comment models.Comment) (*Thread, error) {
+	if comment.ParentID != 0 {
+		var count int64
+		err := database.DBConn.WithContext(ctx).Model(&models.Comment{}).
+			Where("id = ? AND document_id = ?", comment.ParentID, comment.DocumentID).Count(&count).Error
+
+		if err != nil {
+			return nil, err
+		}
+
+		if count == 0 {
+			return nil, ErrNoParent
+		}
+	}
+
+	if err := database.DBConn.WithContext(ctx).Create(&comment).Error; err != nil {
+		return nil, err
+	}
+
+	return thread(&comment), nil
+}
+
+// List retrieves the comments on document `id` as threads, oldest first.
+// Quarantined comments are left out.
+func List(ctx context.Context, id string) ([]*Thread, error) {
+	comments := []models.Comment{}
+	err := database.DBConn.WithContext(ctx).
+		Where("document_id = ? AND moderation <> ?", id, models.ModerationQuarantined).Order("id").Find(&comments).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	threads := make(map[uint]*Thread, len(comments))
+	roots := []*Thread{}
+
+	// Replies always come after what they reply to, since IDs only grow
+	for i := range comments {
+		t := thread(&comments[i])
+		threads[t.ID] = t
+
+		if parent, ok := threads[t.ParentID]; ok {
+			parent.Replies = append(parent.Replies, t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	return roots, nil
+}
+
+// Find retrieves comment `id` on document `documentID`, as long as it can
+// still be seen: it isn't deleted, hidden or quarantined
+func Find(ctx context.Context, documentID string, id uint) (*models.Comment, error) {
+	comment := models.Comment{}
+	err := database.DBConn.WithContext(ctx).
+		Where("id = ? AND document_id = ? AND deleted = ? AND moderation IN ?", id, documentID, false, []string{models.ModerationNone, models.ModerationFlagged}).
+		First(&comment).Error
+
+	return &comment, err
+}
+
+// Delete clears comment `id` on `doc` on behalf of `identity`. Its replies
+// are kept.
+func Delete(ctx context.Context, identity *auth.Identity, doc *models.Document, id uint) error {
+	return database.Transaction(ctx, func(tx *gorm.DB) error {
+		comment := models.Comment{}
+
+		if err := tx.Where("id = ? AND document_id = ? AND deleted = ?", id, doc.ID, false).First(&comment).Error; err != nil {
+			return err
+		}
+
+		if (comment.Author == "" || comment.Author != identity.Name) && !document.CanManage(identity, doc) {
+			return ErrNotAuthor
+		}
+
+		return tx.Model(&comment).Updates(map[string]interface{}{"deleted": true, "body": ""}).Error
+	})
+}
+
+// thread describes `comment` for the API
+func thread(comment *models.Comment) *Thread {
+	t := Thread{
+		ID:        comment.ID,
+		ParentID:  comment.ParentID,
+		Author:    comment.Author,
+		Body:      comment.Body,
+		Deleted:   comment.Deleted,
+		CreatedAt: comment.CreatedAt,
+	}
+
+	switch {
+	case comment.Moderation == models.CommentHidden:
+		t.Hidden = true
+		t.Body = ""
+	case !comment.Deleted:
+		t.HTML = markdown.Render(comment.Body)
+	}
+
+	return &t
+}
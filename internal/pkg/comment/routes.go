@@ -0,0 +1,203 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package comment
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+	"github.com/spacebin-org/spirit/internal/pkg/metrics"
+	"github.com/spacebin-org/spirit/internal/pkg/moderation"
+	"github.com/spacebin-org/spirit/internal/pkg/ratelimit"
+	"github.com/spacebin-org/spirit/internal/pkg/spam"
+	"gorm.io/gorm"
+)
+
+// Register loads the comment endpoints, which are only served while the
+// comments feature is on. Comments can only be seen by whoever can see the
+// document. New comments go through `filters` like documents do.
+func Register(app *fiber.App, filters spam.Pipeline) {
+	api := app.Group("/v1/documents/:id/comments", features.Require(features.Comments))
+
+	// Commenting is throttled like creating documents
+	createLimit, err := ratelimit.New(func() string {
+		return config.Config().Server.Ratelimits.Create
+	})
+
+	if err != nil {
+		log.Fatalf("Invalid create rate limit: %v", err)
+	}
+
+	api.Get("/", func(c *fiber.Ctx) error {
+		if _, err := document.GetDocumentInfo(c.UserContext(), auth.FromRequest(c), c.Params("id")); err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		threads, err := List(c.UserContext(), c.Params("id"))
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{"comments": threads})
+	})
+
+	api.Post("/", moderation.RejectBanned(), createLimit, func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+
+		if identity == nil && !config.Config().Comments.Anonymous {
+			return fiber.NewError(fiber.StatusUnauthorized)
+		}
+
+		b := new(CommentRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if err := b.Validate(config.Config().Comments.MaxLength); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if _, err := document.GetDocumentInfo(c.UserContext(), identity, c.Params("id")); err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		comment := models.Comment{
+			DocumentID: c.Params("id"),
+			ParentID:   b.ParentID,
+			Body:       b.Body,
+			AuthorIP:   clientip.IP(c).String(),
+		}
+
+		if identity != nil {
+			comment.Author = identity.Name
+		}
+
+		result := filters.Run(&spam.Submission{
+			Content:   b.Body,
+			Extension: "md",
+			IP:        clientip.IP(c),
+		})
+
+		if result.Decision != spam.Allow {
+			metrics.SpamDecisions.Inc(result.Filter, result.Decision.String())
+			comment.ModerationReason = result.Filter + ": " + result.Reason
+		}
+
+		switch result.Decision {
+		case spam.Reject:
+			return fiber.NewError(403, "comment rejected by content filter")
+		case spam.Quarantine:
+			// Like documents, the comment looks posted to whoever wrote it
+			comment.Moderation = models.ModerationQuarantined
+		case spam.Flag:
+			comment.Moderation = models.ModerationFlagged
+		}
+
+		t, err := Create(c.UserContext(), comment)
+
+		if errors.Is(err, ErrNoParent) {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(201).JSON(t)
+	})
+
+	api.Post("/:comment/report", createLimit, func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("comment"), 10, 64)
+
+		if err != nil {
+			return fiber.NewError(400, "invalid comment id")
+		}
+
+		b := new(moderation.ReportRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if err := b.Validate(); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if _, err := document.GetDocumentInfo(c.UserContext(), auth.FromRequest(c), c.Params("id")); err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		if _, err := Find(c.UserContext(), c.Params("id"), uint(id)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(404, err.Error())
+			}
+
+			return fiber.NewError(500, err.Error())
+		}
+
+		report, err := moderation.NewReport(c.UserContext(), models.Report{
+			DocumentID: c.Params("id"),
+			CommentID:  uint(id),
+			Reason:     b.Reason,
+			ReporterIP: clientip.IP(c).String(),
+		})
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(201).JSON(fiber.Map{"id": report.ID, "status": report.Status})
+	})
+
+	api.Delete("/:comment", auth.Require(), func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("comment"), 10, 64)
+
+		if err != nil {
+			return fiber.NewError(400, "invalid comment id")
+		}
+
+		identity := auth.FromRequest(c)
+		doc, err := document.GetDocumentInfo(c.UserContext(), identity, c.Params("id"))
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		err = Delete(c.UserContext(), identity, doc, uint(id))
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return fiber.NewError(404, err.Error())
+		case errors.Is(err, ErrNotAuthor):
+			return fiber.NewError(403, err.Error())
+		case err != nil:
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.SendStatus(204)
+	})
+}
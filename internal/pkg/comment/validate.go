@@ -0,0 +1,36 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package comment
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// CommentRequest represents a valid body object for the create comment
+// request
+type CommentRequest struct {
+	Body     string
+	ParentID uint `json:"parent_id" form:"parent_id"` // The comment being replied to.
+}
+
+// Validate performs validation on the body, allowing up to `maxLength`
+// bytes
+func (r CommentRequest) Validate(maxLength int) error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Body, validation.Required, validation.Length(1, maxLength)),
+	)
+}
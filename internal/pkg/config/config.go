@@ -19,7 +19,8 @@
  * It's powered entirely by koanf.
 
  * First we load some default values from a confmap (L26-L37).
- * Then, on top of that, we load from the `config.toml` file (L47-L49).
+ * Then, on top of that, we load from the config file, `config.toml` unless the
+ * `--config` flag points somewhere else. TOML, YAML and JSON are supported.
  * And then, finally, on top of that file we load from environment variables.
 
  * We decided on this order, notably having environment variables on top, because of
@@ -30,81 +31,637 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"strings"
-	"time"
+	"sync/atomic"
 
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/confmap"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
+	"github.com/mitchellh/mapstructure"
 )
 
 var k = koanf.New(".")
 
-// Config is the loaded config object
-var Config struct {
+// Schema describes every option that can be set in the configuration
+type Schema struct {
 	Server struct {
 		Host              string         `koanf:"host"`
 		Port              int            `koanf:"port"`
 		CompresssionLevel compress.Level `koanf:"compression_level"`
 		Prefork           bool           `koanf:"prefork"`
+		BodyLimit         int            `koanf:"body_limit"`       // in bytes
+		ShutdownTimeout   int            `koanf:"shutdown_timeout"` // in milliseconds
+		PublicURL         string         `koanf:"public_url"`       // used in links, taken from requests if empty
+		Robots            string         `koanf:"robots"`           // served as /robots.txt
+
+		// Responses that are smaller or of other types aren't compressed
+		CompressionMinSize int      `koanf:"compression_min_size"` // in bytes
+		CompressionTypes   []string `koanf:"compression_types"`    // content type prefixes
 
 		Ratelimits struct {
-			Requests int           `koanf:"requests"`
-			Duration time.Duration `koanf:"duration"`
+			Requests int `koanf:"requests"`
+			Duration int `koanf:"duration"` // in milliseconds
+
+			// Per-route overrides in the form of `<requests>/<window>`
+			Create string `koanf:"create"`
+			Fetch  string `koanf:"fetch"`
+
+			// Limit applied to requests made with one of the `auth.tokens`
+			Authenticated string `koanf:"authenticated"`
 		} `koanf:"ratelimits"`
-	}
+
+		// All in milliseconds, 0 disables a timeout
+		Timeouts struct {
+			// Applied to connections, changing them requires a restart
+			Read  int `koanf:"read"`  // reading a whole request, including its body
+			Write int `koanf:"write"` // writing a response
+			Idle  int `koanf:"idle"`  // keep-alive connections between requests
+
+			// Deadlines of handlers and the database queries they run
+			Handler int `koanf:"handler"`
+			Create  int `koanf:"create"` // routes creating documents
+			Fetch   int `koanf:"fetch"`  // routes fetching documents
+		} `koanf:"timeouts"`
+
+		// CORS is only applied to the JSON API, every other route stays
+		// same-origin
+		CORS struct {
+			AllowOrigins     []string `koanf:"allow_origins"`
+			AllowMethods     []string `koanf:"allow_methods"`
+			AllowHeaders     []string `koanf:"allow_headers"`
+			ExposeHeaders    []string `koanf:"expose_headers"`
+			AllowCredentials bool     `koanf:"allow_credentials"`
+			MaxAge           int      `koanf:"max_age"` // in seconds
+		} `koanf:"cors"`
+
+		// Security headers sent with every response, empty values disable
+		// the header
+		Headers struct {
+			ContentSecurityPolicy   string `koanf:"content_security_policy"`
+			StrictTransportSecurity string `koanf:"strict_transport_security"`
+			ReferrerPolicy          string `koanf:"referrer_policy"`
+			FrameOptions            string `koanf:"frame_options"`
+			ContentTypeOptions      string `koanf:"content_type_options"`
+		} `koanf:"headers"`
+
+		// Requests from trusted proxies are attributed to the address in
+		// `header` instead of the proxy
+		Proxy struct {
+			Trusted []string `koanf:"trusted"` // CIDRs or addresses
+			Header  string   `koanf:"header"`
+		} `koanf:"proxy"`
+
+		// CIDRs or addresses allowed to reach the server, and to create
+		// documents. Empty allow lists let everyone through.
+		IPFilter struct {
+			Allow       []string `koanf:"allow"`
+			Deny        []string `koanf:"deny"`
+			CreateAllow []string `koanf:"create_allow"`
+		} `koanf:"ip_filter"`
+
+		// Plain TCP listener creating a document from everything a client
+		// sends, like termbin
+		TCP struct {
+			Enabled bool `koanf:"enabled"`
+			Port    int  `koanf:"port"`
+			Timeout int  `koanf:"timeout"` // in milliseconds, a document ends once the client stops sending
+
+			MaxDuration    int `koanf:"max_duration"`    // in milliseconds, how long a client may take to send a document
+			MaxConnections int `koanf:"max_connections"` // open at once, further clients are turned away
+		} `koanf:"tcp"`
+
+		TLS struct {
+			Enabled  bool     `koanf:"enabled"`
+			Port     int      `koanf:"port"` // `server.port` then only redirects to HTTPS
+			Domains  []string `koanf:"domains"`
+			CacheDir string   `koanf:"cache_dir"`
+			Email    string   `koanf:"email"` // optional contact for Let's Encrypt
+
+			// Client certificates, verified against the CAs in `ca_file`
+			ClientAuth struct {
+				CAFile  string `koanf:"ca_file"` // PEM bundle
+				Admin   bool   `koanf:"admin"`   // required on admin endpoints
+				Metrics bool   `koanf:"metrics"` // required on /metrics
+			} `koanf:"client_auth"`
+		} `koanf:"tls"`
+
+		// Answer everything but health checks, metrics and administrators
+		// with a 503, e.g. during database migrations
+		Maintenance struct {
+			Enabled bool   `koanf:"enabled"`
+			Message string `koanf:"message"` // shown to clients
+		} `koanf:"maintenance"`
+	} `koanf:"server"`
 
 	Documents struct {
-		IDLength          int   `koanf:"id_length"`
-		MaxDocumentLength int   `koanf:"max_document_length"`
-		MaxAge            int64 `koanf:"max_age"`
+		IDFormat          string   `koanf:"id_format"` // "random", "words", "uuid" or "nanoid"
+		IDLength          int      `koanf:"id_length"`
+		ReservedIDs       []string `koanf:"reserved_ids"`        // never given to documents
+		AcceptedIDLengths []int    `koanf:"accepted_id_lengths"` // lengths of older random IDs that are still served
+		IDAlphabet        string   `koanf:"id_alphabet"`         // "letters", "lowercase", "hex" or "base58"
+		IDRetries         int      `koanf:"id_retries"`          // how often a taken ID is generated again
+		MaxDocumentLength int      `koanf:"max_document_length"`
+		MaxAge            int64    `koanf:"max_age"`      // in seconds
+		TrashPeriod       int64    `koanf:"trash_period"` // in seconds, deleted documents can be restored meanwhile
+
+		// Override `max_document_length` for documents created with a
+		// token, 0 falls back to the next lower tier
+		AuthenticatedMaxLength int `koanf:"authenticated_max_length"`
+		AdminMaxLength         int `koanf:"admin_max_length"`
+
+		// Limits on lines, 0 for none. Documents past them, like minified
+		// code, are rejected or only served raw.
+		MaxLines      int    `koanf:"max_lines"`
+		MaxLineLength int    `koanf:"max_line_length"` // in characters
+		Oversized     string `koanf:"oversized"`       // "reject" or "raw"
+
+		// Also serve hastebin's API on /documents and /raw
+		HastebinCompat bool `koanf:"hastebin_compat"`
+
+		// Also accept pastebin.com's api_post.php form
+		PastebinCompat bool `koanf:"pastebin_compat"`
+
+		// List public documents on /v1/public and /v1/trending
+		PublicListing bool `koanf:"public_listing"`
+
+		// Let documents holding a URL redirect to it from /:id
+		Shortener bool `koanf:"shortener"`
+
+		// How many tags a document can have, 0 disables tagging
+		MaxTags int `koanf:"max_tags"`
+
+		// Secret raw URLs are signed with, signing is disabled if empty
+		SigningKey string `koanf:"signing_key"`
+
+		// Store content with NUL bytes as it is instead of rejecting it
+		AllowBinary bool `koanf:"allow_binary"`
+
+		// How long, in seconds, retried create requests with the same
+		// Idempotency-Key header get the same document back, 0 disables it
+		IdempotencyWindow int64 `koanf:"idempotency_window"`
+
+		// Color raw content for curl, wget and httpie without `?ansi=true`
+		ANSIForTerminals bool `koanf:"ansi_for_terminals"`
+
+		// Transforms applied to content before it's validated and stored
+		Normalize struct {
+			LineEndings        bool `koanf:"line_endings"`         // CRLF and CR to LF
+			ExpandTabs         int  `koanf:"expand_tabs"`          // columns per tab, 0 keeps tabs
+			TrailingWhitespace bool `koanf:"trailing_whitespace"`  // at the end of every line
+			TrailingBlankLines bool `koanf:"trailing_blank_lines"` // at the end of the document
+		} `koanf:"normalize"`
 	} `koanf:"documents"`
 
+	// Rules overriding `documents.max_age`, the first matching rule applies
+	Retention struct {
+		Rules []struct {
+			Name    string `koanf:"name"`
+			Creator string `koanf:"creator"`  // "", "anonymous" or "authenticated"
+			MinSize int    `koanf:"min_size"` // in bytes
+			MaxAge  int64  `koanf:"max_age"`  // in seconds, 0 keeps documents forever
+		} `koanf:"rules"`
+	} `koanf:"retention"`
+
+	Auth struct {
+		// Delete an account's documents when it's erased, instead of
+		// keeping them anonymously
+		EraseDocuments bool `koanf:"erase_documents"`
+
+		Tokens []struct {
+			Name      string `koanf:"name"`
+			Token     string `koanf:"token"`
+			Role      string `koanf:"role"`       // "user" or "admin"
+			RateLimit string `koanf:"rate_limit"` // overrides `server.ratelimits.authenticated`
+		} `koanf:"tokens"`
+
+		// Teams sharing documents, members are names of `auth.tokens`
+		Organizations []struct {
+			Name         string   `koanf:"name"`
+			Members      []string `koanf:"members"`
+			Maintainers  []string `koanf:"maintainers"`   // manage every document of the organization
+			MaxDocuments int      `koanf:"max_documents"` // 0 for no quota
+		} `koanf:"organizations"`
+
+		// Short-lived JWTs clients can exchange their token for, so
+		// replicas can verify them without a shared session store
+		JWT struct {
+			Key        string `koanf:"key"`         // HMAC-SHA256 key, JWTs are disabled if empty
+			TTL        int64  `koanf:"ttl"`         // in seconds, of access tokens
+			RefreshTTL int64  `koanf:"refresh_ttl"` // in seconds, of refresh tokens
+			MaxSession int64  `koanf:"max_session"` // in seconds, refreshing stops this long after exchanging a token
+		} `koanf:"jwt"`
+	} `koanf:"auth"`
+
+	// Feature flags, administrators can override them at runtime. Comments
+	// and public listings are flags too, defaulting to their own options.
+	Features struct {
+		Print bool `koanf:"print"` // /:id/print
+		PDF   bool `koanf:"pdf"`   // /v1/documents/:id/pdf
+		Image bool `koanf:"image"` // /v1/documents/:id/image.png
+	} `koanf:"features"`
+
+	// Threaded comments below documents
+	Comments struct {
+		Enabled   bool `koanf:"enabled"`
+		Anonymous bool `koanf:"anonymous"`  // let clients without a token comment
+		MaxLength int  `koanf:"max_length"` // in bytes
+	} `koanf:"comments"`
+
+	// OAuth app used to export documents to gists
+	GitHub struct {
+		ClientID     string `koanf:"client_id"` // exporting is disabled if empty
+		ClientSecret string `koanf:"client_secret"`
+		OAuthURL     string `koanf:"oauth_url"`
+		APIURL       string `koanf:"api_url"`
+
+		// Encrypts the tokens of linked accounts in the database,
+		// client_secret is used if empty
+		TokenKey string `koanf:"token_key"`
+	} `koanf:"github"`
+
+	// Anonymous clients can be required to solve a challenge before
+	// creating documents
+	Challenge struct {
+		Mode string `koanf:"mode"` // "none", "pow" or "captcha"
+
+		PoW struct {
+			Difficulty int    `koanf:"difficulty"` // leading zero bits
+			Expiry     int    `koanf:"expiry"`     // in milliseconds
+			Secret     string `koanf:"secret"`     // random per process if empty
+		} `koanf:"pow"`
+
+		Captcha struct {
+			VerifyURL string `koanf:"verify_url"`
+			Secret    string `koanf:"secret"`
+		} `koanf:"captcha"`
+	} `koanf:"challenge"`
+
+	// Heuristics run on every new document, actions are one of "flag",
+	// "quarantine" or "reject"
+	Spam struct {
+		Enabled bool `koanf:"enabled"`
+
+		URLDensity struct {
+			MaxPerKB float64 `koanf:"max_per_kb"` // 0 disables the check
+			Action   string  `koanf:"action"`
+		} `koanf:"url_density"`
+
+		Patterns struct {
+			Rules  []string `koanf:"rules"` // regular expressions
+			Action string   `koanf:"action"`
+		} `koanf:"patterns"`
+
+		Velocity struct {
+			Max    int    `koanf:"max"`    // documents per IP within the window, 0 disables the check
+			Window int    `koanf:"window"` // in milliseconds
+			Action string `koanf:"action"`
+		} `koanf:"velocity"`
+	} `koanf:"spam"`
+
+	// Rules blocking or flagging prohibited content, each one has either a
+	// regular expression or a list of words matched case-insensitively
+	Blocklist struct {
+		Rules []struct {
+			Name    string   `koanf:"name"`
+			Pattern string   `koanf:"pattern"`
+			Words   []string `koanf:"words"`
+			Action  string   `koanf:"action"` // "flag", "quarantine" or "reject"
+		} `koanf:"rules"`
+	} `koanf:"blocklist"`
+
+	// Optional virus scanning of new documents
+	Scan struct {
+		Engine  string `koanf:"engine"`   // "", "clamav" or "icap"
+		Address string `koanf:"address"`  // host:port, or a unix socket for clamav
+		Service string `koanf:"service"`  // ICAP service name
+		Timeout int    `koanf:"timeout"`  // in milliseconds
+		Action  string `koanf:"action"`   // "flag", "quarantine" or "reject"
+		OnError string `koanf:"on_error"` // "allow", "flag", "quarantine" or "reject"
+	} `koanf:"scan"`
+
+	// Schedules use cron syntax or `@every <duration>`, an empty schedule
+	// disables the job
+	Jobs struct {
+		Expiry  string `koanf:"expiry"`
+		LockTTL int    `koanf:"lock_ttl"` // in milliseconds, also the longest a job may run
+	} `koanf:"jobs"`
+
+	Metrics struct {
+		Enabled bool   `koanf:"enabled"`
+		Token   string `koanf:"token"` // optional bearer token guarding /metrics
+	} `koanf:"metrics"`
+
+	// Runtime profiling for admin tokens
+	Profiling struct {
+		Enabled bool `koanf:"enabled"` // /debug/pprof and /debug/vars
+	} `koanf:"profiling"`
+
+	Stats struct {
+		Public bool `koanf:"public"` // admin-only if false
+	} `koanf:"stats"`
+
+	Tracing struct {
+		Enabled     bool    `koanf:"enabled"`
+		Endpoint    string  `koanf:"endpoint"` // host:port of an OTLP/HTTP collector
+		Insecure    bool    `koanf:"insecure"`
+		SampleRatio float64 `koanf:"sample_ratio"`
+		ServiceName string  `koanf:"service_name"`
+	} `koanf:"tracing"`
+
+	// Publishing of document lifecycle events to a message broker
+	Broker struct {
+		Driver   string `koanf:"driver"`  // "" or "nats"
+		Address  string `koanf:"address"` // host:port
+		Subject  string `koanf:"subject"` // prefix, events go to "<subject>.document.<event>"
+		Token    string `koanf:"token"`   // or user and password
+		User     string `koanf:"user"`
+		Password string `koanf:"password"`
+		Timeout  int    `koanf:"timeout"` // in milliseconds
+		Buffer   int    `koanf:"buffer"`  // events queued while the broker is slow, more are dropped
+
+		// Publish the IDs of unlisted and private documents too, not just
+		// their hash
+		AllIDs bool `koanf:"all_ids"`
+	} `koanf:"broker"`
+
 	Database struct {
 		Dialect       string `koanf:"dialect"`
 		ConnectionURI string `koanf:"connection_uri"`
+
+		// Migrate outdated schemas on startup, otherwise `spirit migrate`
+		// has to be run first
+		AutoMigrate bool `koanf:"auto_migrate"`
+
+		// Queries fail right away once `threshold` in a row couldn't reach
+		// the database, one is let through every `cooldown` to find out
+		// whether it's back
+		Breaker struct {
+			Threshold int `koanf:"threshold"` // 0 disables the breaker
+			Cooldown  int `koanf:"cooldown"`  // in milliseconds
+			Cache     int `koanf:"cache"`     // in bytes, recently fetched documents served meanwhile
+		} `koanf:"breaker"`
+
+		// Queries failing with transient errors, like serialization
+		// failures or connections dropped during a failover, are tried
+		// again after a random wait of up to `backoff`, doubled each time
+		Retry struct {
+			Attempts   int `koanf:"attempts"`    // including the first, 1 disables retries
+			Backoff    int `koanf:"backoff"`     // in milliseconds
+			MaxBackoff int `koanf:"max_backoff"` // in milliseconds
+		} `koanf:"retry"`
 	} `koanf:"database"`
 }
 
+// current holds the loaded *Schema. Reload swaps in a new one instead of
+// changing it, so it can be read while requests are being served.
+var current atomic.Value
+
+func init() {
+	current.Store(&Schema{})
+}
+
+// Config returns the loaded config object, which must not be modified
+func Config() *Schema {
+	return current.Load().(*Schema)
+}
+
+// Path is the configuration file to load, its format is picked based on the
+// file extension
+var Path = "./config.toml"
+
+// defaults are loaded before any other configuration source
+var defaults = map[string]interface{}{
+	"server.host":                              "0.0.0.0",
+	"server.port":                              9000,
+	"server.compression_level":                 1,
+	"server.compression_min_size":              1_024,
+	"server.compression_types":                 []string{"text/", "application/json", "application/xml", "application/atom+xml", "application/javascript", "image/svg+xml"},
+	"server.prefork":                           false,
+	"server.body_limit":                        1_048_576,
+	"server.shutdown_timeout":                  10_000,
+	"server.public_url":                        "",
+	"server.robots":                            "User-agent: *\nAllow: /v1/documents/*/raw$\nDisallow: /v1/\nDisallow: /embed/\nDisallow: /feed/\n",
+	"server.ratelimits.requests":               200,
+	"server.ratelimits.duration":               300_000,
+	"server.ratelimits.create":                 "",
+	"server.ratelimits.fetch":                  "",
+	"server.ratelimits.authenticated":          "",
+	"server.timeouts.read":                     30_000,
+	"server.timeouts.write":                    30_000,
+	"server.timeouts.idle":                     120_000,
+	"server.timeouts.handler":                  10_000,
+	"server.timeouts.create":                   30_000,
+	"server.timeouts.fetch":                    5_000,
+	"server.cors.allow_origins":                []string{"*"},
+	"server.cors.allow_methods":                []string{"GET", "POST", "HEAD"},
+	"server.cors.allow_headers":                []string{},
+	"server.cors.expose_headers":               []string{"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"},
+	"server.cors.allow_credentials":            false,
+	"server.cors.max_age":                      0,
+	"server.headers.content_security_policy":   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none';",
+	"server.headers.strict_transport_security": "max-age=31536000; includeSubDomains; preload",
+	"server.headers.referrer_policy":           "no-referrer-when-downgrade",
+	"server.headers.frame_options":             "SAMEORIGIN",
+	"server.headers.content_type_options":      "nosniff",
+	"server.tcp.enabled":                       false,
+	"server.tcp.port":                          9999,
+	"server.tcp.timeout":                       2_000,
+	"server.tcp.max_duration":                  30_000,
+	"server.tcp.max_connections":               100,
+	"server.tls.enabled":                       false,
+	"server.tls.port":                          443,
+	"server.tls.cache_dir":                     "./certs",
+	"server.tls.email":                         "",
+	"server.tls.client_auth.ca_file":           "",
+	"server.tls.client_auth.admin":             false,
+	"server.tls.client_auth.metrics":           false,
+	"server.maintenance.enabled":               false,
+	"server.maintenance.message":               "Spacebin is down for maintenance, please try again in a few minutes.",
+	"server.proxy.trusted":                     []string{},
+	"server.proxy.header":                      "X-Forwarded-For",
+	"server.ip_filter.allow":                   []string{},
+	"server.ip_filter.deny":                    []string{},
+	"server.ip_filter.create_allow":            []string{},
+	"documents.id_format":                      "random",
+	"documents.id_alphabet":                    "letters",
+	"documents.id_retries":                     3,
+	"documents.id_length":                      8,
+	"documents.accepted_id_lengths":            []int{},
+	"documents.reserved_ids":                   []string{"admin", "api", "raw", "static", "login", "logout", "embed", "feed", "sitemap", "health", "metrics", "public", "trending"},
+	"documents.max_document_length":            400_000,
+	"documents.max_age":                        2592000,
+	"documents.trash_period":                   604_800,
+	"documents.authenticated_max_length":       0,
+	"documents.admin_max_length":               0,
+	"documents.max_lines":                      0,
+	"documents.max_line_length":                0,
+	"documents.oversized":                      "raw",
+	"documents.hastebin_compat":                false,
+	"documents.pastebin_compat":                false,
+	"documents.public_listing":                 false,
+	"documents.shortener":                      false,
+	"documents.max_tags":                       10,
+	"documents.signing_key":                    "",
+	"documents.allow_binary":                   false,
+	"documents.ansi_for_terminals":             false,
+	"documents.idempotency_window":             86_400,
+	"documents.normalize.line_endings":         false,
+	"documents.normalize.expand_tabs":          0,
+	"documents.normalize.trailing_whitespace":  false,
+	"documents.normalize.trailing_blank_lines": false,
+	"auth.erase_documents":                     true,
+	"auth.jwt.key":                             "",
+	"auth.jwt.ttl":                             900,
+	"auth.jwt.refresh_ttl":                     604_800,
+	"auth.jwt.max_session":                     2_592_000,
+	"features.print":                           true,
+	"features.pdf":                             true,
+	"features.image":                           true,
+	"comments.enabled":                         false,
+	"comments.anonymous":                       false,
+	"comments.max_length":                      10_000,
+	"github.client_id":                         "",
+	"github.client_secret":                     "",
+	"github.oauth_url":                         "https://github.com",
+	"github.api_url":                           "https://api.github.com",
+	"github.token_key":                         "",
+	"challenge.mode":                           "none",
+	"challenge.pow.difficulty":                 20,
+	"challenge.pow.expiry":                     300_000,
+	"challenge.pow.secret":                     "",
+	"challenge.captcha.verify_url":             "https://hcaptcha.com/siteverify",
+	"challenge.captcha.secret":                 "",
+	"spam.enabled":                             false,
+	"spam.url_density.max_per_kb":              0,
+	"spam.url_density.action":                  "quarantine",
+	"spam.patterns.rules":                      []string{},
+	"spam.patterns.action":                     "reject",
+	"spam.velocity.max":                        0,
+	"spam.velocity.window":                     3_600_000,
+	"spam.velocity.action":                     "reject",
+	"scan.engine":                              "",
+	"scan.address":                             "localhost:3310",
+	"scan.service":                             "avscan",
+	"scan.timeout":                             5_000,
+	"scan.action":                              "reject",
+	"scan.on_error":                            "allow",
+	"jobs.expiry":                              "@every 3h",
+	"jobs.lock_ttl":                            600_000,
+	"metrics.enabled":                          false,
+	"metrics.token":                            "",
+	"profiling.enabled":                        false,
+	"stats.public":                             false,
+	"tracing.enabled":                          false,
+	"tracing.endpoint":                         "localhost:4318",
+	"tracing.insecure":                         true,
+	"tracing.sample_ratio":                     1.0,
+	"tracing.service_name":                     "spirit",
+	"database.auto_migrate":                    true,
+	"database.breaker.threshold":               5,
+	"database.breaker.cooldown":                10_000,
+	"database.breaker.cache":                   33_554_432,
+	"database.retry.attempts":                  3,
+	"database.retry.backoff":                   50,
+	"database.retry.max_backoff":               1_000,
+	"broker.driver":                            "",
+	"broker.address":                           "localhost:4222",
+	"broker.subject":                           "spacebin",
+	"broker.token":                             "",
+	"broker.user":                              "",
+	"broker.password":                          "",
+	"broker.timeout":                           5_000,
+	"broker.buffer":                            1_024,
+	"broker.all_ids":                           false,
+}
+
 // Load configuration from file
 func Load() error {
+	loaded := Schema{}
+
+	if err := read(k, &loaded); err != nil {
+		return err
+	}
+
+	current.Store(&loaded)
+
+	return nil
+}
+
+// read loads the defaults, the configuration file and environment variables
+// into `k` and un-marshals the result into `out`
+func read(k *koanf.Koanf, out *Schema) error {
 	// Set some default values
-	k.Load(confmap.Provider(map[string]interface{}{
-		"server.host":                   "0.0.0.0",
-		"server.port":                   9000,
-		"server.compression_level":      -1,
-		"server.prefork":                false,
-		"server.ratelimits.requests":    200,
-		"server.ratelimits.duration":    300_000,
-		"documents.id_length":           8,
-		"documents.max_document_length": 400_000,
-		"documents.max_age":             2592000,
-	}, "."), nil)
-
-	// Load configuration from TOML on top of default values
-	if err := k.Load(file.Provider("./config.toml"), toml.Parser()); err != nil {
-		log.Fatalf("Error when loading config from file (toml): %v", err)
+	k.Load(confmap.Provider(defaults, "."), nil)
+
+	parser, err := parserFor(Path)
+
+	if err != nil {
+		return err
 	}
 
-	// Load environment variables on top of TOML and default values
-	err := k.Load(env.Provider("SPACEBIN_", ".", func(s string) string {
+	// Load the configuration file on top of default values
+	fileConfig := koanf.New(".")
+
+	if err := fileConfig.Load(file.Provider(Path), parser); err != nil {
+		return fmt.Errorf("error when loading config from %s: %w", Path, err)
+	}
+
+	// Look for unknown options in the file before it's merged, so typos
+	// aren't silently ignored
+	problems := unknownKeys(fileConfig)
+
+	k.Merge(fileConfig)
+
+	// Load environment variables on top of the file and default values
+	err = k.Load(env.Provider("SPACEBIN_", ".", func(s string) string {
 		// Strip the `SPACEBIN_` prefix and replace any `_` with `.` so hierarchy is correctly represented.
 		return strings.Replace(strings.ToLower(strings.TrimPrefix(s, "SPACEBIN_")), "_", ".", -1)
 	}), nil)
 
 	if err != nil {
-		log.Fatalf("Error when loading config from environment: %v", err)
+		return fmt.Errorf("error when loading config from environment: %w", err)
 	}
 
-	err = k.Unmarshal("", &Config)
+	// Fetch secrets from wherever options point to
+	problems = append(problems, resolveSecrets(k)...)
 
-	if err != nil {
-		log.Fatalf("Error when un-marshaling config to struct: %v", err)
+	if err := k.Unmarshal("", out); err != nil {
+		var decodeErr *mapstructure.Error
+
+		if !errors.As(err, &decodeErr) {
+			return fmt.Errorf("error when un-marshaling config to struct: %w", err)
+		}
+
+		problems = append(problems, decodeErr.Errors...)
+	}
+
+	problems = append(problems, out.validate()...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Path: Path, Problems: problems}
 	}
 
 	return nil
 }
+
+// parserFor picks a parser based on the extension of `path`
+func parserFor(path string) (koanf.Parser, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return toml.Parser(), nil
+	case ".yaml", ".yml":
+		return yaml.Parser(), nil
+	case ".json":
+		return json.Parser(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported config file format %q, use .toml, .yaml or .json", filepath.Ext(path))
+}
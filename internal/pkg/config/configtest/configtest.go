@@ -0,0 +1,67 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package configtest loads configurations written inline by tests.
+package configtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Load writes `toml` to a temporary file and loads it as the configuration,
+// on top of the defaults. The database is a sqlite file next to it, so
+// `toml` mustn't have a [database] table, only the ones below it.
+func Load(t testing.TB, toml string) {
+	t.Helper()
+
+	config.Path = filepath.Join(t.TempDir(), "config.toml")
+
+	if err := write(toml); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reload replaces the file written by Load with `toml` and reloads it, like
+// the server does on SIGHUP
+func Reload(t testing.TB, toml string) {
+	t.Helper()
+
+	if err := write(toml); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Reload(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// write puts `toml` into the file at config.Path, after the database
+// settings
+func write(toml string) error {
+	db := filepath.Join(filepath.Dir(config.Path), "spacebin.db")
+	database := fmt.Sprintf("[database]\ndialect = \"sqlite\"\nconnection_uri = %q\n", db)
+
+	return os.WriteFile(config.Path, []byte(database+toml), 0o600)
+}
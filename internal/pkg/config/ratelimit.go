@@ -0,0 +1,69 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// units maps the shorthand used in rate limit rules to a duration
+var units = map[string]time.Duration{
+	"s":      time.Second,
+	"sec":    time.Second,
+	"second": time.Second,
+	"m":      time.Minute,
+	"min":    time.Minute,
+	"minute": time.Minute,
+	"h":      time.Hour,
+	"hr":     time.Hour,
+	"hour":   time.Hour,
+	"d":      24 * time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// ParseRateLimit reads a rule in the form of `<requests>/<window>`, e.g. "10/min" or
+// "200/30s", and returns the number of requests allowed within the window
+func ParseRateLimit(rule string) (int, time.Duration, error) {
+	parts := strings.SplitN(rule, "/", 2)
+
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("rate limit %q must be in the form <requests>/<window>", rule)
+	}
+
+	max, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+
+	if err != nil || max < 1 {
+		return 0, 0, fmt.Errorf("rate limit %q has an invalid number of requests", rule)
+	}
+
+	window := strings.TrimSpace(parts[1])
+
+	if d, ok := units[window]; ok {
+		return max, d, nil
+	}
+
+	d, err := time.ParseDuration(window)
+
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("rate limit %q has an invalid window", rule)
+	}
+
+	return max, d, nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/koanf"
+)
+
+var (
+	reloadMu    sync.Mutex
+	reloadHooks []func() error
+
+	// retired holds the keys reloads replaced, by option
+	retired = map[string]RetiredKey{}
+)
+
+// RetiredKey is a key a reload replaced, which still verifies what it
+// signed for a while so rotating it doesn't break everything at once
+type RetiredKey struct {
+	Key       string
+	RetiredAt time.Time
+}
+
+// Retired returns the key `option`, e.g. "auth.jwt.key", held before the
+// last reload rotated it. Retired keys are only remembered in memory, a
+// restart forgets them.
+func Retired(option string) (RetiredKey, bool) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	key, ok := retired[option]
+
+	return key, ok
+}
+
+// OnReload registers `fn` to be called after the configuration is reloaded,
+// so components built from the config at startup can rebuild themselves
+func OnReload(fn func() error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// Reload reads every configuration source again and applies the settings
+// that are safe to change while the server is running. Everything else,
+// such as the listen address or database, still requires a restart.
+//
+// The file at Path is read again, so edits to it are picked up, but the
+// path itself can't be changed.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	loaded := Schema{}
+
+	if err := read(koanf.New("."), &loaded); err != nil {
+		return err
+	}
+
+	previous := Config()
+	next := *previous
+
+	next.Server.Ratelimits = loaded.Server.Ratelimits
+	next.Server.Maintenance = loaded.Server.Maintenance
+	next.Server.Proxy = loaded.Server.Proxy
+	next.Server.Timeouts.Handler = loaded.Server.Timeouts.Handler
+	next.Server.Timeouts.Create = loaded.Server.Timeouts.Create
+	next.Server.Timeouts.Fetch = loaded.Server.Timeouts.Fetch
+	next.Documents.MaxDocumentLength = loaded.Documents.MaxDocumentLength
+	next.Documents.AuthenticatedMaxLength = loaded.Documents.AuthenticatedMaxLength
+	next.Documents.AdminMaxLength = loaded.Documents.AdminMaxLength
+	next.Documents.MaxAge = loaded.Documents.MaxAge
+	next.Retention = loaded.Retention
+
+	// Tokens can be added, revoked or given other limits without a restart.
+	// Organizations refer to tokens, so they're reloaded along with them.
+	next.Auth.Tokens = loaded.Auth.Tokens
+	next.Auth.Organizations = loaded.Auth.Organizations
+
+	// Keys fetched from a secret manager may have been rotated. Enabling or
+	// disabling signing still requires a restart.
+	if (loaded.Documents.SigningKey == "") == (previous.Documents.SigningKey == "") {
+		next.Documents.SigningKey = loaded.Documents.SigningKey
+	}
+
+	if (loaded.Auth.JWT.Key == "") == (previous.Auth.JWT.Key == "") {
+		next.Auth.JWT = loaded.Auth.JWT
+	}
+
+	current.Store(&next)
+
+	for _, hook := range reloadHooks {
+		if err := hook(); err != nil {
+			// Roll back so the running server keeps a consistent config
+			current.Store(previous)
+
+			var failed []string
+
+			for _, hook := range reloadHooks {
+				if err := hook(); err != nil {
+					failed = append(failed, err.Error())
+				}
+			}
+
+			if len(failed) > 0 {
+				return fmt.Errorf("%w, rolling back failed too: %s", err, strings.Join(failed, "; "))
+			}
+
+			return err
+		}
+	}
+
+	retire("documents.signing_key", previous.Documents.SigningKey, next.Documents.SigningKey)
+	retire("auth.jwt.key", previous.Auth.JWT.Key, next.Auth.JWT.Key)
+
+	return nil
+}
+
+// retire remembers `old` as the retired key of `option` if it was rotated
+// to `key`
+func retire(option, old, key string) {
+	if old != "" && old != key {
+		retired[option] = RetiredKey{Key: old, RetiredAt: time.Now()}
+	}
+}
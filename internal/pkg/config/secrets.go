@@ -0,0 +1,305 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+)
+
+// Prefixes of options pointing to a secret in a secret manager, which is
+// fetched when the config is read. A `#<key>` suffix picks a key out of
+// secrets holding JSON objects, it's required for Vault.
+const (
+	vaultScheme = "vault://"  // vault://<path>#<key>, e.g. vault://secret/data/spacebin#db
+	awsScheme   = "aws-sm://" // aws-sm://<secret ID or ARN>
+	gcpScheme   = "gcp-sm://" // gcp-sm://projects/<project>/secrets/<secret>[/versions/<version>]
+)
+
+// secretsClient fetches secrets, so a stuck secret manager can't hang the
+// server on startup
+var secretsClient = &http.Client{Timeout: 10 * time.Second}
+
+// resolveSecrets replaces every option in `k` that points to a secret by
+// the secret's value, including options inside arrays such as
+// auth.tokens[].token. Credentials of the secret managers come from their
+// usual environment variables.
+func resolveSecrets(k *koanf.Koanf) []string {
+	var problems []string
+	resolved := map[string]interface{}{}
+
+	for key, value := range k.All() {
+		if value, changed := resolveValue(key, value, &problems); changed {
+			resolved[key] = value
+		}
+	}
+
+	sort.Strings(problems)
+
+	if len(resolved) > 0 {
+		k.Load(confmap.Provider(resolved, "."), nil)
+	}
+
+	return problems
+}
+
+// resolveValue returns `value` with every secret reference in it replaced,
+// walking into arrays and tables. Arrays and tables are copied rather than
+// changed in place, since they are shared with koanf.
+func resolveValue(key string, value interface{}, problems *[]string) (interface{}, bool) {
+	switch value := value.(type) {
+	case string:
+		if !isSecret(value) {
+			return value, false
+		}
+
+		secret, err := fetchSecret(value)
+
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: couldn't fetch secret: %v", key, err))
+			return value, false
+		}
+
+		return secret, true
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		changed := false
+
+		for i, item := range value {
+			var ok bool
+
+			copied[i], ok = resolveValue(fmt.Sprintf("%s[%d]", key, i), item, problems)
+			changed = changed || ok
+		}
+
+		return copied, changed
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		changed := false
+
+		for name, item := range value {
+			var ok bool
+
+			copied[name], ok = resolveValue(key+"."+name, item, problems)
+			changed = changed || ok
+		}
+
+		return copied, changed
+	}
+
+	return value, false
+}
+
+func isSecret(value string) bool {
+	return strings.HasPrefix(value, vaultScheme) || strings.HasPrefix(value, awsScheme) ||
+		strings.HasPrefix(value, gcpScheme)
+}
+
+func fetchSecret(ref string) (string, error) {
+	ref, key := splitKey(ref)
+
+	switch {
+	case strings.HasPrefix(ref, vaultScheme):
+		return vaultSecret(strings.TrimPrefix(ref, vaultScheme), key)
+	case strings.HasPrefix(ref, awsScheme):
+		secret, err := awsSecret(strings.TrimPrefix(ref, awsScheme))
+
+		if err != nil {
+			return "", err
+		}
+
+		return pick(secret, key)
+	default:
+		secret, err := gcpSecret(strings.TrimPrefix(ref, gcpScheme))
+
+		if err != nil {
+			return "", err
+		}
+
+		return pick(secret, key)
+	}
+}
+
+// splitKey separates the `#<key>` suffix from a reference
+func splitKey(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+
+	return ref, ""
+}
+
+// pick returns `key` of the JSON object in `secret`, or all of `secret`
+// when `key` is empty
+func pick(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+
+	fields := map[string]interface{}{}
+
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret isn't a JSON object, can't read %q from it", key)
+	}
+
+	return field(fields, key)
+}
+
+func field(fields map[string]interface{}, key string) (string, error) {
+	value, ok := fields[key].(string)
+
+	if !ok {
+		return "", fmt.Errorf("secret has no string %q", key)
+	}
+
+	return value, nil
+}
+
+// getJSON sends `req` and decodes the JSON response into `out`
+func getJSON(req *http.Request, out interface{}) error {
+	res, err := secretsClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+		return fmt.Errorf("%s responded with %s: %s", req.URL.Host, res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// vaultSecret reads `key` of the secret at `path` with Vault's HTTP API,
+// using VAULT_ADDR, VAULT_TOKEN and optionally VAULT_NAMESPACE. KV version
+// 1 and 2 secrets are both understood.
+func vaultSecret(path, key string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+
+	if addr == "" || os.Getenv("VAULT_TOKEN") == "" {
+		return "", errors.New("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+
+	if key == "" {
+		return "", errors.New("vault references need a #<key>")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	var res struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := getJSON(req, &res); err != nil {
+		return "", err
+	}
+
+	// KV version 2 nests the secret in another `data`
+	if nested, ok := res.Data["data"].(map[string]interface{}); ok {
+		if _, v1 := res.Data[key]; !v1 {
+			return field(nested, key)
+		}
+	}
+
+	return field(res.Data, key)
+}
+
+// gcpSecret reads the secret version `name` from GCP Secret Manager, the
+// latest version if none is given. The access token is taken from
+// GOOGLE_OAUTH_ACCESS_TOKEN, or else from the metadata server.
+func gcpSecret(name string) (string, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	token, err := gcpToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET", "https://secretmanager.googleapis.com/v1/"+name+":access", nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var res struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+
+	if err := getJSON(req, &res); err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(res.Payload.Data)
+
+	return string(data), err
+}
+
+func gcpToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	req, err := http.NewRequest("GET", "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := getJSON(req, &res); err != nil {
+		return "", fmt.Errorf("no GOOGLE_OAUTH_ACCESS_TOKEN and the metadata server can't be reached: %w", err)
+	}
+
+	return res.AccessToken, nil
+}
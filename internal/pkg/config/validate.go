@@ -0,0 +1,459 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/knadh/koanf"
+	"github.com/robfig/cron/v3"
+)
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "invalid configuration (%s):", e.Path)
+
+	for _, problem := range e.Problems {
+		fmt.Fprintf(&b, "\n  * %s", problem)
+	}
+
+	return b.String()
+}
+
+// unknownKeys reports every option in `k` that doesn't exist in the schema
+func unknownKeys(k *koanf.Koanf) []string {
+	known := map[string]bool{}
+	collectKeys(reflect.TypeOf(Schema{}), "", known)
+
+	var problems []string
+
+	for _, key := range k.Keys() {
+		if !known[key] {
+			problems = append(problems, fmt.Sprintf("%s: unknown option", key))
+		}
+	}
+
+	return problems
+}
+
+// collectKeys adds the key path of every leaf field in `t` to `keys`
+func collectKeys(t reflect.Type, prefix string, keys map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("koanf")
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			collectKeys(field.Type, name, keys)
+			continue
+		}
+
+		keys[name] = true
+	}
+}
+
+// validate checks that every value is within its allowed range
+func (s *Schema) validate() []string {
+	var problems []string
+
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(s.Server.Port > 0 && s.Server.Port <= 65535,
+		"server.port", "must be between 1 and 65535, got %d", s.Server.Port)
+	check(s.Server.CompresssionLevel >= -1 && s.Server.CompresssionLevel <= 2,
+		"server.compression_level", "must be between -1 and 2, got %d", s.Server.CompresssionLevel)
+	check(s.Server.CompressionMinSize >= 0,
+		"server.compression_min_size", "can't be negative, got %d", s.Server.CompressionMinSize)
+	check(s.Server.BodyLimit > 0,
+		"server.body_limit", "must be positive, got %d", s.Server.BodyLimit)
+	if s.Server.PublicURL != "" {
+		u, err := url.Parse(s.Server.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"server.public_url", "must be an absolute http or https URL, got %q", s.Server.PublicURL)
+	}
+
+	check(s.Server.ShutdownTimeout >= 0,
+		"server.shutdown_timeout", "can't be negative, got %d", s.Server.ShutdownTimeout)
+
+	timeouts := []struct {
+		key   string
+		value int
+	}{
+		{"server.timeouts.read", s.Server.Timeouts.Read},
+		{"server.timeouts.write", s.Server.Timeouts.Write},
+		{"server.timeouts.idle", s.Server.Timeouts.Idle},
+		{"server.timeouts.handler", s.Server.Timeouts.Handler},
+		{"server.timeouts.create", s.Server.Timeouts.Create},
+		{"server.timeouts.fetch", s.Server.Timeouts.Fetch},
+	}
+
+	for _, t := range timeouts {
+		check(t.value >= 0, t.key, "can't be negative, got %d", t.value)
+	}
+
+	check(s.Server.Ratelimits.Requests > 0,
+		"server.ratelimits.requests", "must be positive, got %d", s.Server.Ratelimits.Requests)
+	check(s.Server.Ratelimits.Duration > 0,
+		"server.ratelimits.duration", "must be positive, got %d", s.Server.Ratelimits.Duration)
+
+	rules := []struct {
+		key  string
+		rule string
+	}{
+		{"server.ratelimits.create", s.Server.Ratelimits.Create},
+		{"server.ratelimits.fetch", s.Server.Ratelimits.Fetch},
+		{"server.ratelimits.authenticated", s.Server.Ratelimits.Authenticated},
+	}
+
+	for _, r := range rules {
+		if r.rule != "" {
+			_, _, err := ParseRateLimit(r.rule)
+			check(err == nil, r.key, "%v", err)
+		}
+	}
+
+	// fiber would fall back to allowing every origin
+	check(len(s.Server.CORS.AllowOrigins) > 0,
+		"server.cors.allow_origins", "at least one origin is required")
+	check(s.Server.CORS.MaxAge >= 0,
+		"server.cors.max_age", "can't be negative, got %d", s.Server.CORS.MaxAge)
+
+	// Browsers refuse credentialed requests to a wildcard origin
+	for _, origin := range s.Server.CORS.AllowOrigins {
+		check(!s.Server.CORS.AllowCredentials || origin != "*",
+			"server.cors.allow_origins", "can't contain \"*\" when allow_credentials is enabled")
+	}
+
+	networks := []struct {
+		key  string
+		list []string
+	}{
+		{"server.proxy.trusted", s.Server.Proxy.Trusted},
+		{"server.ip_filter.allow", s.Server.IPFilter.Allow},
+		{"server.ip_filter.deny", s.Server.IPFilter.Deny},
+		{"server.ip_filter.create_allow", s.Server.IPFilter.CreateAllow},
+	}
+
+	for _, n := range networks {
+		for _, entry := range n.list {
+			check(validNetwork(entry), n.key, "%q isn't a valid CIDR or address", entry)
+		}
+	}
+
+	if s.Server.TCP.Enabled {
+		check(s.Server.TCP.Port > 0 && s.Server.TCP.Port <= 65535,
+			"server.tcp.port", "must be between 1 and 65535, got %d", s.Server.TCP.Port)
+		check(s.Server.TCP.Timeout > 0,
+			"server.tcp.timeout", "must be positive, got %d", s.Server.TCP.Timeout)
+		check(s.Server.TCP.MaxDuration >= s.Server.TCP.Timeout,
+			"server.tcp.max_duration", "can't be shorter than server.tcp.timeout, got %d", s.Server.TCP.MaxDuration)
+		check(s.Server.TCP.MaxConnections > 0,
+			"server.tcp.max_connections", "must be positive, got %d", s.Server.TCP.MaxConnections)
+		check(s.Server.TCP.Port != s.Server.Port,
+			"server.tcp.port", "can't be the same as server.port")
+		check(s.Server.PublicURL != "",
+			"server.public_url", "is required when the TCP listener is enabled")
+		// TCP clients have no way to answer a challenge
+		check(s.Challenge.Mode == "none",
+			"server.tcp.enabled", "can't be used with challenge.mode %q", s.Challenge.Mode)
+	}
+
+	check(!s.Server.TLS.Enabled || (s.Server.TLS.Port > 0 && s.Server.TLS.Port <= 65535),
+		"server.tls.port", "must be between 1 and 65535, got %d", s.Server.TLS.Port)
+	check(!s.Server.TLS.Enabled || s.Server.TLS.Port != s.Server.Port,
+		"server.tls.port", "can't be the same as server.port, which redirects to HTTPS")
+	check(!s.Server.TLS.Enabled || len(s.Server.TLS.Domains) > 0,
+		"server.tls.domains", "at least one domain is required when TLS is enabled")
+	check(!s.Server.TLS.Enabled || s.Server.TLS.CacheDir != "",
+		"server.tls.cache_dir", "is required when TLS is enabled")
+
+	clientAuth := s.Server.TLS.ClientAuth
+	check(clientAuth.CAFile == "" || s.Server.TLS.Enabled,
+		"server.tls.client_auth.ca_file", "requires server.tls.enabled")
+	check(!(clientAuth.Admin || clientAuth.Metrics) || clientAuth.CAFile != "",
+		"server.tls.client_auth.ca_file", "is required to ask for client certificates")
+
+	check(s.Documents.IDFormat == "random" || s.Documents.IDFormat == "words" ||
+		s.Documents.IDFormat == "uuid" || s.Documents.IDFormat == "nanoid",
+		"documents.id_format", "must be random, words, uuid or nanoid, got %q", s.Documents.IDFormat)
+	check(s.Documents.IDAlphabet == "letters" || s.Documents.IDAlphabet == "lowercase" ||
+		s.Documents.IDAlphabet == "hex" || s.Documents.IDAlphabet == "base58",
+		"documents.id_alphabet", "must be letters, lowercase, hex or base58, got %q", s.Documents.IDAlphabet)
+	check(s.Documents.IDRetries >= 0,
+		"documents.id_retries", "can't be negative, got %d", s.Documents.IDRetries)
+	check(s.Documents.IDLength > 0 && s.Documents.IDLength <= 255,
+		"documents.id_length", "must be between 1 and 255, got %d", s.Documents.IDLength)
+
+	for _, length := range s.Documents.AcceptedIDLengths {
+		check(length > 0 && length <= 255,
+			"documents.accepted_id_lengths", "must be between 1 and 255, got %d", length)
+	}
+	check(s.Documents.MaxDocumentLength >= 2,
+		"documents.max_document_length", "must be at least 2, got %d", s.Documents.MaxDocumentLength)
+	check(s.Documents.AuthenticatedMaxLength >= 0,
+		"documents.authenticated_max_length", "can't be negative, got %d", s.Documents.AuthenticatedMaxLength)
+	check(s.Documents.AdminMaxLength >= 0,
+		"documents.admin_max_length", "can't be negative, got %d", s.Documents.AdminMaxLength)
+	check(s.Documents.MaxLines >= 0,
+		"documents.max_lines", "can't be negative, got %d", s.Documents.MaxLines)
+	check(s.Documents.MaxLineLength >= 0,
+		"documents.max_line_length", "can't be negative, got %d", s.Documents.MaxLineLength)
+	check(s.Documents.Oversized == "reject" || s.Documents.Oversized == "raw",
+		"documents.oversized", "must be reject or raw, got %q", s.Documents.Oversized)
+	check(s.Documents.MaxAge > 0,
+		"documents.max_age", "must be positive, got %d", s.Documents.MaxAge)
+	check(s.Documents.SigningKey == "" || len(s.Documents.SigningKey) >= 32,
+		"documents.signing_key", "must be at least 32 characters long")
+	check(s.Documents.Normalize.ExpandTabs >= 0 && s.Documents.Normalize.ExpandTabs <= 16,
+		"documents.normalize.expand_tabs", "must be between 0 and 16, got %d", s.Documents.Normalize.ExpandTabs)
+	check(s.Documents.IdempotencyWindow >= 0,
+		"documents.idempotency_window", "can't be negative, got %d", s.Documents.IdempotencyWindow)
+	check(s.Documents.MaxTags >= 0,
+		"documents.max_tags", "can't be negative, got %d", s.Documents.MaxTags)
+	check(s.Documents.TrashPeriod >= 0,
+		"documents.trash_period", "can't be negative, got %d", s.Documents.TrashPeriod)
+
+	for i, rule := range s.Retention.Rules {
+		key := fmt.Sprintf("retention.rules[%d]", i)
+
+		switch rule.Creator {
+		case "", "anonymous", "authenticated":
+		default:
+			check(false, key, "creator must be empty, anonymous or authenticated, got %q", rule.Creator)
+		}
+
+		check(rule.MinSize >= 0, key, "min_size can't be negative, got %d", rule.MinSize)
+		check(rule.MaxAge >= 0, key, "max_age can't be negative, got %d", rule.MaxAge)
+	}
+
+	names := map[string]bool{}
+
+	for _, t := range s.Auth.Tokens {
+		check(t.Name != "", "auth.tokens.name", "is required")
+		check(!names[t.Name], "auth.tokens.name", "%q is used more than once", t.Name)
+		check(t.Token != "", "auth.tokens.token", "is required for %q", t.Name)
+		check(t.Role == "user" || t.Role == "admin",
+			"auth.tokens.role", "must be user or admin for %q, got %q", t.Name, t.Role)
+
+		if t.RateLimit != "" {
+			_, _, err := ParseRateLimit(t.RateLimit)
+			check(err == nil, "auth.tokens.rate_limit", "%v for %q", err, t.Name)
+		}
+
+		names[t.Name] = true
+	}
+
+	organizations := map[string]bool{}
+
+	for _, o := range s.Auth.Organizations {
+		check(o.Name != "", "auth.organizations.name", "is required")
+		check(!organizations[o.Name], "auth.organizations.name", "%q is used more than once", o.Name)
+		check(o.MaxDocuments >= 0,
+			"auth.organizations.max_documents", "can't be negative for %q, got %d", o.Name, o.MaxDocuments)
+
+		for _, member := range append(o.Members, o.Maintainers...) {
+			check(names[member], "auth.organizations.members", "%q of %q isn't one of the auth.tokens", member, o.Name)
+		}
+
+		organizations[o.Name] = true
+	}
+
+	if s.Auth.JWT.Key != "" {
+		check(len(s.Auth.JWT.Key) >= 32, "auth.jwt.key", "must be at least 32 characters long")
+		check(s.Auth.JWT.TTL > 0, "auth.jwt.ttl", "must be positive, got %d", s.Auth.JWT.TTL)
+		check(s.Auth.JWT.RefreshTTL >= s.Auth.JWT.TTL,
+			"auth.jwt.refresh_ttl", "can't be shorter than auth.jwt.ttl, got %d", s.Auth.JWT.RefreshTTL)
+		check(s.Auth.JWT.MaxSession >= s.Auth.JWT.TTL,
+			"auth.jwt.max_session", "can't be shorter than auth.jwt.ttl, got %d", s.Auth.JWT.MaxSession)
+	}
+
+	check(s.Comments.MaxLength > 0,
+		"comments.max_length", "must be positive, got %d", s.Comments.MaxLength)
+
+	check(s.GitHub.ClientID == "" || s.GitHub.ClientSecret != "",
+		"github.client_secret", "is required when client_id is set")
+
+	switch s.Challenge.Mode {
+	case "none":
+	case "pow":
+		check(s.Challenge.PoW.Difficulty > 0 && s.Challenge.PoW.Difficulty <= 64,
+			"challenge.pow.difficulty", "must be between 1 and 64, got %d", s.Challenge.PoW.Difficulty)
+		check(s.Challenge.PoW.Expiry > 0,
+			"challenge.pow.expiry", "must be positive, got %d", s.Challenge.PoW.Expiry)
+	case "captcha":
+		check(s.Challenge.Captcha.VerifyURL != "", "challenge.captcha.verify_url", "is required")
+		check(s.Challenge.Captcha.Secret != "", "challenge.captcha.secret", "is required")
+	default:
+		check(false, "challenge.mode", "must be one of none, pow or captcha, got %q", s.Challenge.Mode)
+	}
+
+	actions := []struct {
+		key, value string
+	}{
+		{"spam.url_density.action", s.Spam.URLDensity.Action},
+		{"spam.patterns.action", s.Spam.Patterns.Action},
+		{"spam.velocity.action", s.Spam.Velocity.Action},
+	}
+
+	for _, a := range actions {
+		switch a.value {
+		case "flag", "quarantine", "reject":
+		default:
+			check(false, a.key, "must be one of flag, quarantine or reject, got %q", a.value)
+		}
+	}
+
+	for _, rule := range s.Spam.Patterns.Rules {
+		_, err := regexp.Compile(rule)
+		check(err == nil, "spam.patterns.rules", "%q isn't a valid regular expression", rule)
+	}
+
+	for i, rule := range s.Blocklist.Rules {
+		key := fmt.Sprintf("blocklist.rules[%d]", i)
+
+		check((rule.Pattern == "") != (len(rule.Words) == 0),
+			key, "needs either a pattern or words, but not both")
+
+		if rule.Pattern != "" {
+			_, err := regexp.Compile(rule.Pattern)
+			check(err == nil, key, "%q isn't a valid regular expression", rule.Pattern)
+		}
+
+		switch rule.Action {
+		case "flag", "quarantine", "reject":
+		default:
+			check(false, key, "action must be one of flag, quarantine or reject, got %q", rule.Action)
+		}
+	}
+
+	switch s.Scan.Engine {
+	case "":
+	case "clamav", "icap":
+		check(s.Scan.Address != "", "scan.address", "is required")
+		check(s.Scan.Timeout > 0, "scan.timeout", "must be positive, got %d", s.Scan.Timeout)
+
+		switch s.Scan.Action {
+		case "flag", "quarantine", "reject":
+		default:
+			check(false, "scan.action", "must be one of flag, quarantine or reject, got %q", s.Scan.Action)
+		}
+
+		switch s.Scan.OnError {
+		case "allow", "flag", "quarantine", "reject":
+		default:
+			check(false, "scan.on_error", "must be one of allow, flag, quarantine or reject, got %q", s.Scan.OnError)
+		}
+	default:
+		check(false, "scan.engine", "must be empty, clamav or icap, got %q", s.Scan.Engine)
+	}
+
+	switch s.Broker.Driver {
+	case "":
+	case "nats":
+		check(s.Broker.Address != "", "broker.address", "is required")
+		check(s.Broker.Subject != "", "broker.subject", "is required")
+		check(s.Broker.Timeout > 0, "broker.timeout", "must be positive, got %d", s.Broker.Timeout)
+		check(s.Broker.Buffer > 0, "broker.buffer", "must be positive, got %d", s.Broker.Buffer)
+	default:
+		check(false, "broker.driver", "must be empty or nats, got %q", s.Broker.Driver)
+	}
+
+	check(s.Spam.Velocity.Max == 0 || s.Spam.Velocity.Window > 0,
+		"spam.velocity.window", "must be positive, got %d", s.Spam.Velocity.Window)
+
+	if s.Jobs.Expiry != "" {
+		_, err := cron.ParseStandard(s.Jobs.Expiry)
+		check(err == nil, "jobs.expiry", "%q isn't a valid schedule", s.Jobs.Expiry)
+	}
+
+	check(s.Jobs.LockTTL > 0,
+		"jobs.lock_ttl", "must be positive, got %d", s.Jobs.LockTTL)
+
+	check(s.Tracing.SampleRatio >= 0 && s.Tracing.SampleRatio <= 1,
+		"tracing.sample_ratio", "must be between 0 and 1, got %v", s.Tracing.SampleRatio)
+	check(!s.Tracing.Enabled || s.Tracing.Endpoint != "",
+		"tracing.endpoint", "is required when tracing is enabled")
+
+	check(s.Database.ConnectionURI != "",
+		"database.connection_uri", "is required")
+
+	switch s.Database.Dialect {
+	case "sqlite":
+	case "postgresql":
+		_, err := pgconn.ParseConfig(s.Database.ConnectionURI)
+		check(err == nil, "database.connection_uri", "isn't a valid postgresql connection string")
+	case "mysql":
+		_, err := mysql.ParseDSN(s.Database.ConnectionURI)
+		check(err == nil, "database.connection_uri", "isn't a valid mysql DSN")
+	default:
+		check(false, "database.dialect", "must be one of sqlite, postgresql or mysql, got %q", s.Database.Dialect)
+	}
+
+	// PostgreSQL and MySQL refuse NUL bytes and invalid UTF-8 in text
+	// columns
+	check(!s.Documents.AllowBinary || s.Database.Dialect == "sqlite",
+		"documents.allow_binary", "is only supported with sqlite, %s can't store binary content", s.Database.Dialect)
+
+	check(s.Database.Breaker.Threshold >= 0,
+		"database.breaker.threshold", "can't be negative, got %d", s.Database.Breaker.Threshold)
+	check(s.Database.Breaker.Threshold == 0 || s.Database.Breaker.Cooldown > 0,
+		"database.breaker.cooldown", "must be positive, got %d", s.Database.Breaker.Cooldown)
+	check(s.Database.Breaker.Cache >= 0,
+		"database.breaker.cache", "can't be negative, got %d", s.Database.Breaker.Cache)
+	check(s.Database.Retry.Attempts > 0,
+		"database.retry.attempts", "must be positive, got %d", s.Database.Retry.Attempts)
+	check(s.Database.Retry.Backoff >= 0,
+		"database.retry.backoff", "can't be negative, got %d", s.Database.Retry.Backoff)
+	check(s.Database.Retry.MaxBackoff >= s.Database.Retry.Backoff,
+		"database.retry.max_backoff", "can't be less than database.retry.backoff, got %d", s.Database.Retry.MaxBackoff)
+
+	return problems
+}
+
+// validNetwork reports whether `entry` is a CIDR or a bare address
+func validNetwork(entry string) bool {
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return true
+	}
+
+	return net.ParseIP(entry) != nil
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"gorm.io/gorm"
+)
+
+// ErrUnavailable is returned by queries while the breaker is open
+var ErrUnavailable = errors.New("database is unavailable")
+
+const sentKey = "spirit:breaker_sent"
+
+type trackKey struct{}
+
+// breaker stops sending queries to a database that can't be reached, so
+// requests fail right away instead of each waiting on it
+var breaker struct {
+	sync.Mutex
+	failures int
+	openedAt time.Time // zero while queries are let through
+}
+
+// Unavailable reports whether `err` means the database couldn't be reached,
+// as opposed to a query failing on its own. Queries running out of time
+// aren't counted, that's as likely to be a slow query or a short route
+// timeout as the database being down.
+func Unavailable(err error) bool {
+	var netErr net.Error
+
+	if cancelled(err) {
+		return false
+	}
+
+	return errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
+
+// Track returns a context that remembers whether a query run with it
+// couldn't reach the database, see WasUnavailable
+func Track(ctx context.Context) context.Context {
+	return context.WithValue(ctx, trackKey{}, new(int32))
+}
+
+// WasUnavailable reports whether a query run with `ctx`, or a context
+// derived from it, couldn't reach the database
+func WasUnavailable(ctx context.Context) bool {
+	flag, ok := ctx.Value(trackKey{}).(*int32)
+
+	return ok && atomic.LoadInt32(flag) == 1
+}
+
+// RetryAfter is how long until the breaker lets a query through again, 0
+// if it's closed
+func RetryAfter() time.Duration {
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	if breaker.openedAt.IsZero() {
+		return 0
+	}
+
+	wait := time.Until(breaker.openedAt.Add(cooldown()))
+
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+func cooldown() time.Duration {
+	return time.Duration(config.Config().Database.Breaker.Cooldown) * time.Millisecond
+}
+
+// allow reports whether a query may be sent. While the breaker is open one
+// query per cooldown gets through to check whether the database is back.
+func allow() bool {
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	if breaker.openedAt.IsZero() {
+		return true
+	}
+
+	if time.Since(breaker.openedAt) < cooldown() {
+		return false
+	}
+
+	breaker.openedAt = time.Now()
+
+	return true
+}
+
+// cancelled reports whether `err` comes from the query's context being done
+func cancelled(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// record counts the outcome of a query that was sent. Cancelled queries
+// tell nothing about the database, so they don't count either way.
+func record(err error) {
+	if cancelled(err) {
+		return
+	}
+
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	if !Unavailable(err) {
+		breaker.failures = 0
+		breaker.openedAt = time.Time{}
+
+		return
+	}
+
+	breaker.failures++
+	threshold := config.Config().Database.Breaker.Threshold
+
+	if threshold > 0 && breaker.failures >= threshold {
+		breaker.openedAt = time.Now()
+	}
+}
+
+func markUnavailable(ctx context.Context) {
+	if flag, ok := ctx.Value(trackKey{}).(*int32); ok {
+		atomic.StoreInt32(flag, 1)
+	}
+}
+
+// breakerPlugin is a gorm plugin failing queries with ErrUnavailable while
+// the breaker is open
+type breakerPlugin struct{}
+
+// Name returns the name of the plugin
+func (breakerPlugin) Name() string {
+	return "breaker"
+}
+
+// Initialize registers the callbacks on `db`
+func (breakerPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("breaker:before_create", before),
+		cb.Create().After("gorm:create").Register("breaker:after_create", after),
+		cb.Query().Before("gorm:query").Register("breaker:before_query", before),
+		cb.Query().After("gorm:query").Register("breaker:after_query", after),
+		cb.Update().Before("gorm:update").Register("breaker:before_update", before),
+		cb.Update().After("gorm:update").Register("breaker:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("breaker:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("breaker:after_delete", after),
+		cb.Row().Before("gorm:row").Register("breaker:before_row", before),
+		cb.Row().After("gorm:row").Register("breaker:after_row", after),
+		cb.Raw().Before("gorm:raw").Register("breaker:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("breaker:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func before(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	if !allow() {
+		db.AddError(ErrUnavailable)
+		return
+	}
+
+	db.InstanceSet(sentKey, true)
+}
+
+func after(db *gorm.DB) {
+	if Unavailable(db.Error) {
+		markUnavailable(db.Statement.Context)
+	}
+
+	// Only queries that were sent tell whether the database is reachable
+	if _, sent := db.InstanceGet(sentKey); sent {
+		record(db.Error)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"gorm.io/gorm"
+)
+
+// resetBreaker closes the breaker and forgets past failures
+func resetBreaker() {
+	breaker.Lock()
+	defer breaker.Unlock()
+
+	breaker.failures = 0
+	breaker.openedAt = time.Time{}
+}
+
+func TestCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, true},
+		{"wrapped", fmt.Errorf("query: %w", context.Canceled), true},
+		{"bad connection", driver.ErrBadConn, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cancelled(tt.err); got != tt.want {
+				t.Errorf("cancelled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"breaker open", ErrUnavailable, true},
+		{"wrapped", fmt.Errorf("query: %w", ErrUnavailable), true},
+		{"bad connection", driver.ErrBadConn, true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}, true},
+		// Deadlines are network errors too, but say nothing about the database
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"cancelled", context.Canceled, false},
+		{"not found", gorm.ErrRecordNotFound, false},
+		{"query error", &pgconn.PgError{Code: "42601"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unavailable(tt.err); got != tt.want {
+				t.Errorf("Unavailable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	configtest.Load(t, `
+[database.breaker]
+threshold = 3
+cooldown = 60_000
+`)
+
+	down := driver.ErrBadConn
+
+	tests := []struct {
+		name string
+		errs []error
+		open bool
+	}{
+		{"below the threshold", []error{down, down}, false},
+		{"at the threshold", []error{down, down, down}, true},
+		{"success resets the count", []error{down, down, nil, down}, false},
+		{"query errors reset the count", []error{down, down, gorm.ErrRecordNotFound, down}, false},
+		{"success closes it", []error{down, down, down, nil}, false},
+		{"cancelled queries don't count", []error{down, context.Canceled, context.DeadlineExceeded}, false},
+		{"cancelled queries don't reset", []error{down, down, context.Canceled, down}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetBreaker()
+			defer resetBreaker()
+
+			for _, err := range tt.errs {
+				record(err)
+			}
+
+			if open := RetryAfter() > 0; open != tt.open {
+				t.Errorf("breaker open = %v, want %v", open, tt.open)
+			}
+
+			if allow() == tt.open {
+				t.Errorf("allow() = %v while the breaker is open = %v", !tt.open, tt.open)
+			}
+		})
+	}
+}
+
+func TestRecordDisabled(t *testing.T) {
+	configtest.Load(t, `
+[database.breaker]
+threshold = 0
+`)
+
+	resetBreaker()
+	defer resetBreaker()
+
+	for i := 0; i < 10; i++ {
+		record(driver.ErrBadConn)
+	}
+
+	if RetryAfter() != 0 {
+		t.Error("breaker opened with a threshold of 0")
+	}
+}
+
+func TestAllowProbes(t *testing.T) {
+	configtest.Load(t, `
+[database.breaker]
+threshold = 1
+cooldown = 60_000
+`)
+
+	resetBreaker()
+	defer resetBreaker()
+
+	record(driver.ErrBadConn)
+
+	if allow() {
+		t.Fatal("query let through right after the breaker opened")
+	}
+
+	breaker.Lock()
+	breaker.openedAt = time.Now().Add(-2 * time.Minute)
+	breaker.Unlock()
+
+	if !allow() {
+		t.Fatal("no query let through after the cooldown")
+	}
+
+	if allow() {
+		t.Error("more than one query let through per cooldown")
+	}
+}
@@ -20,7 +20,7 @@ import (
 	"log"
 
 	"github.com/spacebin-org/spirit/internal/pkg/config"
-	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/tracing"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -35,20 +35,63 @@ func Init() {
 	var err error
 	var dialect gorm.Dialector
 
-	switch config.Config.Database.Dialect {
+	switch config.Config().Database.Dialect {
 	case "sqlite":
-		dialect = sqlite.Open(config.Config.Database.ConnectionURI)
+		dialect = sqlite.Open(config.Config().Database.ConnectionURI)
 	case "postgresql":
-		dialect = postgres.Open(config.Config.Database.ConnectionURI)
+		dialect = postgres.Open(config.Config().Database.ConnectionURI)
 	case "mysql":
-		dialect = mysql.Open(config.Config.Database.ConnectionURI)
+		dialect = mysql.Open(config.Config().Database.ConnectionURI)
 	}
 
 	DBConn, err = gorm.Open(dialect, &gorm.Config{})
 
-	DBConn.AutoMigrate(&models.Document{})
-
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %e", err)
 	}
+
+	// Statements outside of transactions are retried on transient errors,
+	// transactions have to go through Transaction
+	db, err := DBConn.DB()
+
+	if err != nil {
+		log.Fatalf("Failed to get connection pool: %v", err)
+	}
+
+	DBConn.ConnPool = retryPool{db: db}
+	DBConn.Statement.ConnPool = DBConn.ConnPool
+
+	// Wrap database calls in spans, this is a no-op unless tracing is enabled
+	if err := DBConn.Use(tracing.Plugin{}); err != nil {
+		log.Fatalf("Failed to register tracing plugin: %v", err)
+	}
+
+	// Fail fast while the database can't be reached
+	if err := DBConn.Use(breakerPlugin{}); err != nil {
+		log.Fatalf("Failed to register breaker plugin: %v", err)
+	}
+}
+
+// ByteLength returns the expression for the length of `column` in bytes,
+// which each database spells differently
+func ByteLength(column string) string {
+	switch DBConn.Dialector.Name() {
+	case "postgres":
+		return "OCTET_LENGTH(" + column + ")"
+	case "sqlite":
+		return "LENGTH(CAST(" + column + " AS BLOB))"
+	default:
+		return "LENGTH(" + column + ")"
+	}
+}
+
+// Close closes every connection in the pool
+func Close() error {
+	db, err := DBConn.DB()
+
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
 }
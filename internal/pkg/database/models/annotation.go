@@ -0,0 +1,28 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// Annotation is a note on a range of lines of a document
+type Annotation struct {
+	ID         uint   `db:"id" gorm:"primaryKey"`
+	DocumentID string `db:"document_id" gorm:"index;not null"`
+	StartLine  int    `db:"start_line" gorm:"not null"` // Counted from 1.
+	EndLine    int    `db:"end_line" gorm:"not null"`   // Inclusive.
+	Author     string `db:"author" gorm:"not null;default:''"`
+	Body       string `db:"body"` // Markdown.
+	CreatedAt  int64  `db:"created_at"`
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// AuditEvent records a security-relevant action. Events are only ever
+// added, never changed or deleted, except to anonymize the events of
+// erased accounts.
+type AuditEvent struct {
+	ID        uint   `db:"id" json:"id" gorm:"primaryKey"`
+	CreatedAt int64  `db:"created_at" json:"created_at" gorm:"index"`
+	Actor     string `db:"actor" json:"actor" gorm:"index;not null"` // Token name, or "system".
+	Action    string `db:"action" json:"action" gorm:"index;not null"`
+	Target    string `db:"target" json:"target,omitempty"` // What the action was done to, e.g. "report:12".
+	Detail    string `db:"detail" json:"detail,omitempty"`
+	IP        string `db:"ip" json:"ip,omitempty"`
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// Collection groups documents, so they can be shared with one link
+type Collection struct {
+	ID        string `db:"id" json:"id" gorm:"primaryKey"`
+	Name      string `db:"name" json:"name" gorm:"not null"`
+	Owner     string `db:"owner" json:"owner" gorm:"index;not null"` // Name of the token that created it.
+	CreatedAt int64  `db:"created_at" json:"created_at"`
+	UpdatedAt int64  `db:"updated_at" json:"updated_at"`
+}
+
+// CollectionDocument puts a document in a collection
+type CollectionDocument struct {
+	CollectionID string `db:"collection_id" gorm:"primaryKey"`
+	DocumentID   string `db:"document_id" gorm:"primaryKey"`
+	CreatedAt    int64  `db:"created_at"` // When the document was added.
+}
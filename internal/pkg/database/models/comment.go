@@ -0,0 +1,36 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// CommentHidden is the moderation state of a comment hidden by a
+// moderator. Comments share the other states with documents.
+const CommentHidden = "hidden"
+
+// Comment is written below a document, replying to another comment when
+// ParentID is set
+type Comment struct {
+	ID               uint   `db:"id" gorm:"primaryKey"`
+	DocumentID       string `db:"document_id" gorm:"index;not null"`
+	ParentID         uint   `db:"parent_id" gorm:"not null;default:0"`
+	Author           string `db:"author" gorm:"not null;default:''"`     // Name of the token that wrote it, empty if anonymous.
+	AuthorIP         string `db:"author_ip" gorm:"not null;default:''"`  // Kept for moderators, never served.
+	Body             string `db:"body"`                                  // Markdown.
+	Deleted          bool   `db:"deleted" gorm:"not null;default:false"` // The body is cleared, but replies stay threaded.
+	Moderation       string `db:"moderation" gorm:"not null;default:''"` // Hidden comments keep their body, but it isn't served.
+	ModerationReason string `db:"moderation_reason" gorm:"not null;default:''"`
+	CreatedAt        int64  `db:"created_at"`
+}
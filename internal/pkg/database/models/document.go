@@ -16,11 +16,45 @@
 
 package models
 
+import (
+	"crypto/md5"
+	"encoding/hex"
+)
+
+// Moderation states of a document
+const (
+	ModerationNone        = ""
+	ModerationFlagged     = "flagged"     // Served, but waiting for review.
+	ModerationQuarantined = "quarantined" // Never served.
+)
+
 // Document is the structure of a document in the database
 type Document struct {
-	ID        string `db:"id"`
-	Content   string `db:"content"`
-	Extension string `db:"extension"`
-	CreatedAt int64  `db:"created_at"`
-	UpdatedAt int64  `db:"updated_at"`
+	ID               string `db:"id"`
+	Content          string `db:"content"`
+	Extension        string `db:"extension"`
+	CreatedAt        int64  `db:"created_at"`
+	UpdatedAt        int64  `db:"updated_at"`
+	Moderation       string `db:"moderation" gorm:"not null;default:''"`
+	ModerationReason string `db:"moderation_reason" gorm:"not null;default:''"`
+	CreatorIP        string `db:"creator_ip" gorm:"not null;default:''"`   // Kept for moderators, never served.
+	Owner            string `db:"owner" gorm:"index;not null;default:''"`  // Name of the token that created it, empty if anonymous.
+	ExpiresAt        int64  `db:"expires_at" gorm:"not null;default:0"`    // Overrides retention rules when set.
+	GistURL          string `db:"gist_url" gorm:"not null;default:''"`     // Set once the document was exported to a gist.
+	Public           bool   `db:"public" gorm:"not null;default:false"`    // Listed in its owner's feed.
+	Shortened        bool   `db:"shortened" gorm:"not null;default:false"` // The content is a URL /:id redirects to.
+	DeletedAt        int64  `db:"deleted_at" gorm:"not null;default:0"`    // When it was moved to the trash.
+	DeletedBy        string `db:"deleted_by" gorm:"not null;default:''"`   // Name of the token that deleted it.
+	Organization     string `db:"organization" gorm:"not null;default:''"` // Shared with the members of this organization.
+	Private          bool   `db:"private" gorm:"not null;default:false"`   // Only served to whoever can manage it.
+	ContentHash      string `db:"content_hash" gorm:"not null;default:''"` // MD5 of the content in hex, set when it's stored.
+
+	ContentSize int64 `db:"-" gorm:"-" json:"-"` // Length of the content in bytes, set when it was loaded without the content.
+}
+
+// HashContent returns the ContentHash of a document with `content`
+func HashContent(content string) string {
+	hash := md5.Sum([]byte(content))
+
+	return hex.EncodeToString(hash[:])
 }
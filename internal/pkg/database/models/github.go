@@ -0,0 +1,24 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// GitHubToken is the OAuth token an account linked with GitHub
+type GitHubToken struct {
+	Owner     string `db:"owner" gorm:"primaryKey"` // Name of the auth token it belongs to.
+	Token     string `db:"token" gorm:"not null"`
+	CreatedAt int64  `db:"created_at"`
+}
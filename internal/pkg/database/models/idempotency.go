@@ -0,0 +1,41 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// IdempotencyKey remembers the document a create request carrying an
+// Idempotency-Key header made, so retries of it get the same one back
+type IdempotencyKey struct {
+	KeyHash     string `db:"key_hash" gorm:"primaryKey"`                   // SHA-256 of the caller and the header.
+	CallerHash  string `db:"caller_hash" gorm:"index;not null;default:''"` // See HashCaller.
+	RequestHash string `db:"request_hash" gorm:"not null"`                 // SHA-256 of the request's URL and body.
+	DocumentID  string `db:"document_id" gorm:"not null"`                  // Empty while the request is being processed.
+	Normalized  string `db:"normalized" gorm:"not null;default:''"`        // Transforms applied to the content, comma-separated.
+	CreatedAt   int64  `db:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// HashCaller returns the CallerHash of keys sent by `caller`, e.g.
+// "token:<name>", so they can be found without storing who sent them
+func HashCaller(caller string) string {
+	hash := sha256.Sum256([]byte(caller))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,26 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// RateLimit is an administrator's runtime override of the rate limit of
+// one of the `auth.tokens`
+type RateLimit struct {
+	Name      string `db:"name" json:"name" gorm:"primaryKey"` // Of the token.
+	Rule      string `db:"rule" json:"rule" gorm:"not null"`   // e.g. "5000/min"
+	UpdatedBy string `db:"updated_by" json:"updated_by"`
+	UpdatedAt int64  `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// Report statuses
+const (
+	ReportOpen     = "open"
+	ReportResolved = "resolved"
+)
+
+// Report is an abuse report filed against a document, or a comment on it
+// when CommentID is set
+type Report struct {
+	ID         uint   `db:"id" json:"id" gorm:"primaryKey"`
+	DocumentID string `db:"document_id" json:"document_id" gorm:"index;not null"`
+	CommentID  uint   `db:"comment_id" json:"comment_id,omitempty" gorm:"not null;default:0"`
+	Reason     string `db:"reason" json:"reason"`
+	ReporterIP string `db:"reporter_ip" json:"reporter_ip"`
+	Status     string `db:"status" json:"status" gorm:"index;not null;default:'open'"`
+	Resolution string `db:"resolution" json:"resolution,omitempty"` // What a moderator did about it.
+	CreatedAt  int64  `db:"created_at" json:"created_at"`
+	ResolvedAt int64  `db:"resolved_at" json:"resolved_at,omitempty"`
+}
+
+// Ban stops an address from creating documents and comments
+type Ban struct {
+	IP        string `db:"ip" json:"ip" gorm:"primaryKey"`
+	Reason    string `db:"reason" json:"reason"`
+	CreatedAt int64  `db:"created_at" json:"created_at"`
+}
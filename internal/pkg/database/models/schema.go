@@ -0,0 +1,25 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// SchemaVersion records which version of the schema the database was last
+// migrated to, it only ever has one row
+type SchemaVersion struct {
+	ID         int   `db:"id" gorm:"primaryKey;autoIncrement:false"`
+	Version    int   `db:"version" gorm:"not null"`
+	MigratedAt int64 `db:"migrated_at" gorm:"not null"`
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// ShareLink grants read access to a document to whoever has its token
+type ShareLink struct {
+	ID         uint   `db:"id" json:"id" gorm:"primaryKey"`
+	DocumentID string `db:"document_id" json:"-" gorm:"index;not null"`
+	TokenHash  string `db:"token_hash" json:"-" gorm:"uniqueIndex;not null"` // SHA-256 of the token, which is only shown once.
+	CreatedBy  string `db:"created_by" json:"created_by"`
+	CreatedAt  int64  `db:"created_at" json:"created_at"`
+	ExpiresAt  int64  `db:"expires_at" json:"expires_at"`
+
+	// CreatedAt of the document, so the link doesn't carry over to a later
+	// document given the same ID
+	DocumentCreatedAt int64 `db:"document_created_at" json:"-"`
+}
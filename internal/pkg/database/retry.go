@@ -0,0 +1,234 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"gorm.io/gorm"
+)
+
+// Transient reports whether `err` is likely to go away when the operation
+// is tried again, like serialization failures or connections dropped
+// during a failover
+func Transient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if notApplied(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+
+	// Connections closed by the server, e.g. while a primary steps down
+	if errors.As(err, &pgErr) && (pgErr.Code == "57P01" || pgErr.Code == "57P02") {
+		return true
+	}
+
+	return errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// notApplied reports whether `err` is transient and also means the
+// statement surely had no effect, so writes can be retried too
+func notApplied(err error) bool {
+	var (
+		pgErr     *pgconn.PgError
+		mysqlErr  *mysql.MySQLError
+		sqliteErr sqlite3.Error
+	)
+
+	switch {
+	case errors.As(err, &pgErr):
+		// Serialization failures, deadlocks, connection exceptions,
+		// servers starting up or read-only replicas after a failover
+		return pgErr.Code == "40001" || pgErr.Code == "40P01" || pgErr.Code == "57P03" ||
+			pgErr.Code == "25006" || strings.HasPrefix(pgErr.Code, "08")
+	case errors.As(err, &mysqlErr):
+		// Deadlocks, lock wait timeouts and read-only replicas
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205 || mysqlErr.Number == 1290 ||
+			mysqlErr.Number == 1792
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// Duplicate reports whether `err` is a violation of a unique constraint,
+// such as inserting a row with a taken primary key
+func Duplicate(err error) bool {
+	var (
+		pgErr     *pgconn.PgError
+		mysqlErr  *mysql.MySQLError
+		sqliteErr sqlite3.Error
+	)
+
+	switch {
+	case errors.As(err, &pgErr):
+		return pgErr.Code == "23505"
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1062
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey || sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	return false
+}
+
+// retry runs `op` until it succeeds, fails with an error `retryable`
+// rejects, or `database.retry.attempts` are used up. Attempts are spaced
+// out with exponential backoff and full jitter, so clients don't all come
+// back at the same moment.
+func retry(ctx context.Context, retryable func(error) bool, op func() error) error {
+	settings := config.Config().Database.Retry
+	backoff := time.Duration(settings.Backoff) * time.Millisecond
+	maxBackoff := time.Duration(settings.MaxBackoff) * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		err := op()
+
+		if err == nil || attempt >= settings.Attempts || !retryable(err) {
+			return err
+		}
+
+		wait := backoff << (attempt - 1)
+
+		// Also catches the shift overflowing
+		if wait > maxBackoff || wait < backoff {
+			wait = maxBackoff
+		}
+
+		if wait > 0 {
+			wait = time.Duration(rand.Int63n(int64(wait)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Transaction runs `fn` in a transaction like gorm's Transaction, and runs
+// it again in a new one when it fails with a transient error. `fn` must be
+// safe to run more than once. Serializable transactions can rely on
+// serialization failures being retried.
+func Transaction(ctx context.Context, fn func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	committing := false
+
+	return retry(ctx, func(err error) bool {
+		// Once `fn` succeeded the error came from committing, which may
+		// have gone through anyway
+		if committing {
+			return notApplied(err)
+		}
+
+		return Transient(err)
+	}, func() error {
+		committing = false
+
+		return DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := fn(tx)
+			committing = err == nil
+
+			return err
+		}, opts...)
+	})
+}
+
+// retryPool retries statements run outside of transactions. Reads are
+// retried on every transient error, writes only when they surely had no
+// effect.
+type retryPool struct {
+	db *sql.DB
+}
+
+func (p retryPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, query)
+}
+
+func (p retryPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+
+	err := retry(ctx, notApplied, func() (err error) {
+		result, err = p.db.ExecContext(ctx, query, args...)
+		return err
+	})
+
+	return result, err
+}
+
+func (p retryPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+
+	err := retry(ctx, retryable(query), func() (err error) {
+		rows, err = p.db.QueryContext(ctx, query, args...)
+		return err
+	})
+
+	return rows, err
+}
+
+func (p retryPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	var row *sql.Row
+
+	// The error is kept in the row for Scan to return
+	_ = retry(ctx, retryable(query), func() error {
+		row = p.db.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+
+	return row
+}
+
+// BeginTx starts a transaction, retrying it is up to Transaction
+func (p retryPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.db.BeginTx(ctx, opts)
+}
+
+// GetDBConn returns the underlying pool for gorm's DB()
+func (p retryPool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+// retryable picks how errors of `query` are classified. Queries can write
+// too, e.g. inserts returning the new row's ID.
+func retryable(query string) func(error) bool {
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT") {
+		return Transient
+	}
+
+	return notApplied
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"gorm.io/gorm"
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		transient  bool
+		notApplied bool
+	}{
+		{"nil", nil, false, false},
+		{"postgres serialization failure", &pgconn.PgError{Code: "40001"}, true, true},
+		{"postgres deadlock", &pgconn.PgError{Code: "40P01"}, true, true},
+		{"postgres connection failure", &pgconn.PgError{Code: "08006"}, true, true},
+		{"postgres read-only replica", &pgconn.PgError{Code: "25006"}, true, true},
+		{"postgres shutting down", &pgconn.PgError{Code: "57P01"}, true, false},
+		{"postgres unique violation", &pgconn.PgError{Code: "23505"}, false, false},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, true, true},
+		{"mysql read-only replica", &mysql.MySQLError{Number: 1290}, true, true},
+		{"mysql duplicate entry", &mysql.MySQLError{Number: 1062}, false, false},
+		{"mysql invalid connection", mysql.ErrInvalidConn, true, false},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy}, true, true},
+		{"sqlite locked", sqlite3.Error{Code: sqlite3.ErrLocked}, true, true},
+		{"sqlite constraint", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, false, false},
+		{"bad connection", driver.ErrBadConn, true, true},
+		{"connection refused", syscall.ECONNREFUSED, true, true},
+		{"connection reset", syscall.ECONNRESET, true, false},
+		{"broken pipe", syscall.EPIPE, true, false},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true, false},
+		{"wrapped", fmt.Errorf("query: %w", &pgconn.PgError{Code: "40001"}), true, true},
+		{"not found", gorm.ErrRecordNotFound, false, false},
+		{"cancelled", context.Canceled, false, false},
+		{"other", errors.New("syntax error"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Transient(tt.err); got != tt.transient {
+				t.Errorf("Transient() = %v, want %v", got, tt.transient)
+			}
+
+			if tt.err == nil {
+				return
+			}
+
+			if got := notApplied(tt.err); got != tt.notApplied {
+				t.Errorf("notApplied() = %v, want %v", got, tt.notApplied)
+			}
+		})
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"postgres unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"postgres foreign key violation", &pgconn.PgError{Code: "23503"}, false},
+		{"mysql duplicate entry", &mysql.MySQLError{Number: 1062}, true},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, false},
+		{"sqlite primary key", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, true},
+		{"sqlite unique", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, true},
+		{"sqlite not null", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintNotNull}, false},
+		{"wrapped", fmt.Errorf("create: %w", &pgconn.PgError{Code: "23505"}), true},
+		{"other", errors.New("duplicate"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Duplicate(tt.err); got != tt.want {
+				t.Errorf("Duplicate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	configtest.Load(t, `
+[database.retry]
+attempts = 3
+backoff = 0
+max_backoff = 0
+`)
+
+	transient := &pgconn.PgError{Code: "40001"}
+	permanent := errors.New("syntax error")
+
+	tests := []struct {
+		name     string
+		errs     []error // Returned by each attempt in turn, the last one repeats.
+		want     error
+		attempts int
+	}{
+		{"succeeds", []error{nil}, nil, 1},
+		{"succeeds after a transient error", []error{transient, nil}, nil, 2},
+		{"keeps failing", []error{transient}, transient, 3},
+		{"fails for good", []error{permanent}, permanent, 1},
+		{"fails for good after a transient error", []error{transient, permanent}, permanent, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+
+			err := retry(context.Background(), Transient, func() error {
+				err := tt.errs[len(tt.errs)-1]
+
+				if attempts < len(tt.errs) {
+					err = tt.errs[attempts]
+				}
+
+				attempts++
+
+				return err
+			})
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("retry() = %v, want %v", err, tt.want)
+			}
+
+			if attempts != tt.attempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	configtest.Load(t, `
+[database.retry]
+attempts = 3
+backoff = 60_000
+max_backoff = 60_000
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+	err := retry(ctx, Transient, func() error {
+		attempts++
+
+		return driver.ErrBadConn
+	})
+
+	if !errors.Is(err, driver.ErrBadConn) || attempts != 1 {
+		t.Errorf("retry() = %v after %d attempts, want the first error without waiting", err, attempts)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SchemaVersion is the version of the schema this build expects. Bump it
+// whenever a model changes: with `database.auto_migrate` off, the stored
+// version is all that tells the server a migration is needed.
+const SchemaVersion = 7
+
+// tables are every model stored in the database
+var tables = []interface{}{
+	&models.Document{}, &models.Report{}, &models.Ban{}, &models.JobLock{}, &models.GitHubToken{},
+	&models.DocumentView{}, &models.AuditEvent{}, &models.Star{}, &models.DocumentTag{},
+	&models.Collection{}, &models.CollectionDocument{}, &models.Comment{}, &models.Annotation{},
+	&models.ShareLink{}, &models.IdempotencyKey{}, &models.FeatureFlag{}, &models.RateLimit{}, &models.SchemaVersion{},
+}
+
+// Errors returned by CheckSchema
+var (
+	ErrSchemaOutdated = errors.New("database schema is older than this build")
+	ErrSchemaTooNew   = errors.New("database schema is newer than this build")
+)
+
+// StoredSchemaVersion returns the version the database was last migrated
+// to, 0 if it never was or predates schema versions
+func StoredSchemaVersion() (int, error) {
+	if !DBConn.Migrator().HasTable(&models.SchemaVersion{}) {
+		return 0, nil
+	}
+
+	row := models.SchemaVersion{}
+	err := DBConn.Where("id = 1").Limit(1).Find(&row).Error
+
+	return row.Version, err
+}
+
+// CheckSchema compares the stored schema version to SchemaVersion. Empty
+// databases and ones that predate schema versions are reported as
+// outdated.
+func CheckSchema() error {
+	stored, err := StoredSchemaVersion()
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case stored < SchemaVersion:
+		return fmt.Errorf("%w (version %d, expected %d)", ErrSchemaOutdated, stored, SchemaVersion)
+	case stored > SchemaVersion:
+		return fmt.Errorf("%w (version %d, expected %d)", ErrSchemaTooNew, stored, SchemaVersion)
+	}
+
+	return nil
+}
+
+// Migrate creates and updates every table, then records SchemaVersion. A
+// database migrated by a newer build is left alone.
+func Migrate() error {
+	stored, err := StoredSchemaVersion()
+
+	if err != nil {
+		return err
+	}
+
+	if stored > SchemaVersion {
+		return fmt.Errorf("%w (version %d, expected %d)", ErrSchemaTooNew, stored, SchemaVersion)
+	}
+
+	if err := DBConn.AutoMigrate(tables...); err != nil {
+		return err
+	}
+
+	// Version 2 ties share links to the document they were made for. Links
+	// made before a document with the same ID was created stay unusable.
+	if stored < 2 {
+		err := DBConn.Exec(`UPDATE share_links SET document_created_at = COALESCE((
+			SELECT created_at FROM documents WHERE documents.id = share_links.document_id
+			AND documents.created_at <= share_links.created_at
+		), 0) WHERE document_created_at = 0`).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Version 3 stores the hash of every document's content
+	if stored < 3 {
+		batch := []models.Document{}
+		err := DBConn.Select("id", "content").Where("content_hash = ''").FindInBatches(&batch, 100, func(tx *gorm.DB, _ int) error {
+			for _, doc := range batch {
+				err := DBConn.Model(&models.Document{}).Where("id = ?", doc.ID).Update("content_hash", models.HashContent(doc.Content)).Error
+
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return DBConn.Clauses(clause.OnConflict{UpdateAll: true}).Create(&models.SchemaVersion{
+		ID:         1,
+		Version:    SchemaVersion,
+		MigratedAt: time.Now().Unix(),
+	}).Error
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/domain"
+	"github.com/spacebin-org/spirit/internal/pkg/markdown"
+	"gorm.io/gorm"
+)
+
+// maxAnnotations is how many annotations a document can have
+const maxAnnotations = 100
+
+// ErrTooManyAnnotations is returned when a document can't be annotated any
+// further
+var ErrTooManyAnnotations = errors.New("document already has as many annotations as it can have")
+
+// AnnotationRequest represents a valid body object for the annotate request
+type AnnotationRequest struct {
+	StartLine int `json:"start_line" form:"start_line"`
+	EndLine   int `json:"end_line" form:"end_line"`
+	Body      string
+}
+
+// Validate performs validation on the body, for a document of `lines`
+// lines
+func (r AnnotationRequest) Validate(lines int) error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.StartLine, validation.Required, validation.Min(1), validation.Max(lines)),
+		validation.Field(&r.EndLine, validation.Required, validation.Min(r.StartLine), validation.Max(lines)),
+		validation.Field(&r.Body, validation.Required, validation.Length(1, 5000)),
+	)
+}
+
+// lineCount counts the lines of `content` the way they're displayed
+func lineCount(content string) int {
+	return strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+}
+
+// GetAnnotations retrieves the annotations of document `id`, ordered by the
+// line they start on
+func GetAnnotations(ctx context.Context, id string) ([]domain.Annotation, error) {
+	rows := []models.Annotation{}
+	err := database.DBConn.WithContext(ctx).Where("document_id = ?", id).Order("start_line, id").Find(&rows).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make([]domain.Annotation, 0, len(rows))
+
+	for i := range rows {
+		annotations = append(annotations, annotation(&rows[i]))
+	}
+
+	return annotations, nil
+}
+
+// Annotate adds a note to a range of lines of document `id` on behalf of
+// `identity`, who must be able to manage it
+func Annotate(ctx context.Context, identity *auth.Identity, id string, b *AnnotationRequest) (*domain.Annotation, error) {
+	doc, err := GetDocument(ctx, identity, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanManage(identity, doc) {
+		return nil, ErrNotOwner
+	}
+
+	if err := b.Validate(lineCount(doc.Content)); err != nil {
+		return nil, fiber.NewError(400, err.Error())
+	}
+
+	var count int64
+
+	if err := database.DBConn.WithContext(ctx).Model(&models.Annotation{}).Where("document_id = ?", id).Count(&count).Error; err != nil {
+		return nil, err
+	}
+
+	if count >= maxAnnotations {
+		return nil, ErrTooManyAnnotations
+	}
+
+	row := models.Annotation{DocumentID: id, StartLine: b.StartLine, EndLine: b.EndLine, Author: identity.Name, Body: b.Body}
+
+	if err := database.DBConn.WithContext(ctx).Create(&row).Error; err != nil {
+		return nil, err
+	}
+
+	a := annotation(&row)
+
+	return &a, nil
+}
+
+// DeleteAnnotation removes annotation `annotationID` from document `id` on
+// behalf of `identity`, who must be able to manage the document
+func DeleteAnnotation(ctx context.Context, identity *auth.Identity, id string, annotationID uint) error {
+	doc, err := GetDocumentInfo(ctx, identity, id)
+
+	if err != nil {
+		return err
+	}
+
+	if !CanManage(identity, doc) {
+		return ErrNotOwner
+	}
+
+	res := database.DBConn.WithContext(ctx).Where("id = ? AND document_id = ?", annotationID, id).Delete(&models.Annotation{})
+
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return res.Error
+}
+
+// annotation describes `row` for the API
+func annotation(row *models.Annotation) domain.Annotation {
+	return domain.Annotation{
+		ID:        row.ID,
+		StartLine: row.StartLine,
+		EndLine:   row.EndLine,
+		Author:    row.Author,
+		Body:      row.Body,
+		HTML:      markdown.Render(row.Body),
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+// registerAnnotations loads the endpoints listing and changing the notes
+// on a document's lines
+func registerAnnotations(api fiber.Router) {
+	api.Get("/:id/annotations", func(c *fiber.Ctx) error {
+		if _, err := GetDocumentInfo(c.UserContext(), auth.FromRequest(c), c.Params("id")); err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		annotations, err := GetAnnotations(c.UserContext(), c.Params("id"))
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{"annotations": annotations})
+	})
+
+	api.Post("/:id/annotations", auth.Require(), func(c *fiber.Ctx) error {
+		b := new(AnnotationRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		a, err := Annotate(c.UserContext(), auth.FromRequest(c), c.Params("id"), b)
+
+		if err != nil {
+			return changeError(err)
+		}
+
+		return c.Status(201).JSON(a)
+	})
+
+	api.Delete("/:id/annotations/:annotation", auth.Require(), func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("annotation"), 10, 64)
+
+		if err != nil {
+			return fiber.NewError(400, "invalid annotation id")
+		}
+
+		if err := DeleteAnnotation(c.UserContext(), auth.FromRequest(c), c.Params("id"), uint(id)); err != nil {
+			return changeError(err)
+		}
+
+		return c.SendStatus(204)
+	})
+}
+
+// changeError maps errors from changing a document's annotations or share
+// links to a response
+func changeError(err error) error {
+	var e *fiber.Error
+
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fiber.NewError(404, err.Error())
+	case errors.Is(err, ErrNotOwner):
+		return fiber.NewError(403, err.Error())
+	case errors.Is(err, ErrTooManyAnnotations):
+		return fiber.NewError(409, err.Error())
+	default:
+		return fiber.NewError(500, err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/ansi"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// terminalAgents are the User-Agent prefixes of command line clients
+var terminalAgents = []string{"curl/", "Wget/", "HTTPie/"}
+
+// wantsANSI reports whether raw content should be colored for a terminal,
+// asked for with `?ansi=true` or, when `documents.ansi_for_terminals` is
+// set, by command line clients not accepting HTML
+func wantsANSI(c *fiber.Ctx) bool {
+	if q := c.Query("ansi"); q != "" {
+		return q == "true"
+	}
+
+	if !config.Config().Documents.ANSIForTerminals {
+		return false
+	}
+
+	// Caches must tell terminals apart from browsers, whether or not this
+	// response is colored
+	c.Vary(fiber.HeaderUserAgent, fiber.HeaderAccept)
+
+	if strings.Contains(c.Get(fiber.HeaderAccept), "text/html") {
+		return false
+	}
+
+	for _, agent := range terminalAgents {
+		if strings.HasPrefix(c.Get(fiber.HeaderUserAgent), agent) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sendANSI responds with the content of `doc` colored for a terminal.
+// Content that's only served raw is sent as it is.
+func sendANSI(c *fiber.Ctx, doc *models.Document) error {
+	content := doc.Content
+
+	if !RawOnly(content) {
+		content = ansi.Highlight(content, doc.Extension)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+
+	return c.Status(200).SendString(content)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/domain"
+)
+
+// maxBatchSize is how many documents can be fetched at once
+const maxBatchSize = 50
+
+// BatchEntry is the result of fetching one of the documents of a batch,
+// either the document or why it couldn't be fetched
+type BatchEntry struct {
+	ID       string          `json:"id"`
+	Document *domain.Payload `json:"document,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// registerBatch loads the endpoint fetching several documents at once,
+// e.g. `?ids=a,b,c`
+func registerBatch(api fiber.Router, fetchLimit fiber.Handler) {
+	api.Get("/", fetchLimit, func(c *fiber.Ctx) error {
+		ids := []string{}
+		seen := map[string]bool{}
+
+		for _, id := range strings.Split(c.Query("ids"), ",") {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) == 0 || len(ids) > maxBatchSize {
+			return fiber.NewError(400, fmt.Sprintf("ids must list between 1 and %d document IDs", maxBatchSize))
+		}
+
+		valid := []string{}
+
+		for _, id := range ids {
+			if ValidID(id) {
+				valid = append(valid, id)
+			}
+		}
+
+		documents, err := GetDocuments(c.UserContext(), auth.FromRequest(c), valid)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		tags, err := GetTags(c.UserContext(), valid...)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		found := make(map[string]*models.Document, len(documents))
+
+		for i := range documents {
+			found[documents[i].ID] = &documents[i]
+		}
+
+		entries := make([]BatchEntry, len(ids))
+
+		for i, id := range ids {
+			entries[i].ID = id
+			doc, ok := found[id]
+
+			switch {
+			case !ValidID(id):
+				entries[i].Error = "invalid document ID"
+			case !ok:
+				entries[i].Error = "document not found"
+			default:
+				viewed(c, doc, "batch")
+
+				entries[i].Document = &domain.Payload{
+					ID:           &doc.ID,
+					Content:      &doc.Content,
+					Extension:    &doc.Extension,
+					CreatedAt:    &doc.CreatedAt,
+					UpdatedAt:    &doc.UpdatedAt,
+					GistURL:      doc.GistURL,
+					Public:       doc.Public,
+					Shortened:    doc.Shortened,
+					Tags:         tags[doc.ID],
+					Organization: doc.Organization,
+					Visibility:   Visibility(doc),
+					RawOnly:      RawOnly(doc.Content),
+				}
+			}
+		}
+
+		return c.Status(200).JSON(fiber.Map{"documents": entries})
+	})
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// cache holds recently fetched documents, which are served from it while
+// the database can't be reached. Only the least recently fetched ones are
+// dropped once they take up more than `database.breaker.cache` bytes.
+var cache = struct {
+	sync.Mutex
+	size    int
+	order   *list.List // of models.Document, most recently fetched first
+	entries map[string]*list.Element
+}{
+	order:   list.New(),
+	entries: map[string]*list.Element{},
+}
+
+// remember caches `doc`, which has to include its content. Only documents
+// anyone can view are kept: other replicas never hear of a document being
+// deleted or made private, and could go on serving an outdated copy of it.
+func remember(doc *models.Document) {
+	limit := config.Config().Database.Breaker.Cache
+
+	if limit <= 0 || len(doc.Content) > limit || doc.Private {
+		return
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	forgetLocked(doc.ID)
+
+	cache.entries[doc.ID] = cache.order.PushFront(*doc)
+	cache.size += len(doc.Content)
+
+	for cache.size > limit {
+		forgetLocked(cache.order.Back().Value.(models.Document).ID)
+	}
+}
+
+// cached returns a copy of document `id` if it's in the cache
+func cached(id string) (models.Document, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	entry, ok := cache.entries[id]
+
+	if !ok {
+		return models.Document{}, false
+	}
+
+	cache.order.MoveToFront(entry)
+
+	return entry.Value.(models.Document), true
+}
+
+// forget drops document `id` from the cache, so changes to it aren't
+// hidden by an outdated copy
+func forget(id string) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	forgetLocked(id)
+}
+
+func forgetLocked(id string) {
+	entry, ok := cache.entries[id]
+
+	if !ok {
+		return
+	}
+
+	cache.order.Remove(entry)
+	delete(cache.entries, id)
+	cache.size -= len(entry.Value.(models.Document).Content)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// ErrBinary is returned for content that can't be decoded as text
+var ErrBinary = errors.New("content is binary, only text can be uploaded")
+
+// Byte order marks of the encodings Transcode recognizes
+const (
+	bomUTF8    = "\xef\xbb\xbf"
+	bomUTF16BE = "\xfe\xff"
+	bomUTF16LE = "\xff\xfe"
+)
+
+// Transcode returns `content` as UTF-8. UTF-16 with a byte order mark is
+// decoded, a UTF-8 byte order mark dropped and other text that isn't UTF-8
+// read as Latin-1. Binary content is rejected with ErrBinary, unless
+// `documents.allow_binary` keeps it as it is.
+func Transcode(content string) (string, error) {
+	switch {
+	case strings.HasPrefix(content, bomUTF8):
+		content = content[len(bomUTF8):]
+	case strings.HasPrefix(content, bomUTF16BE), strings.HasPrefix(content, bomUTF16LE):
+		content = decodeUTF16(content[2:], strings.HasPrefix(content, bomUTF16BE))
+	}
+
+	if binary(content) {
+		if config.Config().Documents.AllowBinary {
+			return content, nil
+		}
+
+		return "", ErrBinary
+	}
+
+	if utf8.ValidString(content) {
+		return content, nil
+	}
+
+	// Every byte is a valid Latin-1 character, mapping to the same code point
+	runes := make([]rune, len(content))
+
+	for i := 0; i < len(content); i++ {
+		runes[i] = rune(content[i])
+	}
+
+	return string(runes), nil
+}
+
+// binary reports whether `content` holds NUL bytes, or isn't UTF-8 and
+// holds control characters text doesn't have. Latin-1 would decode any
+// bytes, so anything else is taken for text.
+func binary(content string) bool {
+	if strings.ContainsRune(content, 0) {
+		return true
+	}
+
+	if utf8.ValidString(content) {
+		return false
+	}
+
+	for i := 0; i < len(content); i++ {
+		if b := content[i]; b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != 0x1b || b == 0x7f {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeUTF16 decodes `s`, without its byte order mark, from UTF-16. A
+// dangling last byte becomes U+FFFD.
+func decodeUTF16(s string, bigEndian bool) string {
+	units := make([]uint16, len(s)/2)
+
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+		} else {
+			units[i] = uint16(s[2*i+1])<<8 | uint16(s[2*i])
+		}
+	}
+
+	decoded := string(utf16.Decode(units))
+
+	if len(s)%2 != 0 {
+		decoded += string(utf8.RuneError)
+	}
+
+	return decoded
+}
@@ -17,77 +17,368 @@
 package document
 
 import (
-	"math/rand"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
 	"time"
+	"unicode/utf8"
 
-	"github.com/robfig/cron/v3"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
 	"github.com/spacebin-org/spirit/internal/pkg/config"
 	"github.com/spacebin-org/spirit/internal/pkg/database"
 	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+	"gorm.io/gorm"
 )
 
-var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+// alphabets random IDs can be made of, set with `documents.id_alphabet`
+var alphabets = map[string][]rune{
+	"letters":   []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+	"lowercase": []rune("abcdefghijklmnopqrstuvwxyz"),
+	"hex":       []rune("0123456789abcdef"),
+	"base58":    []rune("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"),
+}
+
+// ErrNoFreeID is returned when every generated ID was already taken
+var ErrNoFreeID = errors.New("couldn't generate an unused document ID")
+
+// ErrQuotaExceeded is returned when a document's organization already has
+// as many documents as its quota allows
+var ErrQuotaExceeded = errors.New("organization has reached its document quota")
+
+// contentChunk is how many characters of a document StreamContent reads
+// from the database at once
+const contentChunk = 1 << 20
 
-// CreateID generates a random string of length `length` using the unix timestamp
+// CreateID generates a random string of length `length` from the
+// `documents.id_alphabet`
 func CreateID(length int) string {
-	rand.Seed(time.Now().UnixNano())
+	return randomString(alphabets[config.Config().Documents.IDAlphabet], length)
+}
 
-	b := make([]rune, length)
+// GetDocument retrieves a document record from the database via `id` for
+// `identity`, which is nil for anonymous requests. Quarantined documents,
+// ones in the trash, expired ones the sweep hasn't deleted yet and private
+// ones `identity` can't view are reported as not found. Private documents
+// can also be viewed with a share token or URL signature in `ctx`.
+func GetDocument(ctx context.Context, identity *auth.Identity, id string) (*models.Document, error) {
+	document, err := getDocument(ctx, database.DBConn.WithContext(ctx), identity, id)
 
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+	if err == nil {
+		remember(document)
 	}
 
-	return string(b)
+	return document, err
+}
+
+// GetDocumentInfo is GetDocument without loading the content, which can
+// then be read with StreamContent
+func GetDocumentInfo(ctx context.Context, identity *auth.Identity, id string) (*models.Document, error) {
+	return getDocument(ctx, database.DBConn.WithContext(ctx).Omit("content"), identity, id)
 }
 
-// GetDocument retrieves a document record from the database via `id`
-func GetDocument(id string) (*models.Document, error) {
+// ContentSize returns the length of the content of document `id` in bytes,
+// without loading it
+func ContentSize(ctx context.Context, id string) (int64, error) {
+	var size int64
+	err := database.DBConn.WithContext(ctx).Model(&models.Document{}).
+		Select(database.ByteLength("content")).Where("id = ?", id).Row().Scan(&size)
+
+	return size, err
+}
+
+// StreamContent writes the content of document `id` to `w`, reading it from
+// the database a chunk at a time so large documents are never held in
+// memory whole. The chunks are read in one transaction, so an edit made
+// meanwhile can't be mixed into them.
+func StreamContent(ctx context.Context, w io.Writer, id string) error {
+	snapshot := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
+	// Not retried, part of the content may have been written already
+	return database.DBConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// SUBSTR counts from 1 in every supported database
+		for offset := 1; ; offset += contentChunk {
+			var chunk string
+			err := tx.Model(&models.Document{}).
+				Select("SUBSTR(content, ?, ?)", offset, contentChunk).Where("id = ?", id).Row().Scan(&chunk)
+
+			if err != nil {
+				return err
+			}
+
+			if _, err := io.WriteString(w, chunk); err != nil {
+				return err
+			}
+
+			// A short chunk is the last one
+			if utf8.RuneCountInString(chunk) < contentChunk {
+				return nil
+			}
+		}
+	}, snapshot)
+}
+
+func getDocument(ctx context.Context, query *gorm.DB, identity *auth.Identity, id string) (*models.Document, error) {
 	document := models.Document{}
-	err := database.DBConn.Where("id = ?", id).First(&document)
+	err := query.Where("id = ?", id).First(&document).Error
 
-	return &document, err.Error
+	// Recently fetched documents are still served while the database can't
+	// be reached, the checks below apply to them all the same
+	if database.Unavailable(err) {
+		if doc, ok := cached(id); ok {
+			document, err = doc, nil
+		}
+	}
+
+	if err != nil {
+		return &document, err
+	}
+
+	// Retention rules with a min_size need the size of documents loaded
+	// without their content
+	if document.Content == "" && retention.NeedsSize() {
+		if document.ContentSize, err = ContentSize(ctx, id); err != nil {
+			return &document, err
+		}
+	}
+
+	return &document, servable(ctx, identity, &document, time.Now())
 }
 
-// NewDocument creates a new document record in the database
-func NewDocument(content string, extension string) (string, error) {
-	id := CreateID(config.Config.Documents.IDLength)
+// servable returns gorm.ErrRecordNotFound unless `doc` may be served to
+// `identity` at `now`. Quarantined documents, ones in the trash, expired
+// ones the sweep hasn't deleted yet, private ones `identity` can't view and
+// ones a fetch hook hides are all reported as not found.
+func servable(ctx context.Context, identity *auth.Identity, doc *models.Document, now time.Time) error {
+	if doc.Moderation == models.ModerationQuarantined || doc.DeletedAt != 0 || retention.Expired(doc, now) {
+		return gorm.ErrRecordNotFound
+	}
 
-	doc := models.Document{
-		ID:        id,
-		Content:   content,
-		Extension: extension,
+	// Private documents aren't told apart from missing ones
+	if !CanView(identity, doc) && !shared(ctx, doc) && !signed(ctx, doc) {
+		return gorm.ErrRecordNotFound
 	}
 
-	// Create new record in database
-	res := database.DBConn.Create(&doc)
+	// Why a hook hid the document is none of the client's business
+	if runFetchHooks(ctx, identity, doc) != nil {
+		return gorm.ErrRecordNotFound
+	}
 
-	return doc.ID, res.Error
+	return nil
 }
 
-// ExpireDocument registers a cron job to delete documents after they get too old
-func ExpireDocument() *cron.Cron {
-	c := cron.New()
+// GetDocuments retrieves the documents `ids` in the same order, leaving out
+// those GetDocument would report as not found to `identity`
+func GetDocuments(ctx context.Context, identity *auth.Identity, ids []string) ([]models.Document, error) {
+	documents := []models.Document{}
+	err := database.DBConn.WithContext(ctx).
+		Where("id IN ? AND moderation <> ? AND deleted_at = 0", ids, models.ModerationQuarantined).
+		Find(&documents).Error
 
-	c.AddFunc("@every 3hr", func() {
-		model := database.DBConn.Model(&models.Document{})
-		row, err := model.Rows()
+	// Like GetDocument, cached documents are served while the database
+	// can't be reached
+	if database.Unavailable(err) {
+		documents, err = documents[:0], nil
 
-		if err != nil {
-			panic(err)
+		for _, id := range ids {
+			if doc, ok := cached(id); ok {
+				documents = append(documents, doc)
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.Document, len(documents))
+	now := time.Now()
+
+	for _, doc := range documents {
+		if servable(ctx, identity, &doc, now) == nil {
+			byID[doc.ID] = doc
+		}
+	}
+
+	ordered := make([]models.Document, 0, len(byID))
+
+	for _, id := range ids {
+		if doc, ok := byID[id]; ok {
+			ordered = append(ordered, doc)
 		}
+	}
 
-		for row.Next() {
-			document := models.Document{}
-			database.DBConn.ScanRows(row, &document)
+	return ordered, nil
+}
 
-			if time.Now().Unix()-document.CreatedAt >= config.Config.Documents.MaxAge {
-				database.DBConn.Delete(document)
+// GetPublicDocuments retrieves the `limit` most recent public documents
+// owned by `owner`, leaving out quarantined and expired ones
+func GetPublicDocuments(ctx context.Context, owner string, limit int) ([]models.Document, error) {
+	return publicDocuments(database.DBConn.WithContext(ctx).Where("owner = ?", owner), 0, limit)
+}
+
+// ListPublicDocuments retrieves a page of the most recent public documents.
+// Expired documents the sweep hasn't deleted yet are left out, so a page
+// can be shorter than `limit`.
+func ListPublicDocuments(ctx context.Context, offset, limit int) ([]models.Document, error) {
+	return publicDocuments(database.DBConn.WithContext(ctx), offset, limit)
+}
+
+// CountPublicDocuments counts the public documents that aren't quarantined
+// or in the trash, including expired ones the sweep hasn't deleted yet
+func CountPublicDocuments(ctx context.Context) (int64, error) {
+	var count int64
+	err := database.DBConn.WithContext(ctx).Model(&models.Document{}).
+		Where("public = ? AND moderation <> ? AND deleted_at = 0", true, models.ModerationQuarantined).Count(&count).Error
+
+	return count, err
+}
+
+// publicDocuments narrows `query` down to servable public documents
+func publicDocuments(query *gorm.DB, offset, limit int) ([]models.Document, error) {
+	documents := []models.Document{}
+	err := query.Where("public = ? AND moderation <> ? AND deleted_at = 0", true, models.ModerationQuarantined).
+		Order("created_at DESC").Offset(offset).Limit(limit).Find(&documents).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	visible := documents[:0]
+
+	for i := range documents {
+		if !retention.Expired(&documents[i], now) {
+			visible = append(visible, documents[i])
+		}
+	}
+
+	return visible, nil
+}
+
+// NewDocument creates a new document record in the database, tagged with
+// `tags`, the ID of `doc` is generated. Taken and reserved IDs are
+// generated again up to `documents.id_retries` times. Documents of an
+// organization at its quota fail with ErrQuotaExceeded.
+func NewDocument(ctx context.Context, doc models.Document, tags []string) (string, error) {
+	quota := 0
+
+	if doc.Organization != "" {
+		quota = OrganizationQuota(doc.Organization)
+	}
+
+	doc.ContentHash = models.HashContent(doc.Content)
+
+	var opts []*sql.TxOptions
+
+	// Documents created at the same time can't both take the last place
+	// in the quota, one of them is retried and counts again
+	if quota > 0 {
+		opts = append(opts, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	}
+
+	for attempt := 0; attempt <= config.Config().Documents.IDRetries; attempt++ {
+		doc.ID = documentID(&doc)
+
+		if Reserved(doc.ID) {
+			continue
+		}
+
+		// The document and its tags are stored together, or not at all. A
+		// taken ID is only noticed by the insert failing, checking first
+		// would race with other requests.
+		taken := false
+		err := database.Transaction(ctx, func(tx *gorm.DB) error {
+			if quota > 0 {
+				count, err := countOrganizationDocuments(tx, doc.Organization)
+
+				if err != nil {
+					return err
+				}
+
+				if count >= int64(quota) {
+					return ErrQuotaExceeded
+				}
 			}
 
+			if err := tx.Create(&doc).Error; err != nil {
+				taken = database.Duplicate(err)
+				return err
+			}
+
+			return SetTags(tx, doc.ID, tags)
+		}, opts...)
+
+		if taken {
 			continue
 		}
-	})
 
-	return c
+		return doc.ID, err
+	}
+
+	return "", ErrNoFreeID
+}
+
+// ExpireDocuments deletes documents once the retention policy says they've
+// expired. Only what the policy looks at is read, never the content.
+func ExpireDocuments(ctx context.Context) error {
+	columns := "id, owner, created_at, expires_at"
+	sized := retention.NeedsSize()
+
+	if sized {
+		columns += ", " + database.ByteLength("content")
+	}
+
+	rows, err := database.DBConn.WithContext(ctx).Model(&models.Document{}).Select(columns).Rows()
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	now := time.Now()
+	expired := []models.Document{}
+
+	for rows.Next() {
+		document := models.Document{}
+		fields := []interface{}{&document.ID, &document.Owner, &document.CreatedAt, &document.ExpiresAt}
+
+		if sized {
+			fields = append(fields, &document.ContentSize)
+		}
+
+		if err := rows.Scan(fields...); err != nil {
+			return err
+		}
+
+		if retention.Expired(&document, now) {
+			expired = append(expired, document)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	for i := range expired {
+		document := &expired[i]
+		err := database.Transaction(ctx, func(tx *gorm.DB) error {
+			_, err := retention.Purge(tx, []string{document.ID})
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		events.Publish(ctx, events.Event{Type: events.Expired, Document: document, Actor: audit.SystemActor})
+	}
+
+	return nil
 }
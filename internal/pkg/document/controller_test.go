@@ -0,0 +1,61 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+func TestExpireDocuments(t *testing.T) {
+	now := time.Now().Unix()
+	openDatabase(t,
+		models.Document{ID: "fresh000", Content: "a", CreatedAt: now},
+		models.Document{ID: "expiring", Content: "a", CreatedAt: now - 100, ExpiresAt: now - 1},
+		models.Document{ID: "largeold", Content: strings.Repeat("a", 2048), CreatedAt: now - 100},
+		models.Document{ID: "smallold", Content: "a", CreatedAt: now - 100},
+		models.Document{ID: "ownedold", Content: strings.Repeat("a", 2048), Owner: "alice", CreatedAt: now - 100},
+	)
+
+	configtest.Reload(t, `
+[[retention.rules]]
+name = "large"
+creator = "anonymous"
+min_size = 1024
+max_age = 60
+`)
+
+	if err := ExpireDocuments(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	kept := []string{}
+
+	if err := database.DBConn.Model(&models.Document{}).Order("id").Pluck("id", &kept).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(kept, ","), "fresh000,ownedold,smallold"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+}
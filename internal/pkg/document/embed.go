@@ -0,0 +1,227 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/domain"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// embedLine is a line of a document in an embed, with the notes of the
+// annotations starting on it
+type embedLine struct {
+	Text      string
+	Annotated bool
+	Notes     []template.HTML
+}
+
+// embedLines splits `content` into lines and places `annotations` next to
+// them as margin notes
+func embedLines(content string, annotations []domain.Annotation) []embedLine {
+	text := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	lines := make([]embedLine, len(text))
+
+	for i := range text {
+		lines[i].Text = text[i]
+	}
+
+	for _, a := range annotations {
+		// Annotations are checked against the content when they're made,
+		// which never changes afterwards
+		if a.StartLine < 1 || a.EndLine > len(lines) {
+			continue
+		}
+
+		// Rendered markdown has all user HTML escaped
+		lines[a.StartLine-1].Notes = append(lines[a.StartLine-1].Notes, template.HTML(a.HTML))
+
+		for i := a.StartLine - 1; i < a.EndLine; i++ {
+			lines[i].Annotated = true
+		}
+	}
+
+	return lines
+}
+
+// embedPolicy lets any site frame embeds while still blocking scripts
+const embedPolicy = "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors *;"
+
+// embedThemes are the colors embeds can be rendered with, as
+// background, foreground, gutter
+var embedThemes = map[string][3]string{
+	"light": {"#ffffff", "#24292e", "#959da5"},
+	"dark":  {"#0d1117", "#c9d1d9", "#6e7681"},
+}
+
+// EmbedThemes returns the names of the themes embeds can be rendered with
+func EmbedThemes() []string {
+	names := make([]string, 0, len(embedThemes))
+
+	for name := range embedThemes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+var embedPage = template.Must(template.New("embed").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+html,body{margin:0;background:{{index .Theme 0}};color:{{index .Theme 1}}}
+.spacebin{overflow:auto;{{if .Height}}max-height:{{.Height}}px;{{end}}font:13px/18px ui-monospace,SFMono-Regular,Menlo,Consolas,monospace}
+table{border-collapse:collapse}
+td{padding:0 8px;white-space:pre;vertical-align:top}
+td:first-child{color:{{index .Theme 2}};text-align:right;user-select:none}
+.annotated td:nth-child(2){background:rgba(210,153,34,.15)}
+.note{white-space:normal;font:12px/16px sans-serif;max-width:260px;border-left:2px solid {{index .Theme 2}}}
+.note p{margin:0 0 4px}
+.opaque{padding:16px 8px;font:13px sans-serif}
+.footer{padding:4px 8px;font:12px sans-serif;border-top:1px solid {{index .Theme 2}}}
+.footer a{color:inherit}
+</style>
+</head>
+<body>
+<div class="spacebin">{{if .Opaque}}<div class="opaque">This document is encrypted, binary or too long to be shown, {{.Size}} bytes. <a href="{{.Link}}" target="_blank" rel="noopener" download>Download it</a></div>{{else}}<table>{{range $i, $line := .Lines}}<tr{{if $line.Annotated}} class="annotated"{{end}}><td>{{inc $i}}</td><td>{{$line.Text}}</td>{{if $.Annotated}}<td class="note">{{range $line.Notes}}{{.}}{{end}}</td>{{end}}</tr>{{end}}</table>{{end}}</div>
+<div class="footer"><a href="{{.Link}}" target="_blank" rel="noopener">{{.Title}}</a>{{range .Tags}} #{{.}}{{end}} hosted on Spacebin</div>
+</body>
+</html>
+`))
+
+// embedScript inserts an embed frame after the script tag loading it, e.g.
+// <script src=".../embed.js" data-document="ID" data-height="300" data-theme="dark"></script>
+const embedScript = `(function () {
+	var script = document.currentScript;
+	if (!script || !script.dataset.document) return;
+	var query = [];
+	if (script.dataset.height) query.push("height=" + encodeURIComponent(script.dataset.height));
+	if (script.dataset.theme) query.push("theme=" + encodeURIComponent(script.dataset.theme));
+	var frame = document.createElement("iframe");
+	frame.src = new URL("/embed/" + encodeURIComponent(script.dataset.document), script.src).href + (query.length ? "?" + query.join("&") : "");
+	frame.style.width = "100%";
+	frame.style.border = "0";
+	frame.height = (parseInt(script.dataset.height, 10) || 400) + 30;
+	script.parentNode.insertBefore(frame, script.nextSibling);
+})();
+`
+
+// registerEmbed loads the frameable document view and the script
+// inserting it into other pages
+func registerEmbed(app *fiber.App, fetchLimit fiber.Handler) {
+	app.Get("/embed.js", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "application/javascript; charset=utf-8")
+		c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+
+		return c.Status(200).SendString(embedScript)
+	})
+
+	app.Get("/embed/:document", fetchLimit, func(c *fiber.Ctx) error {
+		id := c.Params("document")
+
+		if !ValidID(id) {
+			return fiber.NewError(400)
+		}
+
+		doc, err := GetDocument(c.UserContext(), auth.FromRequest(c), id)
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		tags, err := GetTags(c.UserContext(), doc.ID)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		// Ciphertext, binary blobs and overly long content are never split
+		// into lines
+		opaque := RawOnly(doc.Content)
+
+		var annotations []domain.Annotation
+
+		if !opaque {
+			annotations, err = GetAnnotations(c.UserContext(), doc.ID)
+
+			if err != nil {
+				return fiber.NewError(500, err.Error())
+			}
+		}
+
+		theme, ok := embedThemes[c.Query("theme", "light")]
+
+		if !ok {
+			return fiber.NewError(400, "theme must be light or dark")
+		}
+
+		height := 0
+
+		if h := c.Query("height"); h != "" {
+			height, err = strconv.Atoi(h)
+
+			if err != nil || height < 50 || height > 2000 {
+				return fiber.NewError(400, "height must be between 50 and 2000")
+			}
+		}
+
+		var lines []embedLine
+
+		if !opaque {
+			lines = embedLines(doc.Content, annotations)
+		}
+
+		var b strings.Builder
+
+		err = embedPage.Execute(&b, map[string]interface{}{
+			"Title":     doc.ID + "." + FileExtension(doc.Extension),
+			"Link":      links.Document(links.Base(c), doc.ID),
+			"Lines":     lines,
+			"Opaque":    opaque,
+			"Size":      len(doc.Content),
+			"Annotated": len(annotations) > 0,
+			"Theme":     theme,
+			"Height":    height,
+			"Tags":      tags[doc.ID],
+		})
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		viewed(c, doc, "embed")
+
+		// Embeds are meant to be framed by other sites
+		c.Response().Header.Del(fiber.HeaderXFrameOptions)
+		c.Set(fiber.HeaderContentSecurityPolicy, embedPolicy)
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+
+		return c.Status(200).SendString(b.String())
+	})
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"github.com/spacebin-org/spirit/internal/pkg/metrics"
+)
+
+// auditedEvents are the audit actions events are recorded as
+var auditedEvents = map[string]string{
+	events.Deleted:  audit.DocumentDeleted,
+	events.Restored: audit.DocumentRestored,
+}
+
+func init() {
+	events.Subscribe(func(ctx context.Context, event events.Event) {
+		metrics.DocumentsCreated.Inc()
+	}, events.Created)
+
+	events.Subscribe(func(ctx context.Context, event events.Event) {
+		metrics.DocumentsFetched.Inc(event.Detail)
+		recordView(event.Document)
+	}, events.Viewed)
+
+	events.Subscribe(func(ctx context.Context, event events.Event) {
+		audit.Record(ctx, models.AuditEvent{
+			Actor:  event.Actor,
+			Action: auditedEvents[event.Type],
+			Target: "document:" + event.Document.ID,
+			IP:     event.IP,
+			Detail: event.Detail,
+		})
+	}, events.Deleted, events.Restored)
+
+	events.Subscribe(func(ctx context.Context, event events.Event) {
+		forget(event.Document.ID)
+	}, events.Updated, events.Deleted, events.Expired, events.Purged)
+}
+
+// newEvent is an event of type `t` on `doc` caused by `identity`, which is
+// nil for anonymous requests, from `ip`
+func newEvent(t string, doc *models.Document, identity *auth.Identity, ip net.IP) events.Event {
+	event := events.Event{Type: t, Document: doc, Actor: "anonymous"}
+
+	if identity != nil {
+		event.Actor = identity.Name
+	}
+
+	if ip != nil {
+		event.IP = ip.String()
+	}
+
+	return event
+}
+
+// publish sends an event of type `t` on `doc` caused by the request, with
+// `detail`
+func publish(c *fiber.Ctx, t string, doc *models.Document, detail string) {
+	event := newEvent(t, doc, auth.FromRequest(c), clientip.IP(c))
+	event.Detail = detail
+
+	events.Publish(c.UserContext(), event)
+}
+
+// viewed publishes that `doc` was fetched, `via` is the kind of fetch
+func viewed(c *fiber.Ctx, doc *models.Document, via string) {
+	publish(c, events.Viewed, doc, via)
+}
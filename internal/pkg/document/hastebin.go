@@ -0,0 +1,102 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/spam"
+)
+
+// registerHastebin loads endpoints with the same paths and request and
+// response shapes as hastebin, so its clients work unchanged
+func registerHastebin(app *fiber.App, createChain []fiber.Handler, fetchLimit fiber.Handler, filters spam.Pipeline) {
+	// The whole body is the document
+	app.Post("/documents", append(createChain, func(c *fiber.Ctx) error {
+		id, err := Create(c.UserContext(), filters, &CreateRequest{
+			Content:   string(c.Body()),
+			Extension: "none",
+		}, auth.FromRequest(c), clientip.IP(c))
+
+		if err != nil {
+			return hastebinError(c, err)
+		}
+
+		return c.Status(200).JSON(fiber.Map{"key": id})
+	})...)
+
+	app.Get("/documents/:id", fetchLimit, func(c *fiber.Ctx) error {
+		id := hastebinKey(c.Params("id"))
+
+		if !ValidID(id) {
+			return c.Status(404).JSON(fiber.Map{"message": "Document not found."})
+		}
+
+		document, err := GetDocument(c.UserContext(), auth.FromRequest(c), id)
+
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"message": "Document not found."})
+		}
+
+		viewed(c, document, "hastebin")
+
+		return c.Status(200).JSON(fiber.Map{"key": document.ID, "data": document.Content})
+	})
+
+	app.Get("/raw/:id", fetchLimit, withSignature, func(c *fiber.Ctx) error {
+		id := hastebinKey(c.Params("id"))
+
+		if !ValidID(id) {
+			return c.Status(404).JSON(fiber.Map{"message": "Document not found."})
+		}
+
+		document, err := GetDocument(c.UserContext(), auth.FromRequest(c), id)
+
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"message": "Document not found."})
+		}
+
+		viewed(c, document, "raw")
+
+		if wantsANSI(c) {
+			return sendANSI(c, document)
+		}
+
+		setContentType(c, document.Extension)
+
+		return c.Status(200).SendString(document.Content)
+	})
+}
+
+// hastebinKey strips the file extension hastebin clients add to keys
+func hastebinKey(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+// hastebinError responds with an error in hastebin's `{"message": ...}` shape
+func hastebinError(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+
+	if e, ok := err.(*fiber.Error); ok {
+		code = e.Code
+	}
+
+	return c.Status(code).JSON(fiber.Map{"message": err.Error()})
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// CreateHook is run on every document about to be stored, after it passed
+// validation and content filters. Hooks may change `doc`, returning an
+// error refuses to create it: a *fiber.Error is sent to the client as it
+// is, anything else as a 400.
+type CreateHook func(ctx context.Context, identity *auth.Identity, doc *models.Document) error
+
+// FetchHook is run on every document before it's served to `identity`,
+// which is nil for anonymous requests. The content isn't loaded when only
+// the document's details are needed. Returning an error hides the document,
+// it's then reported as not found.
+type FetchHook func(ctx context.Context, identity *auth.Identity, doc *models.Document) error
+
+var (
+	createHooks []CreateHook
+	fetchHooks  []FetchHook
+)
+
+// OnDocumentCreate registers `hook` to run when documents are created, in
+// the order hooks were registered. Plugins must register their hooks
+// before the server starts.
+func OnDocumentCreate(hook CreateHook) {
+	createHooks = append(createHooks, hook)
+}
+
+// OnDocumentFetch registers `hook` to run when documents are fetched, in
+// the order hooks were registered. Plugins must register their hooks
+// before the server starts.
+func OnDocumentFetch(hook FetchHook) {
+	fetchHooks = append(fetchHooks, hook)
+}
+
+func runCreateHooks(ctx context.Context, identity *auth.Identity, doc *models.Document) error {
+	for _, hook := range createHooks {
+		if err := hook(ctx, identity, doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runFetchHooks(ctx context.Context, identity *auth.Identity, doc *models.Document) error {
+	for _, hook := range fetchHooks {
+		if err := hook(ctx, identity, doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
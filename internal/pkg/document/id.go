@@ -0,0 +1,256 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// Formats of document IDs, set with `documents.id_format`
+const (
+	IDRandom = "random" // e.g. "pRoGSAsE", `documents.id_length` characters of `documents.id_alphabet`
+	IDWords  = "words"  // e.g. "ocean-falcon-42", or "ocean-falcon-42-7fKq2mXa" for documents that aren't public
+	IDUUID   = "uuid"   // UUIDv7, sortable by creation time
+	IDNanoID = "nanoid" // 21 URL-safe characters
+)
+
+// nanoIDAlphabet is the URL-safe alphabet nanoid uses
+const nanoIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-"
+
+// wordSuffixLength is how many base58 characters are added to word IDs of
+// documents that aren't public. Two words and a number only make about 5.8
+// million IDs, few enough to find every unlisted document by trying them.
+const wordSuffixLength = 8
+
+// uuidPattern matches UUIDv7s in their canonical, lowercase form
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// idFormat creates IDs of one format and recognizes them
+type idFormat struct {
+	create func() string
+	valid  func(id string) bool
+}
+
+var idFormats = map[string]idFormat{
+	IDRandom: {
+		create: func() string {
+			return CreateID(config.Config().Documents.IDLength)
+		},
+		valid: func(id string) bool {
+			if !acceptedLength(len(id)) {
+				return false
+			}
+
+			// Any alphabet is accepted, so links keep working after it's changed
+			for _, r := range id {
+				if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+					return false
+				}
+			}
+
+			return true
+		},
+	},
+	IDWords: {
+		create: func() string {
+			return fmt.Sprintf("%s-%s-%02d", words[randomIndex(len(words))], words[randomIndex(len(words))], randomIndex(100))
+		},
+		valid: func(id string) bool {
+			parts := strings.Split(id, "-")
+
+			if len(parts) == 4 && isSuffix(parts[3]) {
+				parts = parts[:3]
+			}
+
+			if len(parts) != 3 || len(parts[2]) != 2 || !isWord(parts[0]) || !isWord(parts[1]) {
+				return false
+			}
+
+			return parts[2][0] >= '0' && parts[2][0] <= '9' && parts[2][1] >= '0' && parts[2][1] <= '9'
+		},
+	},
+	IDUUID: {
+		create: uuidV7,
+		valid:  uuidPattern.MatchString,
+	},
+	IDNanoID: {
+		create: nanoID,
+		valid: func(id string) bool {
+			if len(id) != 21 {
+				return false
+			}
+
+			for _, r := range id {
+				if !strings.ContainsRune(nanoIDAlphabet, r) {
+					return false
+				}
+			}
+
+			return true
+		},
+	},
+}
+
+// uuidV7 creates a UUIDv7: a millisecond timestamp followed by random bits
+func uuidV7() string {
+	var b [16]byte
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+
+	b[6] = b[6]&0x0f | 0x70 // Version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// nanoID creates a nanoid with the default length and alphabet
+func nanoID() string {
+	var b [21]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	// The alphabet has 64 characters, so masking keeps the choice uniform
+	for i := range b {
+		b[i] = nanoIDAlphabet[b[i]&63]
+	}
+
+	return string(b[:])
+}
+
+// randomIndex returns a uniformly random number in [0, n)
+func randomIndex(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return int(i.Int64())
+}
+
+// randomString returns `length` random characters of `alphabet`
+func randomString(alphabet []rune, length int) string {
+	b := make([]rune, length)
+
+	for i := range b {
+		b[i] = alphabet[randomIndex(len(alphabet))]
+	}
+
+	return string(b)
+}
+
+var wordSet = map[string]bool{}
+
+func init() {
+	for _, word := range words {
+		wordSet[word] = true
+	}
+}
+
+func isWord(s string) bool {
+	return wordSet[s]
+}
+
+func isSuffix(s string) bool {
+	if len(s) != wordSuffixLength {
+		return false
+	}
+
+	for _, r := range s {
+		if !strings.ContainsRune(string(alphabets["base58"]), r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// acceptedLength reports whether random IDs of `length` are served, which
+// are ones of `documents.id_length` or any of `documents.accepted_id_lengths`
+func acceptedLength(length int) bool {
+	if length == config.Config().Documents.IDLength {
+		return true
+	}
+
+	for _, accepted := range config.Config().Documents.AcceptedIDLengths {
+		if length == accepted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reserved reports whether `id` is on `documents.reserved_ids`, so it
+// can't be given to a document
+func Reserved(id string) bool {
+	for _, reserved := range config.Config().Documents.ReservedIDs {
+		if strings.EqualFold(id, reserved) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewID creates an ID in the format set by `documents.id_format`
+func NewID() string {
+	return idFormats[config.Config().Documents.IDFormat].create()
+}
+
+// documentID creates the ID of the new document `doc`. Word IDs of
+// documents that aren't public get a random suffix, so they can't be
+// guessed.
+func documentID(doc *models.Document) string {
+	id := NewID()
+
+	if config.Config().Documents.IDFormat == IDWords && !doc.Public {
+		id += "-" + randomString(alphabets["base58"], wordSuffixLength)
+	}
+
+	return id
+}
+
+// ValidID reports whether `id` could belong to a document. IDs of every
+// format are accepted, so links keep working after the format is changed.
+func ValidID(id string) bool {
+	for _, format := range idFormats {
+		if format.valid(id) {
+			return true
+		}
+	}
+
+	return false
+}
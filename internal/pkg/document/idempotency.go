@@ -0,0 +1,206 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+	"github.com/spacebin-org/spirit/internal/pkg/timeout"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxIdempotencyKeyLength is how long an Idempotency-Key header can be
+const maxIdempotencyKeyLength = 255
+
+// created describes a document in the response to the request creating it
+type created struct {
+	id          string
+	contentHash string
+	normalized  []string // Transforms applied to the content.
+}
+
+// idempotent runs `create` and returns the document it made. If the
+// request carries an Idempotency-Key header the caller already sent within
+// `documents.idempotency_window`, the document created back then is
+// returned instead, without running `create` again. The key is reserved
+// before `create` runs, so concurrent retries can't both create one.
+func idempotent(c *fiber.Ctx, create func() (created, error)) (created, error) {
+	header := c.Get("Idempotency-Key")
+	window := config.Config().Documents.IdempotencyWindow
+
+	if header == "" || window == 0 {
+		return create()
+	}
+
+	if len(header) > maxIdempotencyKeyLength {
+		return created{}, fiber.NewError(400, "Idempotency-Key can't be longer than 255 characters")
+	}
+
+	// Keys are scoped to whoever sent them, so nobody can claim the
+	// documents of someone else by guessing their keys
+	caller := "ip:" + clientip.IP(c).String()
+
+	if identity := auth.FromRequest(c); identity != nil {
+		caller = "token:" + identity.Name
+	}
+
+	// Routes like POST / take options from the query, so it's part of
+	// what has to match
+	key := sha256.Sum256([]byte(caller + "\n" + header))
+	request := sha256.Sum256(append([]byte(c.OriginalURL()+"\n"), c.Body()...))
+	row := models.IdempotencyKey{
+		KeyHash:     hex.EncodeToString(key[:]),
+		CallerHash:  models.HashCaller(caller),
+		RequestHash: hex.EncodeToString(request[:]),
+		CreatedAt:   time.Now().Unix(),
+	}
+
+	db := database.DBConn.WithContext(c.UserContext())
+
+	// An expired key may still be stored until it's pruned. A reservation
+	// that outlived its request was left behind by a crash, and is taken
+	// over too.
+	err := db.Where("key_hash = ? AND (created_at <= ? OR (document_id = '' AND created_at <= ?))",
+		row.KeyHash, row.CreatedAt-window, row.CreatedAt-reservationAge()).
+		Delete(&models.IdempotencyKey{}).Error
+
+	if err != nil {
+		return created{}, fiber.NewError(500, err.Error())
+	}
+
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+
+	if res.Error != nil {
+		return created{}, fiber.NewError(500, res.Error.Error())
+	}
+
+	if res.RowsAffected == 0 {
+		return replay(c, row)
+	}
+
+	// The request's context may have timed out by now, the key has to be
+	// released or filled in regardless
+	ctx, cancel := timeout.Detach(c)
+	defer cancel()
+
+	doc, err := create()
+
+	if err != nil {
+		// Let the request be tried again with the same key
+		release := database.DBConn.WithContext(ctx).
+			Where("key_hash = ? AND document_id = ''", row.KeyHash).Delete(&models.IdempotencyKey{}).Error
+
+		if release != nil {
+			log.Printf("Couldn't release an Idempotency-Key: %v", release)
+		}
+
+		return created{}, err
+	}
+
+	err = database.DBConn.WithContext(ctx).Model(&models.IdempotencyKey{}).Where("key_hash = ?", row.KeyHash).
+		Updates(map[string]interface{}{"document_id": doc.id, "normalized": strings.Join(doc.normalized, ",")}).Error
+
+	if err != nil {
+		return created{}, fiber.NewError(500, err.Error())
+	}
+
+	return doc, nil
+}
+
+// reservationAge is how many seconds a request creating a document can
+// hold its Idempotency-Key for. Without a timeout for creating documents
+// there's no telling, so the key is kept for the whole window.
+func reservationAge() int64 {
+	timeouts := config.Config().Server.Timeouts
+
+	if timeouts.Create == 0 {
+		return config.Config().Documents.IdempotencyWindow
+	}
+
+	// Rounded up, plus a second since keys are stored in whole seconds
+	return int64(timeouts.Create+999)/1000 + 1
+}
+
+// replay returns the document created by the request that reserved the key
+// of `row` first, as it's stored now
+func replay(c *fiber.Ctx, row models.IdempotencyKey) (created, error) {
+	var previous models.IdempotencyKey
+	err := database.DBConn.WithContext(c.UserContext()).Where("key_hash = ?", row.KeyHash).First(&previous).Error
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Its request failed in the meantime and released the key
+		return created{}, fiber.NewError(409, "a request with this Idempotency-Key failed just now, try again")
+	case err != nil:
+		return created{}, fiber.NewError(500, err.Error())
+	case previous.RequestHash != row.RequestHash:
+		return created{}, fiber.NewError(422, "Idempotency-Key was already used for a different request")
+	case previous.DocumentID == "":
+		return created{}, fiber.NewError(409, "a request with this Idempotency-Key is still being processed")
+	}
+
+	doc := models.Document{}
+	err = database.DBConn.WithContext(c.UserContext()).Omit("content").Where("id = ?", previous.DocumentID).First(&doc).Error
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return created{}, fiber.NewError(500, err.Error())
+	}
+
+	if err == nil && retention.NeedsSize() {
+		if doc.ContentSize, err = ContentSize(c.UserContext(), doc.ID); err != nil {
+			return created{}, fiber.NewError(500, err.Error())
+		}
+	}
+
+	// Quarantined documents are replayed like the first response pretended
+	// they were created, so spammers don't learn what gets caught
+	if doc.ID == "" || doc.DeletedAt != 0 || retention.Expired(&doc, time.Now()) {
+		return created{}, fiber.NewError(410, "the document created with this Idempotency-Key is gone")
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+
+	replayed := created{id: doc.ID, contentHash: doc.ContentHash}
+
+	if previous.Normalized != "" {
+		replayed.normalized = strings.Split(previous.Normalized, ",")
+	}
+
+	return replayed, nil
+}
+
+// PruneIdempotencyKeys deletes idempotency keys older than
+// `documents.idempotency_window`
+func PruneIdempotencyKeys(ctx context.Context) error {
+	return database.DBConn.WithContext(ctx).
+		Where("created_at <= ?", time.Now().Unix()-config.Config().Documents.IdempotencyWindow).
+		Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// idempotentApp serves a route storing the body as a document with
+// `idempotent`, and counts how many it created
+func idempotentApp(t *testing.T, creates *int) *fiber.App {
+	t.Helper()
+
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		doc, err := idempotent(c, func() (created, error) {
+			*creates++
+
+			doc := models.Document{
+				ID:          CreateID(8),
+				Content:     string(c.Body()),
+				ContentHash: models.HashContent(string(c.Body())),
+				CreatedAt:   time.Now().Unix(),
+			}
+
+			return created{id: doc.ID, contentHash: doc.ContentHash, normalized: []string{"bom"}},
+				database.DBConn.Create(&doc).Error
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return c.Status(201).JSON(fiber.Map{"id": doc.id, "hash": doc.contentHash, "normalized": doc.normalized})
+	})
+
+	return app
+}
+
+// post sends `body` to `app` with Idempotency-Key `key`
+func post(t *testing.T, app *fiber.App, key, body string) (int, map[string]interface{}, bool) {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+
+	res, err := app.Test(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := map[string]interface{}{}
+
+	if res.StatusCode == 201 {
+		if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return res.StatusCode, payload, res.Header.Get("Idempotent-Replayed") == "true"
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	openDatabase(t)
+
+	creates := 0
+	app := idempotentApp(t, &creates)
+
+	status, first, replayed := post(t, app, "one", "hello")
+
+	if status != 201 || replayed {
+		t.Fatalf("first request: status %d, replayed %v", status, replayed)
+	}
+
+	status, again, replayed := post(t, app, "one", "hello")
+
+	if status != 201 || !replayed {
+		t.Fatalf("retry: status %d, replayed %v", status, replayed)
+	}
+
+	if creates != 1 {
+		t.Errorf("created %d documents, want 1", creates)
+	}
+
+	// The response is built from the stored document
+	for _, field := range []string{"id", "hash", "normalized"} {
+		if got, want := jsonString(again[field]), jsonString(first[field]); got != want {
+			t.Errorf("replayed %s = %s, want %s", field, got, want)
+		}
+	}
+
+	// Other keys create other documents
+	if status, _, replayed := post(t, app, "two", "hello"); status != 201 || replayed || creates != 2 {
+		t.Errorf("another key: status %d, replayed %v, %d documents created", status, replayed, creates)
+	}
+}
+
+func TestIdempotentConflict(t *testing.T) {
+	openDatabase(t)
+
+	creates := 0
+	app := idempotentApp(t, &creates)
+
+	if status, _, _ := post(t, app, "one", "hello"); status != 201 {
+		t.Fatalf("first request: status %d", status)
+	}
+
+	if status, _, _ := post(t, app, "one", "goodbye"); status != 422 {
+		t.Errorf("different body: status %d, want 422", status)
+	}
+
+	if creates != 1 {
+		t.Errorf("created %d documents, want 1", creates)
+	}
+}
+
+func TestIdempotentReservation(t *testing.T) {
+	openDatabase(t)
+
+	creates := 0
+	app := idempotentApp(t, &creates)
+
+	// A request with the key is still being processed
+	status, _, _ := post(t, app, "one", "hello")
+	reserve(t, time.Now())
+
+	if status, _, _ = post(t, app, "one", "hello"); status != 409 {
+		t.Errorf("running request: status %d, want 409", status)
+	}
+
+	if creates != 1 {
+		t.Errorf("created %d documents, want 1", creates)
+	}
+
+	// Its request outlived the timeout for creating documents
+	reserve(t, time.Now().Add(-time.Minute))
+
+	if status, _, replayed := post(t, app, "one", "hello"); status != 201 || replayed {
+		t.Errorf("abandoned request: status %d, replayed %v", status, replayed)
+	}
+
+	if creates != 2 {
+		t.Errorf("created %d documents, want 2", creates)
+	}
+}
+
+func TestIdempotentGone(t *testing.T) {
+	openDatabase(t)
+
+	creates := 0
+	app := idempotentApp(t, &creates)
+
+	_, first, _ := post(t, app, "one", "hello")
+
+	err := database.DBConn.Model(&models.Document{}).Where("id = ?", first["id"]).
+		Update("deleted_at", time.Now().Unix()).Error
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _, _ := post(t, app, "one", "hello"); status != 410 {
+		t.Errorf("trashed document: status %d, want 410", status)
+	}
+
+	if err := database.DBConn.Where("id = ?", first["id"]).Delete(&models.Document{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _, _ := post(t, app, "one", "hello"); status != 410 {
+		t.Errorf("deleted document: status %d, want 410", status)
+	}
+}
+
+// reserve turns the stored keys into reservations made at `at` by requests
+// that haven't finished
+func reserve(t *testing.T, at time.Time) {
+	t.Helper()
+
+	err := database.DBConn.Model(&models.IdempotencyKey{}).Where("1 = 1").
+		Updates(map[string]interface{}{"document_id": "", "created_at": at.Unix()}).Error
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// jsonString returns `v` encoded as JSON, to compare decoded values
+func jsonString(v interface{}) string {
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/codeimage"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+)
+
+// Limits on what's drawn into an image, longer lines are cut off
+const (
+	maxImageLines   = 100
+	maxImageColumns = 160
+)
+
+// registerImage loads the endpoint drawing a range of a document's lines
+// into a PNG, e.g. `?theme=dark&from=10&to=20`
+func registerImage(api fiber.Router, fetchLimit fiber.Handler) {
+	api.Get("/:id/image.png", features.Require(features.Image), fetchLimit, withSignature, func(c *fiber.Ctx) error {
+		if !ValidID(c.Params("id")) {
+			return fiber.NewError(400)
+		}
+
+		theme, ok := codeimage.Themes[c.Query("theme", "dark")]
+
+		if !ok {
+			return fiber.NewError(400, "theme must be light or dark")
+		}
+
+		doc, err := GetDocument(c.UserContext(), auth.FromRequest(c), c.Params("id"))
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		if RawOnly(doc.Content) {
+			return fiber.NewError(422, "document is encrypted, binary or too long to be rendered")
+		}
+
+		lines := strings.Split(strings.TrimSuffix(doc.Content, "\n"), "\n")
+		from, err := strconv.Atoi(c.Query("from", "1"))
+
+		if err != nil || from < 1 || from > len(lines) {
+			return fiber.NewError(400, fmt.Sprintf("from must be between 1 and %d", len(lines)))
+		}
+
+		to, err := strconv.Atoi(c.Query("to", strconv.Itoa(from+maxImageLines-1)))
+
+		if err != nil || to < from {
+			return fiber.NewError(400, "to must be a line number after from")
+		}
+
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		if to-from+1 > maxImageLines {
+			return fiber.NewError(400, fmt.Sprintf("images can't have more than %d lines", maxImageLines))
+		}
+
+		lines = lines[from-1 : to]
+
+		for i, line := range lines {
+			if r := []rune(line); len(r) > maxImageColumns {
+				lines[i] = string(r[:maxImageColumns])
+			}
+		}
+
+		png, err := codeimage.Render(doc.ID+"."+FileExtension(doc.Extension), lines, from, theme)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		viewed(c, doc, "image")
+
+		c.Set(fiber.HeaderContentType, "image/png")
+
+		return c.Status(200).Send(png)
+	})
+}
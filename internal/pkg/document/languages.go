@@ -0,0 +1,78 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import "sort"
+
+// fileExtensions maps the extension of a document, which is really the name
+// of its highlighter, to a file extension
+var fileExtensions = map[string]string{
+	"python":        "py",
+	"javascript":    "js",
+	"jsx":           "jsx",
+	"typescript":    "ts",
+	"tsx":           "tsx",
+	"go":            "go",
+	"kotlin":        "kt",
+	"cpp":           "cpp",
+	"sql":           "sql",
+	"csharp":        "cs",
+	"c":             "c",
+	"scala":         "scala",
+	"haskell":       "hs",
+	"shell-session": "sh",
+	"bash":          "sh",
+	"powershell":    "ps1",
+	"php":           "php",
+	"asm6502":       "asm",
+	"julia":         "jl",
+	"objc":          "m",
+	"perl":          "pl",
+	"crystal":       "cr",
+	"json":          "json",
+	"yaml":          "yaml",
+	"toml":          "toml",
+	"rust":          "rs",
+	"ruby":          "rb",
+	"java":          "java",
+	"markup":        "html",
+	"markdown":      "md",
+	"css":           "css",
+}
+
+// FileExtension returns the file extension for documents highlighted as
+// `extension`, "txt" if there isn't one
+func FileExtension(extension string) string {
+	if ext, ok := fileExtensions[extension]; ok {
+		return ext
+	}
+
+	return "txt"
+}
+
+// Languages returns the extensions documents can be created with, sorted
+func Languages() []string {
+	languages := []string{"none"}
+
+	for language := range fileExtensions {
+		languages = append(languages, language)
+	}
+
+	sort.Strings(languages)
+
+	return languages
+}
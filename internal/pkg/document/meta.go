@@ -0,0 +1,88 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+)
+
+// Meta describes a document without its content
+type Meta struct {
+	ListEntry
+	Size         int64  `json:"size"` // in bytes
+	ContentHash  string `json:"content_hash"`
+	Visibility   string `json:"visibility"`
+	Organization string `json:"organization,omitempty"`
+	ExpiresAt    int64  `json:"expires_at,omitempty"` // 0 if the document is kept forever
+}
+
+// registerMeta loads the endpoint describing a document without sending
+// its content. Neither is the content loaded, its hash is stored with the
+// document and the database measures its size.
+func registerMeta(api fiber.Router, fetchLimit fiber.Handler) {
+	api.Get("/:id/meta", fetchLimit, func(c *fiber.Ctx) error {
+		if !ValidID(c.Params("id")) {
+			return fiber.NewError(400)
+		}
+
+		doc, err := GetDocumentInfo(c.UserContext(), auth.FromRequest(c), c.Params("id"))
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		// Documents from the cache come with their content
+		size := int64(len(doc.Content))
+
+		if doc.Content == "" {
+			if size, err = ContentSize(c.UserContext(), doc.ID); err != nil {
+				return fiber.NewError(500, err.Error())
+			}
+		}
+
+		// Documents restored from version 1 backups have no hash
+		if doc.ContentHash == "" {
+			if doc, err = GetDocument(c.UserContext(), auth.FromRequest(c), doc.ID); err != nil {
+				return fiber.NewError(404, err.Error())
+			}
+
+			doc.ContentHash = models.HashContent(doc.Content)
+		}
+
+		tags, err := GetTags(c.UserContext(), doc.ID)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		meta := Meta{
+			ListEntry:    NewListEntry(links.Base(c), doc),
+			Size:         size,
+			ContentHash:  doc.ContentHash,
+			Visibility:   Visibility(doc),
+			Organization: doc.Organization,
+			ExpiresAt:    retention.ExpiresAt(doc),
+		}
+		meta.Tags = tags[doc.ID]
+
+		return c.Status(200).JSON(meta)
+	})
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mimeTypes maps file extensions to the type raw content is served with.
+// HTML, XML and JavaScript are left out on purpose, browsers must never
+// render or run documents as pages or scripts of this site.
+var mimeTypes = map[string]string{
+	"json": "application/json",
+	"yaml": "application/yaml",
+	"yml":  "application/yaml",
+	"toml": "application/toml",
+	"sql":  "application/sql",
+	"svg":  "image/svg+xml",
+	"css":  "text/css",
+	"md":   "text/markdown",
+	"go":   "text/x-go",
+	"py":   "text/x-python",
+	"rs":   "text/x-rust",
+	"rb":   "text/x-ruby",
+	"c":    "text/x-c",
+	"cpp":  "text/x-c++",
+	"java": "text/x-java",
+	"sh":   "text/x-shellscript",
+}
+
+// sandboxPolicy keeps scripts in documents served as anything but plain
+// text, like SVG, from running, even when the raw URL is opened directly
+const sandboxPolicy = "default-src 'none'; style-src 'unsafe-inline'; sandbox"
+
+// setContentType sets the Content-Type of a raw response to match
+// `language`, the one stored with the document. Extensions in the URL are
+// never trusted, anyone could pick one a browser would render.
+func setContentType(c *fiber.Ctx, language string) {
+	mime, ok := mimeTypes[strings.ToLower(FileExtension(language))]
+
+	if !ok {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return
+	}
+
+	c.Set(fiber.HeaderContentSecurityPolicy, sandboxPolicy)
+	c.Set(fiber.HeaderContentType, mime+"; charset=utf-8")
+}
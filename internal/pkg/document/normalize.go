@@ -0,0 +1,104 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"strings"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Normalize applies the transforms enabled in `documents.normalize` to
+// `content`, returning it along with the names of those that changed it
+func Normalize(content string) (string, []string) {
+	n := config.Config().Documents.Normalize
+	applied := []string{}
+
+	apply := func(name string, transform func(string) string) {
+		if normalized := transform(content); normalized != content {
+			content = normalized
+			applied = append(applied, name)
+		}
+	}
+
+	if n.LineEndings {
+		apply("line_endings", func(s string) string {
+			return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+		})
+	}
+
+	if n.ExpandTabs > 0 {
+		apply("expand_tabs", func(s string) string {
+			return expandTabs(s, n.ExpandTabs)
+		})
+	}
+
+	if n.TrailingWhitespace {
+		apply("trailing_whitespace", func(s string) string {
+			lines := strings.Split(s, "\n")
+
+			for i := range lines {
+				lines[i] = strings.TrimRight(lines[i], " \t")
+			}
+
+			return strings.Join(lines, "\n")
+		})
+	}
+
+	if n.TrailingBlankLines {
+		apply("trailing_blank_lines", func(s string) string {
+			trimmed := strings.TrimRight(s, " \t\n")
+
+			// Keep the final newline of documents ending with one
+			if strings.HasSuffix(s, "\n") {
+				trimmed += "\n"
+			}
+
+			return trimmed
+		})
+	}
+
+	return content, applied
+}
+
+// expandTabs replaces the tabs in `s` with spaces up to the next multiple
+// of `width` columns
+func expandTabs(s string, width int) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+
+	var b strings.Builder
+	column := 0
+
+	for _, r := range s {
+		switch r {
+		case '\t':
+			spaces := width - column%width
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+		case '\n':
+			b.WriteRune(r)
+			column = 0
+		default:
+			b.WriteRune(r)
+			column++
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// armors are the first lines of common encrypted and signed formats
+var armors = []string{
+	"-----BEGIN PGP MESSAGE-----",
+	"-----BEGIN AGE ENCRYPTED FILE-----",
+	"age-encryption.org/v1",
+	"$ANSIBLE_VAULT;",
+}
+
+// Opaque reports whether `content` is ciphertext or a binary blob, which
+// can't be read line by line and is only offered for download
+func Opaque(content string) bool {
+	if !utf8.ValidString(content) || strings.ContainsRune(content, 0) {
+		return true
+	}
+
+	start := strings.TrimLeft(content, " \t\r\n")
+
+	for _, armor := range armors {
+		if strings.HasPrefix(start, armor) {
+			return true
+		}
+	}
+
+	return false
+}
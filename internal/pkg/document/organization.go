@@ -0,0 +1,121 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"gorm.io/gorm"
+)
+
+// Membership describes an organization the caller belongs to
+type Membership struct {
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Documents    int64  `json:"documents"`
+	MaxDocuments int    `json:"max_documents,omitempty"`
+}
+
+// CountOrganizationDocuments counts the documents shared with organization
+// `org`, leaving out ones in the trash
+func CountOrganizationDocuments(ctx context.Context, org string) (int64, error) {
+	return countOrganizationDocuments(database.DBConn.WithContext(ctx), org)
+}
+
+func countOrganizationDocuments(db *gorm.DB, org string) (int64, error) {
+	var count int64
+	err := db.Model(&models.Document{}).Where("organization = ? AND deleted_at = 0", org).Count(&count).Error
+
+	return count, err
+}
+
+// OrganizationQuota returns how many documents organization `org` can
+// have, 0 means there's no limit
+func OrganizationQuota(org string) int {
+	for _, o := range config.Config().Auth.Organizations {
+		if o.Name == org {
+			return o.MaxDocuments
+		}
+	}
+
+	return 0
+}
+
+// CanManage reports whether `identity` may change or delete `doc`, which
+// its creator, admins and maintainers of its organization can
+func CanManage(identity *auth.Identity, doc *models.Document) bool {
+	if identity == nil {
+		return false
+	}
+
+	return doc.Owner == identity.Name || identity.IsAdmin() ||
+		(doc.Organization != "" && identity.OrgRole(doc.Organization) == auth.OrgMaintainer)
+}
+
+// canRestore reports whether `identity` may take `doc` out of the trash.
+// Whoever deleted it and admins can, as can maintainers of its organization
+// if a member deleted it.
+func canRestore(identity *auth.Identity, doc *models.Document) bool {
+	if doc.DeletedBy == identity.Name || identity.IsAdmin() {
+		return true
+	}
+
+	return doc.Organization != "" && identity.OrgRole(doc.Organization) == auth.OrgMaintainer &&
+		auth.OrgRole(doc.Organization, doc.DeletedBy) != ""
+}
+
+// registerOrganizations loads the listings of the caller's organizations
+// and of the documents shared with one
+func registerOrganizations(app *fiber.App) {
+	app.Get("/v1/organizations", auth.Require(), func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+		memberships := []Membership{}
+
+		for _, o := range config.Config().Auth.Organizations {
+			role := identity.OrgRole(o.Name)
+
+			if role == "" {
+				continue
+			}
+
+			count, err := CountOrganizationDocuments(c.UserContext(), o.Name)
+
+			if err != nil {
+				return fiber.NewError(500, err.Error())
+			}
+
+			memberships = append(memberships, Membership{Name: o.Name, Role: role, Documents: count, MaxDocuments: o.MaxDocuments})
+		}
+
+		return c.Status(200).JSON(fiber.Map{"organizations": memberships})
+	})
+
+	app.Get("/v1/organizations/:name/documents", auth.Require(), func(c *fiber.Ctx) error {
+		if auth.FromRequest(c).OrgRole(c.Params("name")) == "" {
+			return fiber.NewError(403, "only members can list an organization's documents")
+		}
+
+		return c.Next()
+	}, listing(func(c *fiber.Ctx, tag string, offset, limit int) ([]models.Document, error) {
+		return ListOrganizationDocuments(c.UserContext(), c.Params("name"), tag, offset, limit)
+	}))
+}
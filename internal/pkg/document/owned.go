@@ -0,0 +1,130 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+	"gorm.io/gorm"
+)
+
+// ListOwnedDocuments retrieves a page of the most recent documents created
+// by `owner`, only those tagged `tag` unless it's empty. Quarantined
+// documents and ones in the trash are left out, as are expired ones the
+// sweep hasn't deleted yet, so a page can be shorter than `limit`.
+func ListOwnedDocuments(ctx context.Context, owner, tag string, offset, limit int) ([]models.Document, error) {
+	return listDocuments(database.DBConn.WithContext(ctx).Where("owner = ?", owner), tag, offset, limit)
+}
+
+// ListOrganizationDocuments is ListOwnedDocuments for the documents shared
+// with organization `org`
+func ListOrganizationDocuments(ctx context.Context, org, tag string, offset, limit int) ([]models.Document, error) {
+	return listDocuments(database.DBConn.WithContext(ctx).Where("organization = ?", org), tag, offset, limit)
+}
+
+func listDocuments(query *gorm.DB, tag string, offset, limit int) ([]models.Document, error) {
+	query = query.Where("moderation <> ? AND deleted_at = 0", models.ModerationQuarantined)
+
+	if tag != "" {
+		query = query.Where("id IN (?)", database.DBConn.Model(&models.DocumentTag{}).Select("document_id").Where("tag = ?", tag))
+	}
+
+	documents := []models.Document{}
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&documents).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	visible := documents[:0]
+
+	for i := range documents {
+		if !retention.Expired(&documents[i], now) {
+			visible = append(visible, documents[i])
+		}
+	}
+
+	return visible, nil
+}
+
+// registerOwned loads the listing of the caller's own documents
+func registerOwned(app *fiber.App) {
+	app.Get("/v1/account/documents", auth.Require(), listing(func(c *fiber.Ctx, tag string, offset, limit int) ([]models.Document, error) {
+		return ListOwnedDocuments(c.UserContext(), auth.FromRequest(c).Name, tag, offset, limit)
+	}))
+}
+
+// listing serves a page of the documents `list` returns, with their tags.
+// It can be narrowed down to one tag with `?tag=`.
+func listing(list func(c *fiber.Ctx, tag string, offset, limit int) ([]models.Document, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, perPage, err := pagination(c)
+
+		if err != nil {
+			return err
+		}
+
+		tag := ""
+
+		if c.Query("tag") != "" {
+			tags, err := NormalizeTags([]string{c.Query("tag")})
+
+			if err != nil {
+				return fiber.NewError(400, err.Error())
+			}
+
+			tag = tags[0]
+		}
+
+		documents, err := list(c, tag, (page-1)*perPage, perPage)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		ids := make([]string, 0, len(documents))
+
+		for _, doc := range documents {
+			ids = append(ids, doc.ID)
+		}
+
+		tags, err := GetTags(c.UserContext(), ids...)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		base := links.Base(c)
+		entries := make([]ListEntry, 0, len(documents))
+
+		for i := range documents {
+			entry := NewListEntry(base, &documents[i])
+			entry.Tags = tags[documents[i].ID]
+			entries = append(entries, entry)
+		}
+
+		return c.Status(200).JSON(fiber.Map{"documents": entries, "page": page, "per_page": perPage})
+	}
+}
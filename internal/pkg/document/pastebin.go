@@ -0,0 +1,130 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"github.com/spacebin-org/spirit/internal/pkg/spam"
+)
+
+// pastebinFormats maps pastebin.com's syntax names to extensions, formats
+// that aren't listed become "none"
+var pastebinFormats = map[string]string{
+	"bash":        "bash",
+	"c":           "c",
+	"cpp":         "cpp",
+	"csharp":      "csharp",
+	"css":         "css",
+	"go":          "go",
+	"haskell":     "haskell",
+	"html4strict": "markup",
+	"html5":       "markup",
+	"javascript":  "javascript",
+	"json":        "json",
+	"julia":       "julia",
+	"kotlin":      "kotlin",
+	"markdown":    "markdown",
+	"objc":        "objc",
+	"perl":        "perl",
+	"php":         "php",
+	"powershell":  "powershell",
+	"python":      "python",
+	"ruby":        "ruby",
+	"rust":        "rust",
+	"scala":       "scala",
+	"sql":         "sql",
+	"typescript":  "typescript",
+	"xml":         "markup",
+	"yaml":        "yaml",
+}
+
+// pastebinExpiry maps pastebin.com's expiry codes to seconds
+var pastebinExpiry = map[string]int64{
+	"N":   0,
+	"10M": 600,
+	"1H":  3600,
+	"1D":  86400,
+	"1W":  604800,
+	"2W":  1209600,
+	"1M":  2592000,
+	"6M":  15552000,
+	"1Y":  31536000,
+}
+
+// pastebinVisibility maps pastebin.com's privacy codes to visibility levels,
+// anything else is unlisted
+var pastebinVisibility = map[string]string{
+	"0": VisibilityPublic,
+	"1": VisibilityUnlisted,
+	"2": VisibilityPrivate,
+}
+
+// registerPastebin loads a route accepting the form sent to pastebin.com's
+// api_post.php, for scripts that can't be changed. `api_dev_key` is used as
+// an auth token when it matches one, otherwise the paste is anonymous.
+func registerPastebin(app *fiber.App, createChain []fiber.Handler, filters spam.Pipeline) {
+	app.Post("/api/api_post.php", append(createChain, func(c *fiber.Ctx) error {
+		if c.FormValue("api_option") != "paste" {
+			return pastebinError(c, 400, "invalid api_option")
+		}
+
+		extension, ok := pastebinFormats[c.FormValue("api_paste_format")]
+
+		if !ok {
+			extension = "none"
+		}
+
+		expiry, ok := pastebinExpiry[c.FormValue("api_paste_expire_date", "N")]
+
+		if !ok {
+			return pastebinError(c, 400, "invalid api_paste_expire_date")
+		}
+
+		identity := auth.Authenticate(c, c.FormValue("api_dev_key"))
+
+		if identity == nil {
+			identity = auth.FromRequest(c)
+		}
+
+		id, err := Create(c.UserContext(), filters, &CreateRequest{
+			Content:    c.FormValue("api_paste_code"),
+			Extension:  extension,
+			Expiry:     expiry,
+			Visibility: pastebinVisibility[c.FormValue("api_paste_private")],
+		}, identity, clientip.IP(c))
+
+		if err != nil {
+			code := fiber.StatusInternalServerError
+
+			if e, ok := err.(*fiber.Error); ok {
+				code = e.Code
+			}
+
+			return pastebinError(c, code, err.Error())
+		}
+
+		return c.Status(200).SendString(links.Document(links.Base(c), id))
+	})...)
+}
+
+// pastebinError responds with an error the way pastebin.com does
+func pastebinError(c *fiber.Ctx, code int, message string) error {
+	return c.Status(code).SendString("Bad API request, " + message)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"github.com/spacebin-org/spirit/internal/pkg/pdf"
+)
+
+// registerPDF loads the endpoint rendering documents to PDF files
+func registerPDF(api fiber.Router, fetchLimit fiber.Handler) {
+	api.Get("/:id/pdf", features.Require(features.PDF), fetchLimit, withSignature, func(c *fiber.Ctx) error {
+		if !ValidID(c.Params("id")) {
+			return fiber.NewError(400)
+		}
+
+		doc, err := GetDocument(c.UserContext(), auth.FromRequest(c), c.Params("id"))
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		if RawOnly(doc.Content) {
+			return fiber.NewError(422, "document is encrypted, binary or too long to be rendered")
+		}
+
+		viewed(c, doc, "pdf")
+
+		filename := doc.ID + "." + FileExtension(doc.Extension)
+		file := pdf.Render(pdf.Document{
+			Title:    filename,
+			Subtitle: links.Document(links.Base(c), doc.ID) + " - created " + time.Unix(doc.CreatedAt, 0).UTC().Format("2006-01-02 15:04 MST"),
+			Lines:    strings.Split(strings.TrimSuffix(doc.Content, "\n"), "\n"),
+			Numbered: true,
+		})
+
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, `inline; filename="`+filename+`.pdf"`)
+
+		return c.Status(200).Send(file)
+	})
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/domain"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// printPolicy blocks everything but the page's own styles
+const printPolicy = "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors 'none';"
+
+var printPage = template.Must(template.New("print").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+@page{margin:15mm}
+body{margin:0;color:#000;background:#fff;font:10pt/14pt ui-monospace,SFMono-Regular,Menlo,Consolas,monospace}
+header{font:10pt sans-serif;border-bottom:1px solid #000;padding-bottom:4pt;margin-bottom:8pt}
+header h1{font-size:12pt;margin:0}
+table{border-collapse:collapse;width:100%}
+tr{break-inside:avoid;page-break-inside:avoid}
+td{padding:0 6pt;vertical-align:top;white-space:pre-wrap;word-break:break-all}
+td:first-child{color:#666;text-align:right;width:1%;white-space:nowrap}
+.annotated td:nth-child(2){background:#eee}
+.note{white-space:normal;word-break:normal;font:9pt/12pt sans-serif;width:30%;border-left:1pt solid #666}
+.note p{margin:0 0 3pt}
+</style>
+</head>
+<body>
+<header><h1>{{.Title}}</h1>{{.Link}}<br>Created {{.Created}}{{range .Tags}} #{{.}}{{end}}</header>
+{{if .Opaque}}<p>This document is encrypted, binary or too long to be printed, {{.Size}} bytes.</p>{{else}}<table>{{range $i, $line := .Lines}}<tr{{if $line.Annotated}} class="annotated"{{end}}><td>{{inc $i}}</td><td>{{$line.Text}}</td>{{if $.Annotated}}<td class="note">{{range $line.Notes}}{{.}}{{end}}</td>{{end}}</tr>{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+// registerPrint loads the view of documents meant for printing them or
+// saving them as PDFs from a browser
+func registerPrint(app *fiber.App, fetchLimit fiber.Handler) {
+	app.Get("/:document/print", features.Require(features.Print), fetchLimit, withSignature, func(c *fiber.Ctx) error {
+		id := c.Params("document")
+
+		if !ValidID(id) {
+			return fiber.NewError(400)
+		}
+
+		doc, err := GetDocument(c.UserContext(), auth.FromRequest(c), id)
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		tags, err := GetTags(c.UserContext(), doc.ID)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		opaque := RawOnly(doc.Content)
+
+		var annotations []domain.Annotation
+		var lines []embedLine
+
+		if !opaque {
+			annotations, err = GetAnnotations(c.UserContext(), doc.ID)
+
+			if err != nil {
+				return fiber.NewError(500, err.Error())
+			}
+
+			lines = embedLines(doc.Content, annotations)
+		}
+
+		viewed(c, doc, "print")
+
+		var b strings.Builder
+
+		err = printPage.Execute(&b, map[string]interface{}{
+			"Title":     doc.ID + "." + FileExtension(doc.Extension),
+			"Link":      links.Document(links.Base(c), doc.ID),
+			"Created":   time.Unix(doc.CreatedAt, 0).UTC().Format("2006-01-02 15:04 MST"),
+			"Lines":     lines,
+			"Annotated": len(annotations) > 0,
+			"Opaque":    opaque,
+			"Size":      len(doc.Content),
+			"Tags":      tags[doc.ID],
+		})
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		c.Set(fiber.HeaderContentSecurityPolicy, printPolicy)
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+
+		return c.Status(200).SendString(b.String())
+	})
+}
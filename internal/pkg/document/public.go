@@ -0,0 +1,94 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// maxPerPage caps how many documents one page of the listing holds
+const maxPerPage = 100
+
+// ListEntry is a document in the public listing, without its content
+type ListEntry struct {
+	ID        string   `json:"id"`
+	Extension string   `json:"extension"`
+	Owner     string   `json:"owner,omitempty"`
+	URL       string   `json:"url"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// registerPublic loads the listing of public documents, newest first
+func registerPublic(app *fiber.App, listing, fetchLimit fiber.Handler) {
+	app.Get("/v1/public", listing, fetchLimit, func(c *fiber.Ctx) error {
+		page, perPage, err := pagination(c)
+
+		if err != nil {
+			return err
+		}
+
+		documents, err := ListPublicDocuments(c.UserContext(), (page-1)*perPage, perPage)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		base := links.Base(c)
+		entries := make([]ListEntry, 0, len(documents))
+
+		for i := range documents {
+			entries = append(entries, NewListEntry(base, &documents[i]))
+		}
+
+		return c.Status(200).JSON(fiber.Map{"documents": entries, "page": page, "per_page": perPage})
+	})
+}
+
+// pagination reads the `page` and `per_page` query parameters of a listing
+func pagination(c *fiber.Ctx) (int, int, error) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+
+	if err != nil || page < 1 {
+		return 0, 0, fiber.NewError(400, "page must be a positive number")
+	}
+
+	perPage, err := strconv.Atoi(c.Query("per_page", "20"))
+
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		return 0, 0, fiber.NewError(400, "per_page must be between 1 and "+strconv.Itoa(maxPerPage))
+	}
+
+	return page, perPage, nil
+}
+
+// NewListEntry describes `doc` for listings, linking to it on `base`
+func NewListEntry(base string, doc *models.Document) ListEntry {
+	return ListEntry{
+		ID:        doc.ID,
+		Extension: doc.Extension,
+		Owner:     doc.Owner,
+		URL:       links.Document(base, doc.ID),
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}
+}
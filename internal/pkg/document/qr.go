@@ -0,0 +1,93 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// registerQR loads the endpoint rendering a QR code of a document's URL,
+// as a PNG or with `?format=svg` as an SVG
+func registerQR(api fiber.Router, fetchLimit fiber.Handler) {
+	api.Get("/:id/qr", fetchLimit, func(c *fiber.Ctx) error {
+		if !ValidID(c.Params("id")) {
+			return fiber.NewError(400)
+		}
+
+		if _, err := GetDocument(c.UserContext(), auth.FromRequest(c), c.Params("id")); err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		code, err := qrcode.New(links.Document(links.Base(c), c.Params("id")), qrcode.Medium)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		switch c.Query("format", "png") {
+		case "png":
+			px, err := strconv.Atoi(c.Query("size", "256"))
+
+			if err != nil || px < 64 || px > 1024 {
+				return fiber.NewError(400, "size must be between 64 and 1024")
+			}
+
+			png, err := code.PNG(px)
+
+			if err != nil {
+				return fiber.NewError(500, err.Error())
+			}
+
+			c.Set(fiber.HeaderContentType, "image/png")
+
+			return c.Status(200).Send(png)
+		case "svg":
+			c.Set(fiber.HeaderContentType, "image/svg+xml")
+
+			return c.Status(200).SendString(svg(code.Bitmap()))
+		}
+
+		return fiber.NewError(400, "format must be png or svg")
+	})
+}
+
+// svg draws `bitmap` with one unit per module, so it scales to any size
+func svg(bitmap [][]bool) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, len(bitmap), len(bitmap))
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	b.WriteString(`"/></svg>`)
+
+	return b.String()
+}
@@ -17,19 +17,85 @@
 package document
 
 import (
+	"bufio"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/challenge"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
 	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
 	"github.com/spacebin-org/spirit/internal/pkg/domain"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+	"github.com/spacebin-org/spirit/internal/pkg/ipfilter"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"github.com/spacebin-org/spirit/internal/pkg/metrics"
+	"github.com/spacebin-org/spirit/internal/pkg/moderation"
+	"github.com/spacebin-org/spirit/internal/pkg/ratelimit"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+	"github.com/spacebin-org/spirit/internal/pkg/spam"
+	"github.com/spacebin-org/spirit/internal/pkg/timeout"
 )
 
-// Register loads all document-related endpoints
-func Register(app *fiber.App) {
+// Register loads all document-related endpoints. New documents are checked
+// by `filters`, and anonymous creation has to pass `verifier` when one is
+// configured.
+func Register(app *fiber.App, verifier challenge.Verifier, filters spam.Pipeline) {
+	// Share tokens apply to every route fetching documents, including ones
+	// outside /v1/documents like embeds
+	app.Use(withShareToken)
+
 	api := app.Group("/v1/documents")
 
-	api.Post("/", func(c *fiber.Ctx) error {
+	// Each kind of route gets its own limiter so creation can be throttled
+	// harder than fetching
+	createLimit, err := ratelimit.New(func() string {
+		return config.Config().Server.Ratelimits.Create
+	})
+
+	if err != nil {
+		log.Fatalf("Invalid create rate limit: %v", err)
+	}
+
+	fetchLimit, err := ratelimit.New(func() string {
+		return config.Config().Server.Ratelimits.Fetch
+	})
+
+	if err != nil {
+		log.Fatalf("Invalid fetch rate limit: %v", err)
+	}
+
+	// Uploads get more time than other requests, fetches less
+	fetchLimit = timeout.Wrap(func() int {
+		return config.Config().Server.Timeouts.Fetch
+	}, fetchLimit)
+
+	createTimeout := timeout.Set(func() int {
+		return config.Config().Server.Timeouts.Create
+	})
+
+	// Creation can be restricted further than the rest of the server
+	createFilter, err := ipfilter.New(config.Config().Server.IPFilter.CreateAllow, nil)
+
+	if err != nil {
+		log.Fatalf("Invalid create IP filter: %v", err)
+	}
+
+	// Middleware every route creating documents goes through
+	createChain := []fiber.Handler{createTimeout, createFilter, moderation.RejectBanned(), createLimit, sizeLimit(), challenge.Require(verifier)}
+
+	api.Post("/", append(createChain, func(c *fiber.Ctx) error {
 		b := new(CreateRequest)
 
 		// Validate and parse body
@@ -37,53 +103,70 @@ func Register(app *fiber.App) {
 			return fiber.NewError(400, err.Error())
 		}
 
-		if err := b.Validate(); err != nil {
-			return fiber.NewError(400, err.Error())
-		}
-
-		// Create and retrieve document
-		id, err := NewDocument(b.Content, b.Extension)
-
-		if err != nil {
-			return fiber.NewError(500, err.Error())
-		}
+		doc, err := idempotent(c, func() (created, error) {
+			id, err := Create(c.UserContext(), filters, b, auth.FromRequest(c), clientip.IP(c))
+			hash := md5.Sum([]byte(b.Content))
 
-		document, err := GetDocument(id)
+			return created{id: id, contentHash: hex.EncodeToString(hash[:]), normalized: b.Normalized}, err
+		})
 
 		if err != nil {
-			return fiber.NewError(500, err.Error())
+			return err
 		}
 
-		hash := md5.Sum([]byte(document.Content))
-
 		c.Status(201).JSON(&domain.Response{
 			Status: c.Response().StatusCode(),
 			Payload: domain.Payload{
-				ID:          &document.ID,
-				ContentHash: hex.EncodeToString(hash[:]),
+				ID:          &doc.id,
+				ContentHash: doc.contentHash,
+				Normalized:  doc.normalized,
 			},
 			Error: "",
 		})
 
 		return nil
-	})
+	})...)
 
-	api.Get("/:id", func(c *fiber.Ctx) error {
-		if c.Params("id") != "" && len(c.Params("id")) == config.Config.Documents.IDLength {
-			document, err := GetDocument(c.Params("id"))
+	api.Get("/:id", fetchLimit, func(c *fiber.Ctx) error {
+		if ValidID(c.Params("id")) {
+			document, err := GetDocument(c.UserContext(), auth.FromRequest(c), c.Params("id"))
 
 			if err != nil {
 				return fiber.NewError(404, err.Error())
 			}
 
+			// Documents from the cache are served without their tags and
+			// annotations while the database can't be reached
+			tags, err := GetTags(c.UserContext(), document.ID)
+
+			if err != nil && !database.Unavailable(err) {
+				return fiber.NewError(500, err.Error())
+			}
+
+			annotations, err := GetAnnotations(c.UserContext(), document.ID)
+
+			if err != nil && !database.Unavailable(err) {
+				return fiber.NewError(500, err.Error())
+			}
+
+			viewed(c, document, "json")
+
 			c.Status(200).JSON(&domain.Response{
 				Status: c.Response().StatusCode(),
 				Payload: domain.Payload{
-					ID:        &document.ID,
-					Content:   &document.Content,
-					Extension: &document.Extension,
-					CreatedAt: &document.CreatedAt,
-					UpdatedAt: &document.UpdatedAt,
+					ID:           &document.ID,
+					Content:      &document.Content,
+					Extension:    &document.Extension,
+					CreatedAt:    &document.CreatedAt,
+					UpdatedAt:    &document.UpdatedAt,
+					GistURL:      document.GistURL,
+					Public:       document.Public,
+					Shortened:    document.Shortened,
+					Tags:         tags[document.ID],
+					Organization: document.Organization,
+					Visibility:   Visibility(document),
+					Annotations:  annotations,
+					RawOnly:      RawOnly(document.Content),
 				},
 				Error: "",
 			})
@@ -94,15 +177,45 @@ func Register(app *fiber.App) {
 		return nil
 	})
 
-	api.Get("/:id/raw", func(c *fiber.Ctx) (err error) {
-		if c.Params("id") != "" && len(c.Params("id")) == config.Config.Documents.IDLength {
-			document, err := GetDocument(c.Params("id"))
+	api.Get("/:id/raw", fetchLimit, withSignature, func(c *fiber.Ctx) (err error) {
+		if ValidID(c.Params("id")) {
+			document, err := GetDocumentInfo(c.UserContext(), auth.FromRequest(c), c.Params("id"))
 
 			if err != nil {
 				return fiber.NewError(404, err.Error())
 			}
 
-			c.Status(200).SendString(document.Content)
+			viewed(c, document, "raw")
+
+			// Coloring needs the whole content at once
+			if wantsANSI(c) {
+				document, err = GetDocument(c.UserContext(), auth.FromRequest(c), document.ID)
+
+				if err != nil {
+					return fiber.NewError(404, err.Error())
+				}
+
+				return sendANSI(c, document)
+			}
+
+			// Documents from the cache already come with their content
+			if document.Content != "" {
+				setContentType(c, document.Extension)
+				return c.Status(200).SendString(document.Content)
+			}
+
+			// The content is streamed, once that starts the status can't
+			// be changed anymore
+			ctx, cancel := timeout.Detach(c)
+
+			setContentType(c, document.Extension)
+			c.Status(200).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+				defer cancel()
+
+				if err := StreamContent(ctx, w, document.ID); err != nil {
+					log.Printf("Streaming %s failed: %v", document.ID, err)
+				}
+			})
 		} else {
 			return fiber.NewError(400)
 		}
@@ -110,4 +223,200 @@ func Register(app *fiber.App) {
 		return nil
 	})
 
+	registerQR(api, fetchLimit)
+	registerBatch(api, fetchLimit)
+	registerMeta(api, fetchLimit)
+	registerPDF(api, fetchLimit)
+	registerImage(api, fetchLimit)
+	registerTrash(api)
+	registerStars(app, api)
+	registerTags(api)
+	registerAnnotations(api)
+	registerShareLinks(api)
+	registerSigning(api)
+	registerOwned(app)
+	registerOrganizations(app)
+	registerEmbed(app, fetchLimit)
+	registerPrint(app, fetchLimit)
+
+	// The whole body is the document and the response is just its URL, so
+	// `curl --data-binary @file <instance>` works
+	app.Post("/", append(createChain, func(c *fiber.Ctx) error {
+		expiry, err := strconv.ParseInt(c.Query("expiry", "0"), 10, 64)
+
+		if err != nil {
+			return c.Status(400).SendString("expiry must be a number of seconds\n")
+		}
+
+		shorten := c.Query("shorten") == "true"
+		doc, err := idempotent(c, func() (created, error) {
+			id, err := Create(c.UserContext(), filters, &CreateRequest{
+				Content:   string(c.Body()),
+				Extension: c.Query("extension", "none"),
+				Expiry:    expiry,
+				Shorten:   shorten,
+			}, auth.FromRequest(c), clientip.IP(c))
+
+			return created{id: id}, err
+		})
+
+		if err != nil {
+			code := fiber.StatusInternalServerError
+
+			if e, ok := err.(*fiber.Error); ok {
+				code = e.Code
+			}
+
+			return c.Status(code).SendString(err.Error() + "\n")
+		}
+
+		if shorten {
+			return c.Status(201).SendString(links.Short(links.Base(c), doc.id) + "\n")
+		}
+
+		return c.Status(201).SendString(links.Document(links.Base(c), doc.id) + "\n")
+	})...)
+
+	if config.Config().Documents.HastebinCompat {
+		registerHastebin(app, createChain, fetchLimit, filters)
+	}
+
+	if config.Config().Documents.PastebinCompat {
+		registerPastebin(app, createChain, filters)
+	}
+
+	listing := features.Require(features.PublicListing)
+	registerPublic(app, listing, fetchLimit)
+	registerTrending(app, listing, fetchLimit)
+	registerSitemap(app, listing)
+}
+
+// Create transcodes, normalizes and validates `b`, runs it through `filters`
+// and stores the document on behalf of `identity`, which is nil for
+// anonymous requests, and `ip`. Errors are returned as a *fiber.Error.
+func Create(ctx context.Context, filters spam.Pipeline, b *CreateRequest, identity *auth.Identity, ip net.IP) (string, error) {
+	content, err := Transcode(b.Content)
+
+	if err != nil {
+		return "", fiber.NewError(400, err.Error())
+	}
+
+	b.Content, b.Normalized = Normalize(content)
+
+	if err := b.Validate(MaxLength(identity)); err != nil {
+		return "", fiber.NewError(400, err.Error())
+	}
+
+	if err := checkLines(b.Content); err != nil && config.Config().Documents.Oversized == "reject" {
+		return "", fiber.NewError(400, err.Error())
+	}
+
+	tags, err := NormalizeTags(b.Tags)
+
+	if err != nil {
+		return "", fiber.NewError(400, err.Error())
+	}
+
+	document := models.Document{
+		Content:   b.Content,
+		Extension: b.Extension,
+		CreatorIP: ip.String(),
+		Shortened: b.Shorten,
+	}
+
+	if b.Shorten && !config.Config().Documents.Shortener {
+		return "", fiber.NewError(400, "link shortening is disabled")
+	}
+
+	if b.Shorten && !shortenable(b.Content) {
+		return "", fiber.NewError(400, "content must be a single http or https URL to be shortened")
+	}
+
+	if identity != nil {
+		document.Owner = identity.Name
+	}
+
+	visibility := b.Visibility
+
+	if visibility == "" && b.Public {
+		visibility = VisibilityPublic
+	}
+
+	// Nobody could read private anonymous documents
+	if visibility == VisibilityPrivate && identity == nil {
+		return "", fiber.NewError(400, "only documents created with a token can be private")
+	}
+
+	document.Public = visibility == VisibilityPublic
+	document.Private = visibility == VisibilityPrivate
+
+	if b.Organization != "" {
+		if identity.OrgRole(b.Organization) == "" {
+			return "", fiber.NewError(403, "only members of an organization can create documents in it")
+		}
+
+		document.Organization = b.Organization
+	}
+
+	if b.Expiry > 0 {
+		// Anonymous documents can expire sooner than the rules say, but
+		// can't be kept for longer
+		if maxAge := retention.MaxAge(&document); identity == nil && maxAge != 0 && b.Expiry > maxAge {
+			return "", fiber.NewError(400, fmt.Sprintf("expiry can't be more than %d seconds", maxAge))
+		}
+
+		document.ExpiresAt = time.Now().Unix() + b.Expiry
+	}
+
+	// Run spam heuristics before anything is stored
+	result := filters.Run(&spam.Submission{
+		Content:   b.Content,
+		Extension: b.Extension,
+		IP:        ip,
+	})
+
+	if result.Decision != spam.Allow {
+		metrics.SpamDecisions.Inc(result.Filter, result.Decision.String())
+	}
+
+	switch result.Decision {
+	case spam.Reject:
+		return "", fiber.NewError(403, "document rejected by content filter")
+	case spam.Quarantine:
+		// The client is told the document was created as usual, so
+		// spammers don't learn what gets caught
+		document.Moderation = models.ModerationQuarantined
+	case spam.Flag:
+		document.Moderation = models.ModerationFlagged
+	}
+
+	if result.Decision != spam.Allow {
+		document.ModerationReason = result.Filter + ": " + result.Reason
+	}
+
+	if err := runCreateHooks(ctx, identity, &document); err != nil {
+		var fiberErr *fiber.Error
+
+		if errors.As(err, &fiberErr) {
+			return "", fiberErr
+		}
+
+		return "", fiber.NewError(400, err.Error())
+	}
+
+	// Create document
+	id, err := NewDocument(ctx, document, tags)
+
+	if errors.Is(err, ErrQuotaExceeded) {
+		return "", fiber.NewError(403, fmt.Sprintf("organization already has %d documents, its quota", OrganizationQuota(document.Organization)))
+	}
+
+	if err != nil {
+		return "", fiber.NewError(500, err.Error())
+	}
+
+	document.ID = id
+	events.Publish(ctx, newEvent(events.Created, &document, identity, ip))
+
+	return id, nil
 }
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"gorm.io/gorm"
+)
+
+// maxShareLinkAge is the longest a share link can be valid for
+const maxShareLinkAge = 30 * 24 * time.Hour
+
+// shareTokenKey is the context key of the share token sent with a request
+type shareTokenKey struct{}
+
+// ShareLinkRequest represents a valid body object for the create share link
+// request
+type ShareLinkRequest struct {
+	ExpiresIn int64 `json:"expires_in" form:"expires_in"` // in seconds
+}
+
+// NewShareLink is a share link as it's created, the only time its token is
+// shown
+type NewShareLink struct {
+	models.ShareLink
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// hashShareToken returns what's stored in place of `token`
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateShareLink mints a token granting read access to document `id` for
+// `ttl`, on behalf of `identity`
+func CreateShareLink(ctx context.Context, identity *auth.Identity, id string, ttl time.Duration) (*NewShareLink, error) {
+	doc, err := GetDocumentInfo(ctx, identity, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanManage(identity, doc) {
+		return nil, ErrNotOwner
+	}
+
+	b := make([]byte, 24)
+
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	link := NewShareLink{Token: base64.RawURLEncoding.EncodeToString(b)}
+	link.ShareLink = models.ShareLink{
+		DocumentID:        id,
+		DocumentCreatedAt: doc.CreatedAt,
+		TokenHash:         hashShareToken(link.Token),
+		CreatedBy:         identity.Name,
+		ExpiresAt:         time.Now().Add(ttl).Unix(),
+	}
+
+	return &link, database.DBConn.WithContext(ctx).Create(&link.ShareLink).Error
+}
+
+// GetShareLinks lists the share links of document `id` that haven't
+// expired, for `identity`
+func GetShareLinks(ctx context.Context, identity *auth.Identity, id string) ([]models.ShareLink, error) {
+	doc, err := GetDocumentInfo(ctx, identity, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanManage(identity, doc) {
+		return nil, ErrNotOwner
+	}
+
+	shareLinks := []models.ShareLink{}
+	err = database.DBConn.WithContext(ctx).Where("document_id = ? AND expires_at > ?", id, time.Now().Unix()).
+		Order("created_at").Find(&shareLinks).Error
+
+	return shareLinks, err
+}
+
+// RevokeShareLink deletes share link `linkID` of document `id` on behalf of
+// `identity`
+func RevokeShareLink(ctx context.Context, identity *auth.Identity, id string, linkID uint) error {
+	doc, err := GetDocumentInfo(ctx, identity, id)
+
+	if err != nil {
+		return err
+	}
+
+	if !CanManage(identity, doc) {
+		return ErrNotOwner
+	}
+
+	res := database.DBConn.WithContext(ctx).Where("id = ? AND document_id = ?", linkID, id).Delete(&models.ShareLink{})
+
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return res.Error
+}
+
+// PruneShareLinks deletes share links that have expired
+func PruneShareLinks(ctx context.Context) error {
+	return database.DBConn.WithContext(ctx).
+		Where("expires_at <= ?", time.Now().Unix()).
+		Delete(&models.ShareLink{}).Error
+}
+
+// shared reports whether the share token in `ctx`, if any, grants access
+// to `doc`
+func shared(ctx context.Context, doc *models.Document) bool {
+	token, _ := ctx.Value(shareTokenKey{}).(string)
+
+	if token == "" {
+		return false
+	}
+
+	var count int64
+	err := database.DBConn.WithContext(ctx).Model(&models.ShareLink{}).
+		Where("token_hash = ? AND document_id = ? AND document_created_at = ? AND expires_at > ?",
+			hashShareToken(token), doc.ID, doc.CreatedAt, time.Now().Unix()).
+		Count(&count).Error
+
+	return err == nil && count > 0
+}
+
+// withShareToken passes the `share` query parameter on to GetDocument
+// through the request's context
+func withShareToken(c *fiber.Ctx) error {
+	if token := c.Query("share"); token != "" {
+		c.SetUserContext(context.WithValue(c.UserContext(), shareTokenKey{}, token))
+	}
+
+	return c.Next()
+}
+
+// registerShareLinks loads the endpoints managing a document's share links
+func registerShareLinks(api fiber.Router) {
+	api.Get("/:id/share-links", auth.Require(), func(c *fiber.Ctx) error {
+		shareLinks, err := GetShareLinks(c.UserContext(), auth.FromRequest(c), c.Params("id"))
+
+		if err != nil {
+			return changeError(err)
+		}
+
+		return c.Status(200).JSON(fiber.Map{"share_links": shareLinks})
+	})
+
+	api.Post("/:id/share-links", auth.Require(), func(c *fiber.Ctx) error {
+		b := ShareLinkRequest{ExpiresIn: 86400}
+
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&b); err != nil {
+				return fiber.NewError(400, err.Error())
+			}
+		}
+
+		ttl := time.Duration(b.ExpiresIn) * time.Second
+
+		if ttl < time.Minute || ttl > maxShareLinkAge {
+			return fiber.NewError(400, "expires_in must be between 60 and "+strconv.Itoa(int(maxShareLinkAge.Seconds()))+" seconds")
+		}
+
+		link, err := CreateShareLink(c.UserContext(), auth.FromRequest(c), c.Params("id"), ttl)
+
+		if err != nil {
+			return changeError(err)
+		}
+
+		link.URL = links.Document(links.Base(c), c.Params("id")) + "?share=" + link.Token
+
+		return c.Status(201).JSON(link)
+	})
+
+	api.Delete("/:id/share-links/:link", auth.Require(), func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("link"), 10, 64)
+
+		if err != nil {
+			return fiber.NewError(400, "invalid share link id")
+		}
+
+		if err := RevokeShareLink(c.UserContext(), auth.FromRequest(c), c.Params("id"), uint(id)); err != nil {
+			return changeError(err)
+		}
+
+		return c.SendStatus(204)
+	})
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"gorm.io/gorm"
+)
+
+// openDatabase migrates a new sqlite database and stores `docs` in it
+func openDatabase(t *testing.T, docs ...models.Document) {
+	t.Helper()
+
+	configtest.Load(t, "")
+	database.Init()
+
+	t.Cleanup(func() {
+		database.Close()
+	})
+
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range docs {
+		if err := database.DBConn.Create(&docs[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// withShare returns a context carrying `token` like a share link would
+func withShare(token string) context.Context {
+	return context.WithValue(context.Background(), shareTokenKey{}, token)
+}
+
+func TestShared(t *testing.T) {
+	doc := models.Document{ID: "abcdefgh", Content: "secret", Owner: "alice", Private: true, CreatedAt: time.Now().Unix()}
+	openDatabase(t, doc)
+
+	ctx := context.Background()
+	alice := &auth.Identity{Name: "alice", Role: auth.RoleUser}
+
+	link, err := CreateShareLink(ctx, alice, doc.ID, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := CreateShareLink(ctx, alice, doc.ID, -time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := CreateShareLink(ctx, alice, doc.ID, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RevokeShareLink(ctx, alice, doc.ID, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	recreated := doc
+	recreated.CreatedAt++
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		doc  models.Document
+		want bool
+	}{
+		{"valid", withShare(link.Token), doc, true},
+		{"no token", ctx, doc, false},
+		{"unknown token", withShare("not-a-token"), doc, false},
+		{"stored hash", withShare(link.TokenHash), doc, false},
+		{"expired", withShare(expired.Token), doc, false},
+		{"revoked", withShare(revoked.Token), doc, false},
+		{"other document", withShare(link.Token), models.Document{ID: "hgfedcba", CreatedAt: doc.CreatedAt}, false},
+		{"document recreated", withShare(link.Token), recreated, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shared(tt.ctx, &tt.doc); got != tt.want {
+				t.Errorf("shared() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateShareLink(t *testing.T) {
+	openDatabase(t,
+		models.Document{ID: "public01", Owner: "alice"},
+		models.Document{ID: "private1", Owner: "alice", Private: true},
+	)
+
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		id       string
+		want     error
+	}{
+		{"owner", &auth.Identity{Name: "alice", Role: auth.RoleUser}, "private1", nil},
+		{"admin", &auth.Identity{Name: "root", Role: auth.RoleAdmin}, "private1", nil},
+		{"someone else", &auth.Identity{Name: "bob", Role: auth.RoleUser}, "public01", ErrNotOwner},
+		{"anonymous", nil, "public01", ErrNotOwner},
+		{"hidden from them", &auth.Identity{Name: "bob", Role: auth.RoleUser}, "private1", gorm.ErrRecordNotFound},
+		{"missing", &auth.Identity{Name: "alice", Role: auth.RoleUser}, "missing1", gorm.ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := CreateShareLink(context.Background(), tt.identity, tt.id, time.Hour)
+
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CreateShareLink() error = %v, want %v", err, tt.want)
+			}
+
+			if err == nil && link.TokenHash != hashShareToken(link.Token) {
+				t.Error("the stored hash isn't the token's")
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/ratelimit"
+)
+
+// shortenable reports whether `content` is a single absolute http(s) URL
+func shortenable(content string) bool {
+	content = strings.TrimSpace(content)
+
+	if strings.ContainsAny(content, " \t\r\n") {
+		return false
+	}
+
+	u, err := url.Parse(content)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// RegisterShortLinks loads `GET /:id`, which redirects to the URL stored in
+// shortened documents. It matches every path, so it has to be registered
+// after all other routes, and anything else falls through to them.
+func RegisterShortLinks(app *fiber.App) {
+	if !config.Config().Documents.Shortener {
+		return
+	}
+
+	limit, err := ratelimit.New(func() string {
+		return config.Config().Server.Ratelimits.Fetch
+	})
+
+	if err != nil {
+		log.Fatalf("Invalid fetch rate limit: %v", err)
+	}
+
+	// Only paths that could be documents are rate limited
+	app.Get("/:id", func(c *fiber.Ctx) error {
+		if !ValidID(c.Params("id")) {
+			return c.Next()
+		}
+
+		return limit(c)
+	}, func(c *fiber.Ctx) error {
+		if !ValidID(c.Params("id")) {
+			return c.Next()
+		}
+
+		document, err := GetDocument(c.UserContext(), auth.FromRequest(c), c.Params("id"))
+
+		if err != nil || !document.Shortened {
+			return c.Next()
+		}
+
+		viewed(c, document, "redirect")
+
+		return c.Redirect(strings.TrimSpace(document.Content), fiber.StatusFound)
+	})
+}
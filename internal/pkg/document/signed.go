@@ -0,0 +1,130 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// maxSignatureAge is the longest a signed URL can be valid for
+const maxSignatureAge = 7 * 24 * time.Hour
+
+// signatureKey is the context key of the signature sent with a request
+type signatureKey struct{}
+
+// signature is what a signed URL carries in its query
+type signature struct {
+	sig string
+	exp int64
+}
+
+// Sign returns the signature granting read access to `doc` until the unix
+// timestamp `exp`, made with `documents.signing_key`. It covers the
+// document's CreatedAt, so it doesn't carry over to a later document given
+// the same ID.
+func Sign(doc *models.Document, exp int64) string {
+	return signWith(config.Config().Documents.SigningKey, doc, exp)
+}
+
+func signWith(key string, doc *models.Document, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(doc.ID + "\n" + strconv.FormatInt(doc.CreatedAt, 10) + "\n" + strconv.FormatInt(exp, 10)))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signed reports whether the signature in `ctx`, if any, grants access to
+// `doc`. Signatures made with a rotated key stay valid for as long as
+// signed URLs can be, so URLs handed out before the rotation keep working.
+func signed(ctx context.Context, doc *models.Document) bool {
+	s, ok := ctx.Value(signatureKey{}).(signature)
+
+	if !ok || config.Config().Documents.SigningKey == "" || s.exp <= time.Now().Unix() {
+		return false
+	}
+
+	if hmac.Equal([]byte(s.sig), []byte(Sign(doc, s.exp))) {
+		return true
+	}
+
+	old, ok := config.Retired("documents.signing_key")
+
+	return ok && time.Since(old.RetiredAt) < maxSignatureAge && hmac.Equal([]byte(s.sig), []byte(signWith(old.Key, doc, s.exp)))
+}
+
+// withSignature passes the `sig` and `exp` query parameters of a signed URL
+// on to GetDocument through the request's context
+func withSignature(c *fiber.Ctx) error {
+	exp, err := strconv.ParseInt(c.Query("exp"), 10, 64)
+
+	if c.Query("sig") != "" && err == nil {
+		c.SetUserContext(context.WithValue(c.UserContext(), signatureKey{}, signature{sig: c.Query("sig"), exp: exp}))
+	}
+
+	return c.Next()
+}
+
+// registerSigning loads the endpoint signing raw URLs, when a
+// `documents.signing_key` is set
+func registerSigning(api fiber.Router) {
+	if config.Config().Documents.SigningKey == "" {
+		return
+	}
+
+	api.Post("/:id/signed-url", auth.Require(), func(c *fiber.Ctx) error {
+		b := ShareLinkRequest{ExpiresIn: 3600}
+
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&b); err != nil {
+				return fiber.NewError(400, err.Error())
+			}
+		}
+
+		ttl := time.Duration(b.ExpiresIn) * time.Second
+
+		if ttl < time.Minute || ttl > maxSignatureAge {
+			return fiber.NewError(400, "expires_in must be between 60 and "+strconv.Itoa(int(maxSignatureAge.Seconds()))+" seconds")
+		}
+
+		identity := auth.FromRequest(c)
+		doc, err := GetDocumentInfo(c.UserContext(), identity, c.Params("id"))
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		if !CanManage(identity, doc) {
+			return fiber.NewError(403, ErrNotOwner.Error())
+		}
+
+		exp := time.Now().Add(ttl).Unix()
+		url := links.Document(links.Base(c), doc.ID) + "?exp=" + strconv.FormatInt(exp, 10) + "&sig=" + Sign(doc, exp)
+
+		return c.Status(201).JSON(fiber.Map{"url": url, "expires_at": exp})
+	})
+}
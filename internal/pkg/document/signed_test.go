@@ -0,0 +1,101 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+const signingConfig = `
+[documents]
+signing_key = "%s"
+`
+
+func signingConfigWith(key string) string {
+	return strings.Replace(signingConfig, "%s", key, 1)
+}
+
+// withSig returns a context carrying the signature a signed URL would
+func withSig(sig string, exp int64) context.Context {
+	return context.WithValue(context.Background(), signatureKey{}, signature{sig: sig, exp: exp})
+}
+
+func TestSigned(t *testing.T) {
+	configtest.Load(t, signingConfigWith("0123456789abcdef0123456789abcdef"))
+
+	doc := &models.Document{ID: "abcdefgh", CreatedAt: 1_600_000_000}
+	exp := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+	sig := Sign(doc, exp)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		doc  *models.Document
+		want bool
+	}{
+		{"valid", withSig(sig, exp), doc, true},
+		{"no signature", context.Background(), doc, false},
+		{"expired", withSig(Sign(doc, past), past), doc, false},
+		{"expiry changed", withSig(sig, exp+3600), doc, false},
+		{"other document", withSig(sig, exp), &models.Document{ID: "hgfedcba", CreatedAt: doc.CreatedAt}, false},
+		{"document recreated", withSig(sig, exp), &models.Document{ID: doc.ID, CreatedAt: doc.CreatedAt + 1}, false},
+		{"other key", withSig(signWith("fedcba9876543210fedcba9876543210", doc, exp), exp), doc, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signed(tt.ctx, tt.doc); got != tt.want {
+				t.Errorf("signed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedWithoutKey(t *testing.T) {
+	configtest.Load(t, signingConfigWith(""))
+
+	doc := &models.Document{ID: "abcdefgh"}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	// Anyone could make this signature with an empty key
+	if signed(withSig(signWith("", doc, exp), exp), doc) {
+		t.Error("signature accepted while signing is disabled")
+	}
+}
+
+func TestSignedAfterRotation(t *testing.T) {
+	configtest.Load(t, signingConfigWith("0123456789abcdef0123456789abcdef"))
+
+	doc := &models.Document{ID: "abcdefgh", CreatedAt: 1_600_000_000}
+	exp := time.Now().Add(time.Hour).Unix()
+	before := Sign(doc, exp)
+
+	configtest.Reload(t, signingConfigWith("fedcba9876543210fedcba9876543210"))
+
+	for name, sig := range map[string]string{"signed before": before, "signed after": Sign(doc, exp)} {
+		if !signed(withSig(sig, exp), doc) {
+			t.Errorf("%s the rotation: refused", name)
+		}
+	}
+}
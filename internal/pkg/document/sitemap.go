@@ -0,0 +1,119 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// sitemapSize is how many documents one sitemap lists, well below the
+// protocol's limit of 50,000 URLs
+const sitemapSize = 10_000
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// SitemapIndex links to every page of the sitemap
+type SitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	XMLNS    string         `xml:"xmlns,attr"`
+	Sitemaps []SitemapEntry `xml:"sitemap"`
+}
+
+// SitemapEntry is a link to one page of the sitemap
+type SitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// URLSet is one page of the sitemap
+type URLSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []URL    `xml:"url"`
+}
+
+// URL is a public document in the sitemap
+type URL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// registerSitemap loads a sitemap of public documents, split into pages
+// listed by /sitemap.xml
+func registerSitemap(app *fiber.App, listing fiber.Handler) {
+	app.Get("/sitemap.xml", listing, func(c *fiber.Ctx) error {
+		count, err := CountPublicDocuments(c.UserContext())
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		base := links.Base(c)
+		index := SitemapIndex{XMLNS: sitemapNamespace, Sitemaps: []SitemapEntry{}}
+
+		for page := 1; page == 1 || int64(page-1)*sitemapSize < count; page++ {
+			index.Sitemaps = append(index.Sitemaps, SitemapEntry{
+				Loc: base + "/sitemap/" + strconv.Itoa(page) + ".xml",
+			})
+		}
+
+		return sendXML(c, index)
+	})
+
+	app.Get("/sitemap/:page.xml", listing, func(c *fiber.Ctx) error {
+		page, err := strconv.Atoi(c.Params("page"))
+
+		if err != nil || page < 1 {
+			return fiber.NewError(404)
+		}
+
+		documents, err := ListPublicDocuments(c.UserContext(), (page-1)*sitemapSize, sitemapSize)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		base := links.Base(c)
+		set := URLSet{XMLNS: sitemapNamespace, URLs: []URL{}}
+
+		for _, doc := range documents {
+			set.URLs = append(set.URLs, URL{
+				Loc:     links.Document(base, doc.ID),
+				LastMod: time.Unix(doc.UpdatedAt, 0).UTC().Format(time.RFC3339),
+			})
+		}
+
+		return sendXML(c, set)
+	})
+}
+
+// sendXML responds with `v` as an XML document
+func sendXML(c *fiber.Ctx, v interface{}) error {
+	out, err := xml.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+
+	return c.Status(200).Send(append([]byte(xml.Header), out...))
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// bodyOverhead is how many times longer than its content a request body
+// may be, since JSON and form encoding escape some characters
+const bodyOverhead = 3
+
+// MaxLength returns how long, in bytes, documents created by `identity`
+// may be. Anonymous requests pass nil.
+func MaxLength(identity *auth.Identity) int {
+	documents := config.Config().Documents
+	max := documents.MaxDocumentLength
+
+	if identity == nil {
+		return max
+	}
+
+	if documents.AuthenticatedMaxLength > 0 {
+		max = documents.AuthenticatedMaxLength
+	}
+
+	if identity.IsAdmin() && documents.AdminMaxLength > 0 {
+		max = documents.AdminMaxLength
+	}
+
+	return max
+}
+
+// sizeLimit rejects requests whose declared body is too long to hold a
+// document the caller may create, before the body is parsed
+func sizeLimit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		max := MaxLength(auth.FromRequest(c))
+
+		if c.Request().Header.ContentLength() > max*bodyOverhead {
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("documents can't be longer than %d bytes", max))
+		}
+
+		return c.Next()
+	}
+}
+
+// checkLines returns an error if `content` has more lines, or longer ones,
+// than `documents.max_lines` and `documents.max_line_length` allow
+func checkLines(content string) error {
+	documents := config.Config().Documents
+
+	if documents.MaxLines > 0 && lineCount(content) > documents.MaxLines {
+		return fmt.Errorf("documents can't have more than %d lines", documents.MaxLines)
+	}
+
+	if documents.MaxLineLength > 0 {
+		for _, line := range strings.Split(content, "\n") {
+			if utf8.RuneCountInString(line) > documents.MaxLineLength {
+				return fmt.Errorf("lines can't be longer than %d characters", documents.MaxLineLength)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RawOnly reports whether `content` is only served raw, instead of being
+// split into lines, because it's opaque or past the line limits
+func RawOnly(content string) bool {
+	return Opaque(content) || checkLines(content) != nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StarredEntry is a document in an account's starred listing
+type StarredEntry struct {
+	ListEntry
+	StarredAt int64 `json:"starred_at"`
+}
+
+// Star bookmarks the document `id` for `identity`, starring it twice does
+// nothing
+func Star(ctx context.Context, identity *auth.Identity, id string) error {
+	if _, err := GetDocumentInfo(ctx, identity, id); err != nil {
+		return err
+	}
+
+	star := models.Star{Owner: identity.Name, DocumentID: id, CreatedAt: time.Now().Unix()}
+
+	return database.DBConn.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&star).Error
+}
+
+// Unstar removes the document `id` from the stars of `owner`
+func Unstar(ctx context.Context, owner, id string) error {
+	return database.DBConn.WithContext(ctx).
+		Where("owner = ? AND document_id = ?", owner, id).
+		Delete(&models.Star{}).Error
+}
+
+// Starred retrieves a page of the documents `identity` starred, most
+// recently starred first. Documents that can't be served to it anymore are
+// left out, so a page can be shorter than `limit`.
+func Starred(ctx context.Context, identity *auth.Identity, offset, limit int) ([]models.Star, []models.Document, error) {
+	stars := []models.Star{}
+	err := database.DBConn.WithContext(ctx).Where("owner = ?", identity.Name).
+		Order("created_at DESC").Offset(offset).Limit(limit).Find(&stars).Error
+
+	if err != nil || len(stars) == 0 {
+		return nil, nil, err
+	}
+
+	ids := make([]string, 0, len(stars))
+
+	for _, star := range stars {
+		ids = append(ids, star.DocumentID)
+	}
+
+	documents, err := GetDocuments(ctx, identity, ids)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Drop the stars of documents that were left out
+	kept := stars[:0]
+
+	for _, star := range stars {
+		if len(kept) < len(documents) && documents[len(kept)].ID == star.DocumentID {
+			kept = append(kept, star)
+		}
+	}
+
+	return kept, documents, nil
+}
+
+// registerStars loads the endpoints starring documents and listing them
+func registerStars(app *fiber.App, api fiber.Router) {
+	api.Put("/:id/star", auth.Require(), func(c *fiber.Ctx) error {
+		err := Star(c.UserContext(), auth.FromRequest(c), c.Params("id"))
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(404, err.Error())
+		}
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.SendStatus(204)
+	})
+
+	api.Delete("/:id/star", auth.Require(), func(c *fiber.Ctx) error {
+		if err := Unstar(c.UserContext(), auth.FromRequest(c).Name, c.Params("id")); err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.SendStatus(204)
+	})
+
+	app.Get("/v1/account/starred", auth.Require(), func(c *fiber.Ctx) error {
+		page, perPage, err := pagination(c)
+
+		if err != nil {
+			return err
+		}
+
+		stars, documents, err := Starred(c.UserContext(), auth.FromRequest(c), (page-1)*perPage, perPage)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		base := links.Base(c)
+		entries := make([]StarredEntry, 0, len(documents))
+
+		for i := range documents {
+			entries = append(entries, StarredEntry{ListEntry: NewListEntry(base, &documents[i]), StarredAt: stars[i].CreatedAt})
+		}
+
+		return c.Status(200).JSON(fiber.Map{"documents": entries, "page": page, "per_page": perPage})
+	})
+}
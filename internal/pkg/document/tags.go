@@ -0,0 +1,178 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"gorm.io/gorm"
+)
+
+// maxTagLength is how many characters a tag can have
+const maxTagLength = 32
+
+// TagsRequest represents a valid body object for the set tags request
+type TagsRequest struct {
+	Tags []string
+}
+
+// NormalizeTags lowercases `tags` and drops duplicates. Tags can't contain
+// whitespace or commas, and a document can have up to `documents.max_tags`.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags must be between 1 and %d characters long", maxTagLength)
+		}
+
+		if strings.IndexFunc(tag, func(r rune) bool { return unicode.IsSpace(r) || r == ',' }) != -1 {
+			return nil, errors.New("tags can't contain whitespace or commas")
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	if len(normalized) > 0 && config.Config().Documents.MaxTags == 0 {
+		return nil, errors.New("tagging is disabled")
+	}
+
+	if len(normalized) > config.Config().Documents.MaxTags {
+		return nil, fmt.Errorf("documents can have at most %d tags", config.Config().Documents.MaxTags)
+	}
+
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+// SetTags replaces the tags of document `id` with `tags`, which must
+// already be normalized
+func SetTags(tx *gorm.DB, id string, tags []string) error {
+	if err := tx.Where("document_id = ?", id).Delete(&models.DocumentTag{}).Error; err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	rows := make([]models.DocumentTag, 0, len(tags))
+
+	for _, tag := range tags {
+		rows = append(rows, models.DocumentTag{DocumentID: id, Tag: tag})
+	}
+
+	return tx.Create(&rows).Error
+}
+
+// GetTags retrieves the tags of each document in `ids`, sorted by name
+func GetTags(ctx context.Context, ids ...string) (map[string][]string, error) {
+	rows := []models.DocumentTag{}
+	err := database.DBConn.WithContext(ctx).Where("document_id IN ?", ids).Order("tag").Find(&rows).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string][]string, len(ids))
+
+	for _, row := range rows {
+		tags[row.DocumentID] = append(tags[row.DocumentID], row.Tag)
+	}
+
+	return tags, nil
+}
+
+// UpdateTags replaces the tags of document `id` on behalf of `identity`,
+// whose request came from `ip`
+func UpdateTags(ctx context.Context, identity *auth.Identity, id string, tags []string, ip net.IP) error {
+	document := models.Document{}
+	err := database.Transaction(ctx, func(tx *gorm.DB) error {
+		err := tx.Omit("content").Where("id = ? AND deleted_at = 0", id).First(&document).Error
+
+		if err != nil {
+			return err
+		}
+
+		if !CanManage(identity, &document) {
+			return ErrNotOwner
+		}
+
+		return SetTags(tx, id, tags)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	event := newEvent(events.Updated, &document, identity, ip)
+	event.Detail = "tags"
+	events.Publish(ctx, event)
+
+	return nil
+}
+
+// registerTags loads the endpoint replacing a document's tags
+func registerTags(api fiber.Router) {
+	api.Put("/:id/tags", auth.Require(), func(c *fiber.Ctx) error {
+		b := new(TagsRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		tags, err := NormalizeTags(b.Tags)
+
+		if err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		err = UpdateTags(c.UserContext(), auth.FromRequest(c), c.Params("id"), tags, clientip.IP(c))
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return fiber.NewError(404, err.Error())
+		case errors.Is(err, ErrNotOwner):
+			return fiber.NewError(403, err.Error())
+		case err != nil:
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{"tags": tags})
+	})
+}
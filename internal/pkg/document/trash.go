@@ -0,0 +1,185 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+	"gorm.io/gorm"
+)
+
+// ErrNotOwner is returned when someone other than the creator of a document,
+// or an admin, tries to change it
+var ErrNotOwner = errors.New("only the creator of a document can change it")
+
+// Delete moves the document `id` to the trash on behalf of `identity`,
+// whose request came from `ip`
+func Delete(ctx context.Context, identity *auth.Identity, id string, ip net.IP) error {
+	document := models.Document{}
+	err := database.Transaction(ctx, func(tx *gorm.DB) error {
+		err := tx.Omit("content").Where("id = ? AND deleted_at = 0", id).First(&document).Error
+
+		if err != nil {
+			return err
+		}
+
+		// Anonymous documents have no owner, so only admins can delete them
+		if !CanManage(identity, &document) {
+			return ErrNotOwner
+		}
+
+		return retention.Trash(tx, &document, identity.Name)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	events.Publish(ctx, newEvent(events.Deleted, &document, identity, ip))
+
+	return nil
+}
+
+// Restore takes the document `id` out of the trash on behalf of
+// `identity`, whose request came from `ip`. Owners can only restore
+// documents they deleted themselves, not ones removed by an admin.
+func Restore(ctx context.Context, identity *auth.Identity, id string, ip net.IP) error {
+	document := models.Document{}
+	err := database.Transaction(ctx, func(tx *gorm.DB) error {
+		err := tx.Omit("content").Where("id = ? AND deleted_at <> 0", id).First(&document).Error
+
+		if err != nil {
+			return err
+		}
+
+		if !canRestore(identity, &document) {
+			return ErrNotOwner
+		}
+
+		document.DeletedAt, document.DeletedBy = 0, ""
+
+		return tx.Model(&models.Document{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"deleted_at": 0,
+			"deleted_by": "",
+		}).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	events.Publish(ctx, newEvent(events.Restored, &document, identity, ip))
+
+	return nil
+}
+
+// PurgeTrash deletes documents that have been in the trash for longer than
+// `documents.trash_period`
+func PurgeTrash(ctx context.Context) error {
+	cutoff := time.Now().Unix() - config.Config().Documents.TrashPeriod
+	documents := []models.Document{}
+
+	err := database.Transaction(ctx, func(tx *gorm.DB) error {
+		err := tx.Omit("content").Where("deleted_at <> 0 AND deleted_at <= ?", cutoff).Find(&documents).Error
+
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, len(documents))
+
+		for i := range documents {
+			ids[i] = documents[i].ID
+		}
+
+		_, err = retention.Purge(tx, ids)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for i := range documents {
+		events.Publish(ctx, events.Event{Type: events.Purged, Document: &documents[i], Actor: audit.SystemActor})
+	}
+
+	return nil
+}
+
+// PruneOrphans deletes rows in retention.Dependents whose document doesn't
+// exist anymore. Documents are purged along with their rows, this cleans
+// up after older versions that left them behind. Idempotency keys still
+// being processed have no document yet, and are left alone.
+func PruneOrphans(ctx context.Context) error {
+	for _, table := range retention.Dependents {
+		documents := database.DBConn.Model(&models.Document{}).Select("id")
+		err := database.DBConn.WithContext(ctx).Where("document_id <> '' AND document_id NOT IN (?)", documents).Delete(table).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerTrash loads the endpoints deleting and restoring documents
+func registerTrash(api fiber.Router) {
+	api.Delete("/:id", auth.Require(), func(c *fiber.Ctx) error {
+		err := Delete(c.UserContext(), auth.FromRequest(c), c.Params("id"), clientip.IP(c))
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return fiber.NewError(404, err.Error())
+		case errors.Is(err, ErrNotOwner):
+			return fiber.NewError(403, err.Error())
+		case err != nil:
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.SendStatus(204)
+	})
+
+	api.Post("/:id/restore", auth.Require(), func(c *fiber.Ctx) error {
+		err := Restore(c.UserContext(), auth.FromRequest(c), c.Params("id"), clientip.IP(c))
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return fiber.NewError(404, "document isn't in the trash")
+		case errors.Is(err, ErrNotOwner):
+			return fiber.NewError(403, err.Error())
+		case err != nil:
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.SendStatus(204)
+	})
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxTrendingWindow is the longest window trending can be asked for, views
+// older than it are pruned
+const maxTrendingWindow = 7 * 24 * time.Hour
+
+// viewFlushInterval is how often counted views are written to the
+// database, so fetching a document doesn't wait for a write
+const viewFlushInterval = 10 * time.Second
+
+// viewKey identifies the views of a document within an hour
+type viewKey struct {
+	id   string
+	hour int64
+}
+
+// pendingViews are the views counted since they were last written
+var pendingViews = struct {
+	sync.Mutex
+	counts map[viewKey]int64
+}{counts: map[viewKey]int64{}}
+
+var (
+	stopViews = make(chan struct{})
+	viewsDone = make(chan struct{})
+)
+
+// TrendingEntry is a document in the trending listing
+type TrendingEntry struct {
+	ListEntry
+	Views int64   `json:"views"` // Views within the window.
+	Score float64 `json:"score"`
+}
+
+// Scored is a document ranked by its views
+type Scored struct {
+	Document models.Document
+	Views    int64
+	Score    float64
+}
+
+// recordView counts a view of `doc`. Only public documents are counted,
+// since nothing else is ever listed. Views are written in batches by
+// StartViews.
+func recordView(doc *models.Document) {
+	if !doc.Public {
+		return
+	}
+
+	pendingViews.Lock()
+	defer pendingViews.Unlock()
+
+	pendingViews.counts[viewKey{id: doc.ID, hour: time.Now().Truncate(time.Hour).Unix()}]++
+}
+
+// StartViews writes counted views to the database in the background, every
+// `viewFlushInterval`
+func StartViews() {
+	go func() {
+		defer close(viewsDone)
+
+		ticker := time.NewTicker(viewFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), viewFlushInterval)
+				FlushViews(ctx)
+				cancel()
+			case <-stopViews:
+				return
+			}
+		}
+	}()
+}
+
+// StopViews stops writing views in the background and writes the ones
+// still counted, unless `ctx` is done first
+func StopViews(ctx context.Context) {
+	close(stopViews)
+
+	select {
+	case <-viewsDone:
+	case <-ctx.Done():
+		return
+	}
+
+	FlushViews(ctx)
+}
+
+// FlushViews writes the views counted since the last flush. Views that
+// couldn't be written are kept for the next one.
+func FlushViews(ctx context.Context) {
+	pendingViews.Lock()
+	counts := pendingViews.counts
+	pendingViews.counts = map[viewKey]int64{}
+	pendingViews.Unlock()
+
+	for key, count := range counts {
+		view := models.DocumentView{DocumentID: key.id, Hour: key.hour, Count: count}
+		err := database.DBConn.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "document_id"}, {Name: "hour"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("document_views.count + ?", count)}),
+		}).Create(&view).Error
+
+		if err != nil {
+			log.Printf("Couldn't record views of %s: %v", key.id, err)
+
+			pendingViews.Lock()
+			pendingViews.counts[key] += count
+			pendingViews.Unlock()
+		}
+	}
+}
+
+// Trending ranks public documents by their views within `window`. Every
+// view's weight halves each half window, so recent views count the most.
+// Views are summed up by the database, which only returns the top
+// documents.
+func Trending(ctx context.Context, window time.Duration, limit int) ([]Scored, error) {
+	now := time.Now()
+	since := now.Add(-window).Truncate(time.Hour)
+	halfLife := window.Hours() / 2
+
+	// Views are counted by the hour, so each hour's weight is known up
+	// front. Not every database has POW, so the weights are spelled out.
+	weight := strings.Builder{}
+	weight.WriteString("CASE document_views.hour")
+
+	for hour := since; !hour.After(now); hour = hour.Add(time.Hour) {
+		w := math.Pow(0.5, now.Sub(hour).Hours()/halfLife)
+		weight.WriteString(" WHEN " + strconv.FormatInt(hour.Unix(), 10) + " THEN " + strconv.FormatFloat(w, 'f', -1, 64))
+	}
+
+	weight.WriteString(" ELSE 0 END")
+
+	// Documents expiring by retention rules are only dropped afterwards, so
+	// a few more than `limit` are asked for
+	totals := []struct {
+		DocumentID string
+		Views      int64
+		Score      float64
+	}{}
+	err := database.DBConn.WithContext(ctx).Table("document_views").
+		Select("document_views.document_id, SUM(document_views.count) AS views, SUM(document_views.count * "+weight.String()+") AS score").
+		Joins("JOIN documents ON documents.id = document_views.document_id").
+		Where("document_views.hour >= ? AND documents.public = ? AND documents.moderation <> ? AND documents.deleted_at = 0",
+			since.Unix(), true, models.ModerationQuarantined).
+		Group("document_views.document_id").Order("score DESC").Limit(2 * limit).Scan(&totals).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]*Scored, len(totals))
+	ids := make([]string, 0, len(totals))
+
+	for _, total := range totals {
+		scores[total.DocumentID] = &Scored{Views: total.Views, Score: total.Score}
+		ids = append(ids, total.DocumentID)
+	}
+
+	documents := []models.Document{}
+
+	if len(ids) > 0 {
+		documents, err = publicDocuments(database.DBConn.WithContext(ctx).Where("id IN ?", ids), 0, len(ids))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Documents that aren't public anymore, or are gone, aren't ranked
+	ranked := make([]Scored, 0, len(documents))
+
+	for _, doc := range documents {
+		entry := scores[doc.ID]
+		entry.Document = doc
+		ranked = append(ranked, *entry)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	return ranked, nil
+}
+
+// PruneViews deletes view counts too old to affect trending
+func PruneViews(ctx context.Context) error {
+	return database.DBConn.WithContext(ctx).
+		Where("hour < ?", time.Now().Add(-maxTrendingWindow).Unix()).
+		Delete(&models.DocumentView{}).Error
+}
+
+// registerTrending loads the listing of the most viewed public documents
+func registerTrending(app *fiber.App, listing, fetchLimit fiber.Handler) {
+	app.Get("/v1/trending", listing, fetchLimit, func(c *fiber.Ctx) error {
+		window, err := time.ParseDuration(c.Query("window", "24h"))
+
+		if err != nil || window < time.Hour || window > maxTrendingWindow {
+			return fiber.NewError(400, "window must be a duration between 1h and 168h")
+		}
+
+		ranked, err := Trending(c.UserContext(), window, 20)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		base := links.Base(c)
+		entries := make([]TrendingEntry, 0, len(ranked))
+
+		for _, r := range ranked {
+			entries = append(entries, TrendingEntry{
+				ListEntry: NewListEntry(base, &r.Document),
+				Views:     r.Views,
+				Score:     r.Score,
+			})
+		}
+
+		return c.Status(200).JSON(fiber.Map{"documents": entries, "window": window.String()})
+	})
+}
@@ -20,17 +20,30 @@ import (
 	"regexp"
 
 	validation "github.com/go-ozzo/ozzo-validation"
-	"github.com/spacebin-org/spirit/internal/pkg/config"
 )
 
 // CreateRequest represents a valid body object for the create document request
 type CreateRequest struct {
 	Content   string
 	Extension string
+	Expiry    int64 // Seconds until the document expires, overriding retention rules.
+	Public    bool  // Same as a "public" visibility, kept for older clients.
+	Shorten   bool  // Whether the content is a URL to redirect to.
+	Tags      []string
+
+	// "public", "unlisted" or "private", unlisted unless Public is set
+	Visibility string
+
+	// Organization to share the document with, the creator must be a member
+	Organization string
+
+	// Set by Create to the transforms Normalize applied to Content
+	Normalized []string `json:"-" form:"-"`
 }
 
-// Validate performs validation on the body
-func (c CreateRequest) Validate() error {
+// Validate performs validation on the body, allowing content of up to
+// `maxLength` bytes
+func (c CreateRequest) Validate(maxLength int) error {
 	/*
 	 * This regex matches the file extension for various languages.
 
@@ -49,7 +62,7 @@ func (c CreateRequest) Validate() error {
 			&c.Content,
 			validation.Required,
 			// Enforce length to follow what's set in the config
-			validation.Length(2, config.Config.Documents.MaxDocumentLength),
+			validation.Length(2, maxLength),
 		),
 		// The purpose of this field is to support client's that perform
 		// syntax highlighting and need to know what highlighter to use.
@@ -58,5 +71,7 @@ func (c CreateRequest) Validate() error {
 			validation.Match(regex),
 			validation.Required,
 		),
+		validation.Field(&c.Expiry, validation.Min(int64(0))),
+		validation.Field(&c.Visibility, validation.In(VisibilityPublic, VisibilityUnlisted, VisibilityPrivate)),
 	)
 }
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// Visibility levels of a document
+const (
+	VisibilityPublic   = "public"   // Listed on /v1/public, /v1/trending and its owner's feed.
+	VisibilityUnlisted = "unlisted" // Served to anyone who knows the ID.
+	VisibilityPrivate  = "private"  // Only served to whoever can manage it and its organization.
+)
+
+// Visibility returns the visibility level of `doc`
+func Visibility(doc *models.Document) string {
+	switch {
+	case doc.Private:
+		return VisibilityPrivate
+	case doc.Public:
+		return VisibilityPublic
+	default:
+		return VisibilityUnlisted
+	}
+}
+
+// CanView reports whether `doc` may be served to `identity`, which is nil
+// for anonymous requests
+func CanView(identity *auth.Identity, doc *models.Document) bool {
+	if !doc.Private {
+		return true
+	}
+
+	return CanManage(identity, doc) || (doc.Organization != "" && identity.OrgRole(doc.Organization) != "")
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+import (
+	"testing"
+
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+func TestCanView(t *testing.T) {
+	configtest.Load(t, `
+[[auth.tokens]]
+name = "carol"
+token = "carol-token"
+role = "user"
+
+[[auth.tokens]]
+name = "dave"
+token = "dave-token"
+role = "user"
+
+[[auth.tokens]]
+name = "erin"
+token = "erin-token"
+role = "user"
+
+[[auth.organizations]]
+name = "ops"
+members = ["carol"]
+maintainers = ["dave"]
+
+[[auth.organizations]]
+name = "dev"
+members = ["erin"]
+`)
+
+	user := func(name string) *auth.Identity {
+		return &auth.Identity{Name: name, Role: auth.RoleUser}
+	}
+
+	public := &models.Document{Owner: "alice"}
+	private := &models.Document{Owner: "alice", Private: true}
+	shared := &models.Document{Owner: "alice", Private: true, Organization: "ops"}
+
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		doc      *models.Document
+		want     bool
+	}{
+		{"public to anonymous", nil, public, true},
+		{"public to anyone", user("bob"), public, true},
+		{"private to anonymous", nil, private, false},
+		{"private to its owner", user("alice"), private, true},
+		{"private to someone else", user("bob"), private, false},
+		{"private to an admin", &auth.Identity{Name: "root", Role: auth.RoleAdmin}, private, true},
+		{"private to a member of no organization", user("carol"), private, false},
+		{"organization to a member", user("carol"), shared, true},
+		{"organization to a maintainer", user("dave"), shared, true},
+		{"organization to a member of another", user("erin"), shared, false},
+		{"organization to anonymous", nil, shared, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanView(tt.identity, tt.doc); got != tt.want {
+				t.Errorf("CanView() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package document
+
+// words are combined into memorable IDs, they're short, easy to spell and
+// unambiguous when read aloud
+var words = []string{
+	"acorn", "alder", "amber", "anchor", "apple", "apricot", "arch", "arrow", "aspen", "aster",
+	"atlas", "aurora", "autumn", "badger", "bamboo", "banjo", "barley", "basil", "bay", "beacon",
+	"bear", "beaver", "bee", "beetle", "berry", "birch", "bison", "blossom", "boulder", "bramble",
+	"breeze", "brook", "buffalo", "butter", "cactus", "camel", "canyon", "cardinal", "carrot", "castle",
+	"cedar", "cello", "chalk", "cherry", "chestnut", "cinder", "citrus", "clay", "cliff", "clover",
+	"cobalt", "cocoa", "comet", "condor", "coral", "cosmos", "cotton", "cougar", "coyote", "crane",
+	"crater", "creek", "cricket", "crow", "crystal", "cypress", "daisy", "dawn", "delta", "desert",
+	"dew", "dingo", "dolphin", "dove", "dragon", "drift", "dune", "eagle", "ember", "falcon",
+	"fern", "ferret", "fig", "finch", "fjord", "flame", "flint", "forest", "fox", "frost",
+	"galaxy", "garnet", "gazelle", "gecko", "geyser", "ginger", "glacier", "goose", "granite", "grape",
+	"grove", "gull", "harbor", "hawk", "hazel", "heron", "hickory", "hill", "honey", "horizon",
+	"hornet", "husky", "ibis", "iris", "island", "ivy", "jade", "jaguar", "jasmine", "jay",
+	"juniper", "kelp", "kestrel", "kiwi", "koala", "lagoon", "lake", "lark", "laurel", "lava",
+	"lemon", "lemur", "lichen", "lily", "lime", "linden", "lion", "lotus", "lynx", "magnet",
+	"mango", "maple", "marble", "marsh", "meadow", "melon", "mesa", "meteor", "mint", "mist",
+	"moon", "moose", "moss", "moth", "mountain", "nectar", "nebula", "newt", "nutmeg", "oak",
+	"oasis", "ocean", "olive", "onyx", "orbit", "orchid", "osprey", "otter", "owl", "oyster",
+	"panda", "panther", "papaya", "parrot", "peach", "pear", "pebble", "pelican", "pepper", "pine",
+	"planet", "plum", "pond", "poppy", "prairie", "puffin", "quail", "quartz", "rabbit", "raven",
+	"reef", "ridge", "river", "robin", "rose", "ruby", "sage", "salmon", "sand", "sapphire",
+	"saturn", "shadow", "shell", "sierra", "silver", "sky", "sloth", "snow", "sparrow", "spruce",
+	"squid", "star", "stone", "storm", "summit", "sun", "swan", "thistle", "thunder", "tiger",
+	"timber", "topaz", "trout", "tulip", "tundra", "turtle", "valley", "velvet", "violet", "volcano",
+	"walnut", "walrus", "wave", "willow", "wind", "wolf", "wren", "yak", "zebra", "zephyr",
+}
@@ -25,11 +25,34 @@ type Payload struct {
 	CreatedAt   *int64  `json:"created_at,omitempty"`   // The Unix timestamp of when the document was inserted.
 	UpdatedAt   *int64  `json:"updated_at,omitempty"`   // The Unix timestamp of when the document was last modified.
 	Exists      *bool   `json:"exists,omitempty"`       // Whether the document does or does not exist.
+	GistURL     string  `json:"gist_url,omitempty"`     // Where the document was exported to on GitHub.
+	Public      bool    `json:"public,omitempty"`       // Whether the document is listed publicly.
+	Shortened   bool    `json:"shortened,omitempty"`    // Whether /:id redirects to the URL in the content.
+
+	Tags         []string `json:"tags,omitempty"`         // Free-form labels set by the creator.
+	Organization string   `json:"organization,omitempty"` // The organization the document is shared with.
+	Visibility   string   `json:"visibility,omitempty"`   // "public", "unlisted" or "private".
+	Normalized   []string `json:"normalized,omitempty"`   // Transforms applied to the content on creation.
+
+	Annotations []Annotation `json:"annotations,omitempty"` // Notes on ranges of lines.
+	RawOnly     bool         `json:"raw_only,omitempty"`    // Whether clients should show the content without highlighting.
+}
+
+// Annotation is a note on a range of lines of a document
+type Annotation struct {
+	ID        uint   `json:"id"`
+	StartLine int    `json:"start_line"` // Counted from 1.
+	EndLine   int    `json:"end_line"`   // Inclusive.
+	Author    string `json:"author"`
+	Body      string `json:"body"` // Markdown as it was written.
+	HTML      string `json:"html"` // The body rendered to HTML.
+	CreatedAt int64  `json:"created_at"`
 }
 
 // Response is a Spacebin API response
 type Response struct {
-	Error   string  `json:"error"` // .Error() should already be called
-	Payload Payload `json:"payload"`
-	Status  int     `json:"status"`
+	Error     string  `json:"error"` // .Error() should already be called
+	Payload   Payload `json:"payload"`
+	Status    int     `json:"status"`
+	RequestID string  `json:"request_id,omitempty"` // Only set on errors.
 }
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// Types of document lifecycle events
+const (
+	Created  = "document.created"
+	Viewed   = "document.viewed"
+	Updated  = "document.updated"
+	Deleted  = "document.deleted"  // moved to the trash
+	Restored = "document.restored" // taken out of the trash
+	Expired  = "document.expired"
+	Purged   = "document.purged" // deleted for good, from the trash or with its owner's account
+)
+
+// Event is something that happened to a document
+type Event struct {
+	Type     string
+	Document *models.Document // As it is after the event. The content isn't always loaded.
+	Actor    string           // Name of the token, "anonymous" or "system".
+	IP       string           // Of the client, empty for the server's own events.
+	Detail   string           // How a document was viewed, or what was updated.
+	At       time.Time
+}
+
+// Handler reacts to an event. It's run by the publisher, handlers doing
+// slow work should hand it off to a goroutine.
+type Handler func(ctx context.Context, event Event)
+
+type subscription struct {
+	types   map[string]bool
+	handler Handler
+}
+
+var subscriptions []subscription
+
+// Subscribe registers `handler` for events of `types`, or every event if
+// none are given. Handlers must be subscribed before the server starts.
+func Subscribe(handler Handler, types ...string) {
+	sub := subscription{types: make(map[string]bool, len(types)), handler: handler}
+
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	subscriptions = append(subscriptions, sub)
+}
+
+// Publish runs the handlers subscribed to `event`, in the order they were
+// subscribed
+func Publish(ctx context.Context, event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	for _, sub := range subscriptions {
+		if len(sub.types) == 0 || sub.types[event.Type] {
+			sub.handler(ctx, event)
+		}
+	}
+}
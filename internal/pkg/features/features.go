@@ -0,0 +1,192 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package features
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// Names of the feature flags
+const (
+	Comments      = "comments"
+	PublicListing = "public_listing"
+	Print         = "print"
+	PDF           = "pdf"
+	Image         = "image"
+)
+
+// Flag is a feature that can be switched on and off per instance
+type Flag struct {
+	Name        string
+	Description string
+	Default     func() bool // from the config
+}
+
+// Flags are every feature flag, in the order they're listed
+var Flags = []Flag{
+	{Comments, "Threaded comments below documents", func() bool { return config.Config().Comments.Enabled }},
+	{PublicListing, "Listings, trending documents and sitemaps of public documents", func() bool { return config.Config().Documents.PublicListing }},
+	{Print, "Print-friendly view of documents on /:id/print", func() bool { return config.Config().Features.Print }},
+	{PDF, "PDF export of documents", func() bool { return config.Config().Features.PDF }},
+	{Image, "PNG images of documents' code", func() bool { return config.Config().Features.Image }},
+}
+
+// refreshInterval is how long overrides are cached for, so changes made
+// on other instances are picked up
+const refreshInterval = 30 * time.Second
+
+var (
+	mu        sync.Mutex
+	overrides map[string]bool // nil until they were first loaded
+	loadedAt  time.Time       // of the last attempt, successful or not
+)
+
+// Known reports whether `name` is a feature flag
+func Known(name string) bool {
+	_, ok := lookup(name)
+	return ok
+}
+
+func lookup(name string) (Flag, bool) {
+	for _, flag := range Flags {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+
+	return Flag{}, false
+}
+
+// Enabled reports whether feature `name` is on, which administrators can
+// override at runtime. Unknown features are off.
+func Enabled(name string) bool {
+	flag, ok := lookup(name)
+
+	if !ok {
+		return false
+	}
+
+	if on, ok := cached()[name]; ok {
+		return on
+	}
+
+	return flag.Default()
+}
+
+// All returns whether each feature is on, by name
+func All() map[string]bool {
+	enabled := make(map[string]bool, len(Flags))
+
+	for _, flag := range Flags {
+		enabled[flag.Name] = Enabled(flag.Name)
+	}
+
+	return enabled
+}
+
+// cached returns the overrides stored in the database, loading them again
+// once they're older than refreshInterval. Only one caller loads them, the
+// others keep using the previous ones meanwhile. If loading fails those are
+// kept until the next interval, so a database outage doesn't hold up every
+// request.
+func cached() map[string]bool {
+	mu.Lock()
+	current := overrides
+	stale := time.Since(loadedAt) >= refreshInterval
+
+	if stale {
+		loadedAt = time.Now()
+	}
+
+	mu.Unlock()
+
+	if !stale {
+		return current
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows := []models.FeatureFlag{}
+
+	if err := database.DBConn.WithContext(ctx).Find(&rows).Error; err != nil {
+		log.Printf("Couldn't load feature flags: %v", err)
+		return current
+	}
+
+	loaded := make(map[string]bool, len(rows))
+
+	for _, row := range rows {
+		loaded[row.Name] = row.Enabled
+	}
+
+	mu.Lock()
+	overrides = loaded
+	mu.Unlock()
+
+	return loaded
+}
+
+// Override switches feature `name` on or off regardless of the config
+func Override(ctx context.Context, name string, enabled bool, by string) error {
+	err := database.DBConn.WithContext(ctx).Save(&models.FeatureFlag{
+		Name:      name,
+		Enabled:   enabled,
+		UpdatedBy: by,
+		UpdatedAt: time.Now().Unix(),
+	}).Error
+
+	invalidate()
+
+	return err
+}
+
+// Reset removes the override of feature `name`, so it follows the config
+func Reset(ctx context.Context, name string) error {
+	err := database.DBConn.WithContext(ctx).Delete(&models.FeatureFlag{Name: name}).Error
+
+	invalidate()
+
+	return err
+}
+
+// invalidate makes the next caller load the overrides again
+func invalidate() {
+	mu.Lock()
+	loadedAt = time.Time{}
+	mu.Unlock()
+}
+
+// Require responds with a 404 while feature `name` is off, as if its
+// endpoints didn't exist
+func Require(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !Enabled(name) {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package features
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// State is a feature flag as administrators see it
+type State struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Enabled     bool                `json:"enabled"`
+	Default     bool                `json:"default"`            // from the config
+	Override    *models.FeatureFlag `json:"override,omitempty"` // set by an administrator
+}
+
+// Register loads the endpoints administrators override feature flags with.
+// Everyone can see which are on in /v1/config.
+func Register(app *fiber.App) {
+	app.Get("/v1/admin/features", auth.RequireAdmin(), func(c *fiber.Ctx) error {
+		rows := []models.FeatureFlag{}
+
+		if err := database.DBConn.WithContext(c.UserContext()).Find(&rows).Error; err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		states := make([]State, len(Flags))
+
+		for i, flag := range Flags {
+			states[i] = State{
+				Name:        flag.Name,
+				Description: flag.Description,
+				Enabled:     Enabled(flag.Name),
+				Default:     flag.Default(),
+			}
+
+			for j := range rows {
+				if rows[j].Name == flag.Name {
+					states[i].Override = &rows[j]
+				}
+			}
+		}
+
+		return c.Status(200).JSON(fiber.Map{"features": states})
+	})
+
+	app.Put("/v1/admin/features/:name", auth.RequireAdmin(), func(c *fiber.Ctx) error {
+		if !Known(c.Params("name")) {
+			return fiber.NewError(404, "unknown feature flag")
+		}
+
+		b := struct {
+			Enabled *bool `json:"enabled"`
+		}{}
+
+		if err := c.BodyParser(&b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if b.Enabled == nil {
+			return fiber.NewError(400, "enabled is required")
+		}
+
+		if err := Override(c.UserContext(), c.Params("name"), *b.Enabled, auth.FromRequest(c).Name); err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		detail := "off"
+
+		if *b.Enabled {
+			detail = "on"
+		}
+
+		audit.FromRequest(c, audit.FeatureOverridden, c.Params("name"), detail)
+
+		return c.SendStatus(204)
+	})
+
+	app.Delete("/v1/admin/features/:name", auth.RequireAdmin(), func(c *fiber.Ctx) error {
+		if !Known(c.Params("name")) {
+			return fiber.NewError(404, "unknown feature flag")
+		}
+
+		if err := Reset(c.UserContext(), c.Params("name")); err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		audit.FromRequest(c, audit.FeatureReset, c.Params("name"), "")
+
+		return c.SendStatus(204)
+	})
+}
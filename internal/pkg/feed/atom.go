@@ -0,0 +1,111 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// entries is how many documents a feed lists
+const entries = 50
+
+// Link is an Atom link
+type Link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// Entry is one document in a feed
+type Entry struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Link      Link   `xml:"link"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// Feed is an Atom feed of an account's public documents
+type Feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Author  string   `xml:"author>name"`
+	Links   []Link   `xml:"link"`
+	Updated string   `xml:"updated"`
+	Entries []Entry  `xml:"entry"`
+}
+
+// Register loads the feed endpoints
+func Register(app *fiber.App) {
+	app.Get("/feed/:username.atom", func(c *fiber.Ctx) error {
+		username := c.Params("username")
+		documents, err := document.GetPublicDocuments(c.UserContext(), username, entries)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		base := links.Base(c)
+		self := base + "/feed/" + username + ".atom"
+		feed := Feed{
+			ID:      self,
+			Title:   username + "'s documents on Spacebin",
+			Author:  username,
+			Links:   []Link{{Href: self, Rel: "self", Type: "application/atom+xml"}},
+			Updated: timestamp(time.Now().Unix()),
+			Entries: []Entry{},
+		}
+
+		// The feed was last updated when its newest document was
+		if len(documents) > 0 {
+			feed.Updated = timestamp(documents[0].UpdatedAt)
+		}
+
+		for _, doc := range documents {
+			link := links.Document(base, doc.ID)
+
+			feed.Entries = append(feed.Entries, Entry{
+				ID:        link,
+				Title:     doc.ID + "." + document.FileExtension(doc.Extension),
+				Link:      Link{Href: link},
+				Published: timestamp(doc.CreatedAt),
+				Updated:   timestamp(doc.UpdatedAt),
+			})
+		}
+
+		out, err := xml.MarshalIndent(feed, "", "  ")
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		c.Set(fiber.HeaderContentType, "application/atom+xml; charset=utf-8")
+
+		return c.Status(200).Send(append([]byte(xml.Header), out...))
+	})
+}
+
+// timestamp formats a unix timestamp the way Atom expects
+func timestamp(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Client talks to GitHub on behalf of an OAuth app
+type Client struct {
+	ClientID     string
+	ClientSecret string
+	OAuthURL     string // e.g. https://github.com
+	APIURL       string // e.g. https://api.github.com
+	TokenKey     string // encrypts stored tokens, ClientSecret is used if empty
+}
+
+// AuthorizeURL is where users are sent to let the app create gists
+func (g *Client) AuthorizeURL(redirect, state string) string {
+	return g.OAuthURL + "/login/oauth/authorize?" + url.Values{
+		"client_id":    {g.ClientID},
+		"redirect_uri": {redirect},
+		"scope":        {"gist"},
+		"state":        {state},
+	}.Encode()
+}
+
+// Exchange trades the code GitHub redirected back with for a token
+func (g *Client) Exchange(ctx context.Context, code string) (string, error) {
+	body := url.Values{
+		"client_id":     {g.ClientID},
+		"client_secret": {g.ClientSecret},
+		"code":          {code},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.OAuthURL+"/login/oauth/access_token", bytes.NewBufferString(body.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := do(req, &result); err != nil {
+		return "", err
+	}
+
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("github refused the code: %s", result.ErrorDescription)
+	}
+
+	return result.AccessToken, nil
+}
+
+// Create creates a gist containing a single file and returns its URL
+func (g *Client) Create(ctx context.Context, token, filename, content string, public bool) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"public": public,
+		"files": map[string]interface{}{
+			filename: map[string]string{"content": content},
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.APIURL+"/gists", bytes.NewReader(payload))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+
+	if err := do(req, &result); err != nil {
+		return "", err
+	}
+
+	if result.HTMLURL == "" {
+		return "", errors.New("github didn't return a gist URL")
+	}
+
+	return result.HTMLURL, nil
+}
+
+// ErrUnauthorized is returned when GitHub doesn't accept a token anymore
+var ErrUnauthorized = errors.New("github token was revoked or has expired")
+
+func do(req *http.Request, out interface{}) error {
+	res, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("github responded with %s", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
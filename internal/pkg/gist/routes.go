@@ -0,0 +1,301 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gist
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// stateExpiry is how long users have to authorize the app on GitHub
+const stateExpiry = 10 * time.Minute
+
+// nonceCookie binds the state to the browser that started linking, so
+// nobody can get someone else's browser to finish it
+const nonceCookie = "spirit_github_nonce"
+
+// callbackPath is where GitHub sends users back to
+const callbackPath = "/v1/account/github/callback"
+
+// Register loads the endpoints linking accounts with GitHub and exporting
+// documents to gists. It's a no-op unless a GitHub OAuth app is configured.
+func Register(app *fiber.App) {
+	cfg := config.Config().GitHub
+
+	if cfg.ClientID == "" {
+		return
+	}
+
+	g := &Client{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		OAuthURL:     strings.TrimSuffix(cfg.OAuthURL, "/"),
+		APIURL:       strings.TrimSuffix(cfg.APIURL, "/"),
+		TokenKey:     cfg.TokenKey,
+	}
+
+	// The URL the user has to open to link their GitHub account. It has to
+	// be requested from the browser that opens it, the nonce in the state
+	// is also kept in a cookie only that browser gets.
+	app.Get("/v1/account/github/authorize", auth.Require(), func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+		redirect := links.Base(c) + callbackPath
+		expires := time.Now().Add(stateExpiry)
+
+		nonce, err := newNonce()
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		setNonce(c, nonce, expires)
+
+		return c.Status(200).JSON(fiber.Map{
+			"url": g.AuthorizeURL(redirect, g.state(identity.Name, nonce, expires)),
+		})
+	})
+
+	// GitHub redirects the user's browser here, so there's no auth token and
+	// the account comes from the signed state instead
+	app.Get(callbackPath, func(c *fiber.Ctx) error {
+		owner, nonce, err := g.verifyState(c.Query("state"))
+
+		if err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		// The nonce is only good once
+		cookie := c.Cookies(nonceCookie)
+		setNonce(c, "", time.Unix(0, 0))
+
+		if cookie == "" || !hmac.Equal([]byte(cookie), []byte(nonce)) {
+			return fiber.NewError(400, "linking has to be finished in the browser that started it")
+		}
+
+		token, err := g.Exchange(c.UserContext(), c.Query("code"))
+
+		if err != nil {
+			return fiber.NewError(502, err.Error())
+		}
+
+		sealed, err := g.seal(token)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		err = database.DBConn.WithContext(c.UserContext()).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&models.GitHubToken{Owner: owner, Token: sealed}).Error
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		audit.FromRequestAs(c, owner, audit.GitHubLinked, "", "")
+
+		return c.Status(200).JSON(fiber.Map{"linked": true})
+	})
+
+	app.Delete("/v1/account/github", auth.Require(), func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+		err := database.DBConn.WithContext(c.UserContext()).
+			Where("owner = ?", identity.Name).Delete(&models.GitHubToken{}).Error
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		audit.FromRequest(c, audit.GitHubUnlinked, "", "")
+
+		return c.SendStatus(204)
+	})
+
+	app.Post("/v1/documents/:id/export/gist", auth.Require(), func(c *fiber.Ctx) error {
+		b := new(ExportRequest)
+
+		// An empty body creates a secret gist
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(b); err != nil {
+				return fiber.NewError(400, err.Error())
+			}
+		}
+
+		url, err := export(c.UserContext(), g, auth.FromRequest(c), c.Params("id"), b.Public, clientip.IP(c))
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return fiber.NewError(404, err.Error())
+		case errors.Is(err, ErrNotLinked), errors.Is(err, ErrUnauthorized), errors.Is(err, errUnreadableToken):
+			return fiber.NewError(409, err.Error())
+		case errors.Is(err, ErrNotOwner):
+			return fiber.NewError(403, err.Error())
+		case err != nil:
+			return fiber.NewError(502, err.Error())
+		}
+
+		audit.FromRequest(c, audit.DocumentExportedGist, "document:"+c.Params("id"), url)
+
+		return c.Status(201).JSON(fiber.Map{"url": url})
+	})
+}
+
+// ExportRequest represents a valid body object for the export request
+type ExportRequest struct {
+	Public bool
+}
+
+// Errors returned when exporting a document
+var (
+	ErrNotLinked = errors.New("account isn't linked with github")
+	ErrNotOwner  = errors.New("only the creator of a document can export it")
+)
+
+// export creates a gist from the document `id` with the GitHub token of
+// `identity`, whose request came from `ip`, and records its URL on the
+// document
+func export(ctx context.Context, g *Client, identity *auth.Identity, id string, public bool, ip net.IP) (string, error) {
+	doc, err := document.GetDocument(ctx, identity, id)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !document.CanManage(identity, doc) {
+		return "", ErrNotOwner
+	}
+
+	token := models.GitHubToken{}
+	err = database.DBConn.WithContext(ctx).Where("owner = ?", identity.Name).First(&token).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrNotLinked
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := g.open(token.Token)
+
+	if err != nil {
+		return "", err
+	}
+
+	url, err := g.Create(ctx, plain, doc.ID+"."+document.FileExtension(doc.Extension), doc.Content, public)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.DBConn.WithContext(ctx).Model(doc).Update("gist_url", url).Error; err != nil {
+		return url, err
+	}
+
+	doc.GistURL = url
+	events.Publish(ctx, events.Event{Type: events.Updated, Document: doc, Actor: identity.Name, IP: ip.String(), Detail: "gist"})
+
+	return url, nil
+}
+
+// state signs `owner`, the browser's `nonce` and an expiry, so the
+// callback knows which account to link without storing anything
+func (g *Client) state(owner, nonce string, expires time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(owner)) + "." + nonce + "." + strconv.FormatInt(expires.Unix(), 10)
+
+	return body + "." + g.sign(body)
+}
+
+// verifyState returns the owner and nonce of a state made by state
+func (g *Client) verifyState(state string) (string, string, error) {
+	parts := strings.Split(state, ".")
+
+	if len(parts) != 4 || !hmac.Equal([]byte(g.sign(strings.Join(parts[:3], "."))), []byte(parts[3])) {
+		return "", "", errors.New("state is invalid")
+	}
+
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+
+	if err != nil || time.Now().Unix() > expiry {
+		return "", "", errors.New("state has expired, authorize again")
+	}
+
+	owner, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return "", "", errors.New("state is invalid")
+	}
+
+	return string(owner), parts[1], nil
+}
+
+// newNonce returns a random value identifying one attempt at linking
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// setNonce stores `nonce` in the browser until `expires`, a past expiry
+// deletes it
+func setNonce(c *fiber.Ctx, nonce string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     nonceCookie,
+		Value:    nonce,
+		Path:     callbackPath,
+		Expires:  expires,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		// GitHub's redirect is a top-level navigation, which Lax allows
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// sign returns a hex-encoded HMAC-SHA256 of `body`, keyed with the app's
+// client secret
+func (g *Client) sign(body string) string {
+	mac := hmac.New(sha256.New, []byte(g.ClientSecret))
+	mac.Write([]byte(body))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
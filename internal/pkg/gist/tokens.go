@@ -0,0 +1,95 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gist
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// tokenPrefix marks tokens encrypted by seal, rows stored before tokens
+// were encrypted hold them as they are
+const tokenPrefix = "v1:"
+
+// errUnreadableToken is returned for tokens encrypted with another key
+var errUnreadableToken = errors.New("stored github token can't be decrypted, link the account again")
+
+// seal encrypts `token` for storing it in the database
+func (g *Client) seal(token string) (string, error) {
+	aead, err := g.aead()
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return tokenPrefix + base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+// open decrypts a token stored with seal
+func (g *Client) open(stored string) (string, error) {
+	if !strings.HasPrefix(stored, tokenPrefix) {
+		return stored, nil
+	}
+
+	aead, err := g.aead()
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(stored, tokenPrefix))
+
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errUnreadableToken
+	}
+
+	token, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+
+	if err != nil {
+		return "", errUnreadableToken
+	}
+
+	return string(token), nil
+}
+
+func (g *Client) aead() (cipher.AEAD, error) {
+	secret := g.TokenKey
+
+	if secret == "" {
+		secret = g.ClientSecret
+	}
+
+	key := sha256.Sum256([]byte("spirit github tokens:" + secret))
+	block, err := aes.NewCipher(key[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// Check is the result of checking a single dependency
+type Check struct {
+	Status string `json:"status"`          // Either "ok" or "unavailable".
+	Error  string `json:"error,omitempty"` // Why the check failed.
+}
+
+// Report is the body returned by the probe endpoints
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+// Register loads the liveness and readiness probes
+func Register(app *fiber.App) {
+	// Liveness only proves the process is able to serve requests
+	app.Get("/healthz", func(c *fiber.Ctx) error {
+		return c.Status(200).JSON(&Report{Status: "ok"})
+	})
+
+	// Readiness checks everything a request needs to succeed
+	app.Get("/readyz", func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), 2*time.Second)
+		defer cancel()
+
+		report := Report{
+			Status: "ok",
+			Checks: map[string]Check{
+				"database":   check(pingDatabase(ctx)),
+				"migrations": check(checkMigrations(ctx)),
+			},
+		}
+
+		code := 200
+
+		for _, result := range report.Checks {
+			if result.Status != "ok" {
+				report.Status = "unavailable"
+				code = fiber.StatusServiceUnavailable
+			}
+		}
+
+		return c.Status(code).JSON(&report)
+	})
+}
+
+func check(err error) Check {
+	if err != nil {
+		return Check{Status: "unavailable", Error: err.Error()}
+	}
+
+	return Check{Status: "ok"}
+}
+
+func pingDatabase(ctx context.Context) error {
+	db, err := database.DBConn.DB()
+
+	if err != nil {
+		return err
+	}
+
+	return db.PingContext(ctx)
+}
+
+func checkMigrations(ctx context.Context) error {
+	migrator := database.DBConn.WithContext(ctx).Migrator()
+
+	if !migrator.HasTable(&models.Document{}) {
+		return errors.New("documents table is missing")
+	}
+
+	return nil
+}
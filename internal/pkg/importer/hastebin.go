@@ -0,0 +1,182 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * Hastebin's file store keeps every document in its own file, named after
+ * the MD5 hash of the document's key. Keys can't be recovered from the hash,
+ * so they're only preserved when a list of known keys is given, e.g. from
+ * access logs. Documents with unknown keys get a new ID.
+
+ * PrivateBin pastes are encrypted in the browser, the server never sees
+ * their content, so they can't be imported as readable documents.
+ */
+
+package importer
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+)
+
+// Imported maps a hastebin document to the document it became
+type Imported struct {
+	File string // Name of the file in the hastebin data directory.
+	Key  string // Original key, empty if it wasn't known.
+	ID   string
+}
+
+// Skipped is a file that couldn't be imported
+type Skipped struct {
+	File   string
+	Reason string
+}
+
+// Result lists what happened to every file in the data directory
+type Result struct {
+	Imported []Imported
+	Skipped  []Skipped
+}
+
+// Hastebin imports every document in a hastebin file store at `dir`. `keys`
+// are the known keys of those documents, used to keep their IDs.
+func Hastebin(ctx context.Context, dir string, keys []string) (*Result, error) {
+	hashes := make(map[string]string, len(keys))
+
+	for _, key := range keys {
+		sum := md5.Sum([]byte(key))
+		hashes[hex.EncodeToString(sum[:])] = key
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		info, err := entry.Info()
+
+		if err != nil {
+			return result, err
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, name))
+
+		if err != nil {
+			return result, err
+		}
+
+		if reason := check(content); reason != "" {
+			result.Skipped = append(result.Skipped, Skipped{File: name, Reason: reason})
+			continue
+		}
+
+		key := hashes[strings.ToLower(name)]
+		id, err := create(ctx, key, string(content), info.ModTime().Unix())
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Imported = append(result.Imported, Imported{File: name, Key: key, ID: id})
+	}
+
+	return result, nil
+}
+
+// check returns why `content` can't be imported, or an empty string
+func check(content []byte) string {
+	switch {
+	case len(content) < 2:
+		return "too short"
+	case len(content) > config.Config().Documents.MaxDocumentLength:
+		return "longer than documents.max_document_length"
+	case !utf8.Valid(content):
+		return "not valid UTF-8"
+	}
+
+	return ""
+}
+
+// create stores a document under `key` if it's usable as an ID, otherwise
+// under a new ID
+func create(ctx context.Context, key, content string, createdAt int64) (string, error) {
+	doc := models.Document{
+		Content:   content,
+		Extension: "none",
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+
+	if usableID(key) {
+		var count int64
+		err := database.DBConn.WithContext(ctx).Model(&models.Document{}).Where("id = ?", key).Count(&count).Error
+
+		if err != nil {
+			return "", err
+		}
+
+		if count == 0 {
+			doc.ID = key
+
+			return key, database.DBConn.WithContext(ctx).Create(&doc).Error
+		}
+	}
+
+	return document.NewDocument(ctx, doc, nil)
+}
+
+// usableID reports whether documents can be fetched with `key` as their ID
+// and it isn't reserved
+func usableID(key string) bool {
+	return document.ValidID(key) && !document.Reserved(key)
+}
+
+// ReadKeys reads one key per line from `path`, blank lines are ignored
+func ReadKeys(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if key := strings.TrimSpace(line); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ipfilter
+
+import (
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+)
+
+// New creates a middleware rejecting clients inside `deny`, or outside
+// `allow` when it isn't empty, with a 403. Both lists hold CIDRs or bare
+// addresses.
+func New(allow, deny []string) (fiber.Handler, error) {
+	allowed, err := clientip.ParseNetworks(allow)
+
+	if err != nil {
+		return nil, err
+	}
+
+	denied, err := clientip.ParseNetworks(deny)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !Allowed(allowed, denied, clientip.IP(c)) {
+			return fiber.NewError(fiber.StatusForbidden)
+		}
+
+		return c.Next()
+	}, nil
+}
+
+// Allowed reports whether `ip` is outside `denied`, and inside `allowed`
+// when it isn't empty
+func Allowed(allowed, denied []*net.IPNet, ip net.IP) bool {
+	if clientip.Contains(denied, ip) {
+		return false
+	}
+
+	return len(allowed) == 0 || clientip.Contains(allowed, ip)
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package links
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Base returns the URL this instance is reachable at, without a trailing
+// slash. It's taken from the request unless `server.public_url` is set.
+func Base(c *fiber.Ctx) string {
+	if url := config.Config().Server.PublicURL; url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+
+	return c.BaseURL()
+}
+
+// Short returns the URL redirecting to a shortened document's URL
+func Short(base, id string) string {
+	return base + "/" + id
+}
+
+// Collection returns the URL of the collection `id`, relative to `base`
+func Collection(base, id string) string {
+	return base + "/v1/collections/" + id
+}
+
+// Document returns the URL of the document `id`, relative to `base`
+func Document(base, id string) string {
+	return base + "/v1/documents/" + id + "/raw"
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"html/template"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/accesslog"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/domain"
+)
+
+// enabled is 1 while the server is in maintenance mode. It starts out as
+// `server.maintenance.enabled` and follows it on reloads, administrators
+// can change it in between.
+var enabled int32
+
+// exempt are the paths still served in maintenance mode, so orchestrators
+// don't restart the server and monitoring keeps working
+var exempt = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+var page = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Down for maintenance</title>
+<style>body{margin:15vh auto;max-width:36em;padding:0 1em;font:16px/1.5 sans-serif;color:#24292e}</style>
+</head>
+<body>
+<h1>Down for maintenance</h1>
+<p>{{.}}</p>
+</body>
+</html>
+`))
+
+// Enabled reports whether the server is in maintenance mode
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Set turns maintenance mode on or off until the config is next reloaded
+func Set(on bool) {
+	var v int32
+
+	if on {
+		v = 1
+	}
+
+	atomic.StoreInt32(&enabled, v)
+}
+
+// Middleware answers requests with a 503 while in maintenance mode, as a
+// page for browsers and as an error response for everything else. Health
+// checks, metrics and administrators are let through.
+func Middleware() fiber.Handler {
+	Set(config.Config().Server.Maintenance.Enabled)
+
+	config.OnReload(func() error {
+		Set(config.Config().Server.Maintenance.Enabled)
+		return nil
+	})
+
+	return func(c *fiber.Ctx) error {
+		if !Enabled() || exempt[c.Path()] || auth.FromRequest(c).IsAdmin() {
+			return c.Next()
+		}
+
+		message := config.Config().Server.Maintenance.Message
+		c.Set(fiber.HeaderRetryAfter, "300")
+
+		if !strings.HasPrefix(c.Path(), "/v1/") && c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMETextHTML {
+			var b strings.Builder
+
+			if err := page.Execute(&b, message); err != nil {
+				return err
+			}
+
+			c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+
+			return c.Status(fiber.StatusServiceUnavailable).SendString(b.String())
+		}
+
+		return c.Status(fiber.StatusServiceUnavailable).JSON(&domain.Response{
+			Error:     message,
+			Payload:   domain.Payload{},
+			Status:    fiber.StatusServiceUnavailable,
+			RequestID: accesslog.RequestID(c),
+		})
+	}
+}
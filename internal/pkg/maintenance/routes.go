@@ -0,0 +1,44 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+)
+
+// Register loads the endpoints administrators toggle maintenance mode with
+func Register(app *fiber.App) {
+	app.Get("/v1/admin/maintenance", auth.RequireAdmin(), func(c *fiber.Ctx) error {
+		return c.Status(200).JSON(fiber.Map{"enabled": Enabled()})
+	})
+
+	app.Put("/v1/admin/maintenance", auth.RequireAdmin(), func(c *fiber.Ctx) error {
+		Set(true)
+		audit.FromRequest(c, audit.MaintenanceEnabled, "", "")
+
+		return c.SendStatus(204)
+	})
+
+	app.Delete("/v1/admin/maintenance", auth.RequireAdmin(), func(c *fiber.Ctx) error {
+		Set(false)
+		audit.FromRequest(c, audit.MaintenanceDisabled, "", "")
+
+		return c.SendStatus(204)
+	})
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package markdown is a small markdown renderer for user-written text like
+// comments. Only a safe subset is supported: paragraphs, line breaks, fenced
+// code blocks, unordered lists, inline code, bold, italics and http(s)
+// links. All HTML in the source is escaped before anything is rendered.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	boldPattern   = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	italicPattern = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\n]+)[*_]($|[^\w*])`)
+	linkPattern   = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^\s)]+)\)`)
+)
+
+// Render turns the markdown `src` into HTML
+func Render(src string) string {
+	var b strings.Builder
+	var paragraph, list []string
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+
+		if len(list) > 0 {
+			b.WriteString("<ul>\n<li>" + strings.Join(list, "</li>\n<li>") + "</li>\n</ul>\n")
+			list = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+
+			// Everything up to the closing fence is kept as is
+			var code []string
+
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, html.EscapeString(lines[i]))
+			}
+
+			b.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>\n")
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			if len(paragraph) > 0 {
+				flush()
+			}
+
+			list = append(list, inline(trimmed[2:]))
+		default:
+			if len(list) > 0 {
+				flush()
+			}
+
+			paragraph = append(paragraph, inline(trimmed))
+		}
+	}
+
+	flush()
+
+	return b.String()
+}
+
+// inline renders the markdown within one line. Code spans are left alone.
+func inline(line string) string {
+	parts := strings.Split(line, "`")
+
+	for i, part := range parts {
+		part = html.EscapeString(part)
+
+		// Odd parts are between backticks, an unclosed one is kept literally
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = "<code>" + part + "</code>"
+			continue
+		}
+
+		part = linkPattern.ReplaceAllString(part, `<a href="$2" rel="nofollow noopener">$1</a>`)
+		part = boldPattern.ReplaceAllString(part, "<strong>$1</strong>")
+		part = italicPattern.ReplaceAllString(part, "$1<em>$2</em>$3")
+
+		if i%2 == 1 {
+			part = "`" + part
+		}
+
+		parts[i] = part
+	}
+
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package markdown
+
+import "testing"
+
+func TestRenderEscapes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"tags", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"attributes", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>\n"},
+		{"entities", "&lt; & &amp;", "<p>&amp;lt; &amp; &amp;amp;</p>\n"},
+		{"inside bold", "**<b>hi</b>**", "<p><strong>&lt;b&gt;hi&lt;/b&gt;</strong></p>\n"},
+		{"inside a list", "- <i>one</i>", "<ul>\n<li>&lt;i&gt;one&lt;/i&gt;</li>\n</ul>\n"},
+		{"inside code", "`<b>`", "<p><code>&lt;b&gt;</code></p>\n"},
+		{"unclosed code", "`<b>", "<p>`&lt;b&gt;</p>\n"},
+		{"inside a code block", "```\n<script>\n```", "<pre><code>&lt;script&gt;</code></pre>\n"},
+		{"link text", "[<b>x</b>](https://example.com)", "<p><a href=\"https://example.com\" rel=\"nofollow noopener\">&lt;b&gt;x&lt;/b&gt;</a></p>\n"},
+		{
+			"quote in a link",
+			`[x](https://example.com/"onclick="alert(1))`,
+			"<p><a href=\"https://example.com/&#34;onclick=&#34;alert(1\" rel=\"nofollow noopener\">x</a>)</p>\n",
+		},
+		{"javascript link", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>\n"},
+		{"data link", "[x](data:text/html,<script>)", "<p>[x](data:text/html,&lt;script&gt;)</p>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>\n"},
+		{"windows line endings", "one\r\ntwo", "<p>one<br>\ntwo</p>\n"},
+		{"list after a paragraph", "text\n- a\n* b", "<p>text</p>\n<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"emphasis", "**bold** and *italic* and _too_", "<p><strong>bold</strong> and <em>italic</em> and <em>too</em></p>\n"},
+		{"snake case", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"markdown in code", "`**not bold**`", "<p><code>**not bold**</code></p>\n"},
+		{"unclosed code block", "```\ncode", "<pre><code>code</code></pre>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+)
+
+var (
+	// Requests counts every handled request by method, route and status
+	Requests = NewCounterVec(
+		"spirit_http_requests_total",
+		"Total number of HTTP requests handled.",
+		"method", "route", "status",
+	)
+
+	// RequestDuration tracks how long requests take to be handled
+	RequestDuration = NewHistogramVec(
+		"spirit_http_request_duration_seconds",
+		"Time taken to handle HTTP requests.",
+		DefaultBuckets,
+		"method", "route",
+	)
+
+	// DocumentsCreated counts successfully created documents
+	DocumentsCreated = NewCounterVec(
+		"spirit_documents_created_total",
+		"Total number of documents created.",
+	)
+
+	// DocumentsFetched counts successful document fetches by kind (json, raw, hastebin, embed, print, pdf, image or batch)
+	DocumentsFetched = NewCounterVec(
+		"spirit_documents_fetched_total",
+		"Total number of documents fetched.",
+		"kind",
+	)
+
+	// SpamDecisions counts documents acted on by the spam filters
+	SpamDecisions = NewCounterVec(
+		"spirit_spam_decisions_total",
+		"Total number of documents flagged, quarantined or rejected by spam filters.",
+		"filter", "decision",
+	)
+
+	// RatelimitRejections counts requests rejected by a rate limiter
+	RatelimitRejections = NewCounterVec(
+		"spirit_ratelimit_rejections_total",
+		"Total number of requests rejected by rate limiting.",
+		"route",
+	)
+
+	// JobRuns counts scheduled job runs by outcome (success, error or skipped)
+	JobRuns = NewCounterVec(
+		"spirit_job_runs_total",
+		"Total number of scheduled job runs.",
+		"job", "status",
+	)
+
+	// JobDuration tracks how long scheduled jobs take to run
+	JobDuration = NewHistogramVec(
+		"spirit_job_duration_seconds",
+		"Time taken to run scheduled jobs.",
+		DefaultBuckets,
+		"job",
+	)
+)
+
+func init() {
+	NewGaugeFunc(
+		"spirit_database_open_connections",
+		"Number of established connections to the database.",
+		func() float64 { return float64(dbStats().OpenConnections) },
+	)
+
+	NewGaugeFunc(
+		"spirit_database_in_use_connections",
+		"Number of database connections currently in use.",
+		func() float64 { return float64(dbStats().InUse) },
+	)
+
+	NewGaugeFunc(
+		"spirit_database_idle_connections",
+		"Number of idle database connections.",
+		func() float64 { return float64(dbStats().Idle) },
+	)
+
+	NewGaugeFunc(
+		"spirit_database_wait_count",
+		"Total number of connections waited for.",
+		func() float64 { return float64(dbStats().WaitCount) },
+	)
+}
+
+// dbStats returns the connection pool statistics, or zero values if the
+// database hasn't been initialized yet
+func dbStats() sql.DBStats {
+	if database.DBConn == nil {
+		return sql.DBStats{}
+	}
+
+	db, err := database.DBConn.DB()
+
+	if err != nil {
+		return sql.DBStats{}
+	}
+
+	return db.Stats()
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Middleware records the count and latency of every request
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// Use the route pattern rather than the path so document IDs don't
+		// create a new series each
+		route := c.Route().Path
+		status := c.Response().StatusCode()
+
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		Requests.Inc(c.Method(), route, strconv.Itoa(status))
+		RequestDuration.Observe(time.Since(start).Seconds(), c.Method(), route)
+
+		return err
+	}
+}
+
+// Register loads the metrics endpoint
+func Register(app *fiber.App) {
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		if err := auth.RequireClientCert(c, config.Config().Server.TLS.ClientAuth.Metrics); err != nil {
+			return err
+		}
+
+		token := config.Config().Metrics.Token
+
+		if token != "" {
+			header := []byte(c.Get(fiber.HeaderAuthorization))
+
+			if subtle.ConstantTimeCompare(header, []byte("Bearer "+token)) != 1 {
+				return fiber.NewError(401)
+			}
+		}
+
+		var b bytes.Buffer
+		Write(&b)
+
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+
+		return c.Status(200).Send(b.Bytes())
+	})
+}
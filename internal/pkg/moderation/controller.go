@@ -0,0 +1,220 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package moderation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/events"
+	"github.com/spacebin-org/spirit/internal/pkg/retention"
+	"gorm.io/gorm"
+)
+
+// Actions a moderator can take when resolving a report
+const (
+	ActionDismiss = "dismiss" // Keep the document or comment.
+	ActionDelete  = "delete"  // Move the document to the trash, or hide the comment.
+	ActionBan     = "ban"     // Delete as above and ban whoever wrote it.
+)
+
+// NewReport files a report against the document `id`
+func NewReport(ctx context.Context, report models.Report) (*models.Report, error) {
+	report.Status = models.ReportOpen
+	res := database.DBConn.WithContext(ctx).Create(&report)
+
+	return &report, res.Error
+}
+
+// GetReports lists reports with `status`, or every report when it's empty,
+// oldest first
+func GetReports(ctx context.Context, status string) ([]models.Report, error) {
+	reports := []models.Report{}
+	query := database.DBConn.WithContext(ctx).Order("id")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	return reports, query.Find(&reports).Error
+}
+
+// Resolve applies `action` to the document or comment a report is about on
+// behalf of `moderator`. Every open report on the same document or comment
+// is resolved with it.
+func Resolve(ctx context.Context, moderator *auth.Identity, id uint, action, note string) (*models.Report, error) {
+	report := models.Report{}
+	document := models.Document{}
+
+	err := database.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.First(&report, id).Error; err != nil {
+			return err
+		}
+
+		if report.Status != models.ReportOpen {
+			return ErrResolved
+		}
+
+		var err error
+
+		if report.CommentID != 0 {
+			err = resolveComment(tx, report.CommentID, action, note)
+		} else {
+			err = resolveDocument(tx, &document, report.DocumentID, moderator, action, note)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		resolution := action
+
+		if note != "" {
+			resolution += ": " + note
+		}
+
+		return tx.Model(&models.Report{}).
+			Where("document_id = ? AND comment_id = ? AND status = ?", report.DocumentID, report.CommentID, models.ReportOpen).
+			Updates(map[string]interface{}{
+				"status":      models.ReportResolved,
+				"resolution":  resolution,
+				"resolved_at": time.Now().Unix(),
+			}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if document.ID != "" {
+		events.Publish(ctx, events.Event{Type: events.Deleted, Document: &document, Actor: moderator.Name, Detail: "moderation"})
+	}
+
+	return &report, database.DBConn.WithContext(ctx).First(&report, id).Error
+}
+
+// ErrResolved is returned when resolving a report twice
+var ErrResolved = errors.New("report is already resolved")
+
+// resolveDocument moves document `id` into `document` and the trash when
+// `action` asks for it, banning its creator too for ActionBan. `document` is
+// left empty when nothing was trashed.
+func resolveDocument(tx *gorm.DB, document *models.Document, id string, moderator *auth.Identity, action, note string) error {
+	if action == ActionDismiss {
+		return nil
+	}
+
+	// Documents already in the trash have nothing left to delete
+	err := tx.Omit("content").Where("id = ? AND deleted_at = 0", id).First(document).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if action == ActionBan {
+		if err := ban(tx, document.CreatorIP, note); err != nil {
+			return err
+		}
+	}
+
+	return retention.Trash(tx, document, moderator.Name)
+}
+
+// resolveComment hides comment `id` when `action` asks for it, banning its
+// author too for ActionBan
+func resolveComment(tx *gorm.DB, id uint, action, note string) error {
+	if action == ActionDismiss {
+		return nil
+	}
+
+	comment := models.Comment{}
+
+	if err := tx.First(&comment, id).Error; err != nil {
+		return err
+	}
+
+	if action == ActionBan {
+		if err := ban(tx, comment.AuthorIP, note); err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&comment).Update("moderation", models.CommentHidden).Error
+}
+
+// ban stops `ip` from writing anything, if it's known
+func ban(tx *gorm.DB, ip, reason string) error {
+	if ip == "" {
+		return nil
+	}
+
+	return tx.Where(models.Ban{IP: ip}).FirstOrCreate(&models.Ban{IP: ip, Reason: reason}).Error
+}
+
+// SetCommentHidden hides comment `id` from everyone, or shows it again.
+// Hidden comments keep their place in the thread.
+func SetCommentHidden(ctx context.Context, id uint, hidden bool) error {
+	moderation := models.ModerationNone
+
+	if hidden {
+		moderation = models.CommentHidden
+	}
+
+	return database.Transaction(ctx, func(tx *gorm.DB) error {
+		comment := models.Comment{}
+
+		if err := tx.First(&comment, id).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&comment).Update("moderation", moderation).Error
+	})
+}
+
+// GetBans lists every banned address
+func GetBans(ctx context.Context) ([]models.Ban, error) {
+	bans := []models.Ban{}
+
+	return bans, database.DBConn.WithContext(ctx).Order("created_at").Find(&bans).Error
+}
+
+// Unban lifts the ban on `ip`
+func Unban(ctx context.Context, ip string) error {
+	res := database.DBConn.WithContext(ctx).Where("ip = ?", ip).Delete(&models.Ban{})
+
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return res.Error
+}
+
+// IsBanned reports whether `ip` has been banned
+func IsBanned(ctx context.Context, ip string) (bool, error) {
+	var count int64
+	err := database.DBConn.WithContext(ctx).Model(&models.Ban{}).Where("ip = ?", ip).Count(&count).Error
+
+	return count > 0, err
+}
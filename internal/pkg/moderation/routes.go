@@ -0,0 +1,207 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package moderation
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/ratelimit"
+	"gorm.io/gorm"
+)
+
+// Register loads the abuse report endpoint, the moderation queue and the
+// endpoints hiding comments
+func Register(app *fiber.App) {
+	// Reports are throttled like document creation, both are writes
+	reportLimit, err := ratelimit.New(func() string {
+		return config.Config().Server.Ratelimits.Create
+	})
+
+	if err != nil {
+		log.Fatalf("Invalid report rate limit: %v", err)
+	}
+
+	app.Post("/v1/documents/:id/report", reportLimit, func(c *fiber.Ctx) error {
+		b := new(ReportRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if err := b.Validate(); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		// Quarantined, deleted and private documents can't be seen, so they
+		// can't be reported
+		var count int64
+		err := database.DBConn.WithContext(c.UserContext()).Model(&models.Document{}).
+			Where("id = ? AND moderation <> ? AND deleted_at = 0 AND private = ?", c.Params("id"), models.ModerationQuarantined, false).
+			Count(&count).Error
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		if count == 0 {
+			return fiber.NewError(404, gorm.ErrRecordNotFound.Error())
+		}
+
+		report, err := NewReport(c.UserContext(), models.Report{
+			DocumentID: c.Params("id"),
+			Reason:     b.Reason,
+			ReporterIP: clientip.IP(c).String(),
+		})
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(201).JSON(fiber.Map{"id": report.ID, "status": report.Status})
+	})
+
+	admin := app.Group("/v1/admin", auth.RequireAdmin())
+
+	admin.Get("/reports", func(c *fiber.Ctx) error {
+		reports, err := GetReports(c.UserContext(), c.Query("status", models.ReportOpen))
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{"reports": reports})
+	})
+
+	admin.Post("/reports/:id/resolve", func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+
+		if err != nil {
+			return fiber.NewError(400, "invalid report id")
+		}
+
+		b := new(ResolveRequest)
+
+		if err := c.BodyParser(b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if err := b.Validate(); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		report, err := Resolve(c.UserContext(), auth.FromRequest(c), uint(id), b.Action, b.Note)
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return fiber.NewError(404, err.Error())
+		case errors.Is(err, ErrResolved):
+			return fiber.NewError(409, err.Error())
+		case err != nil:
+			return fiber.NewError(500, err.Error())
+		}
+
+		audit.FromRequest(c, audit.ReportResolved, "report:"+c.Params("id"), report.Resolution)
+
+		return c.Status(200).JSON(report)
+	})
+
+	setHidden := func(hidden bool, action string) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+
+			if err != nil {
+				return fiber.NewError(400, "invalid comment id")
+			}
+
+			err = SetCommentHidden(c.UserContext(), uint(id), hidden)
+
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(404, err.Error())
+			}
+
+			if err != nil {
+				return fiber.NewError(500, err.Error())
+			}
+
+			audit.FromRequest(c, action, "comment:"+c.Params("id"), "")
+
+			return c.SendStatus(204)
+		}
+	}
+
+	admin.Put("/comments/:id/hidden", setHidden(true, audit.CommentHidden))
+	admin.Delete("/comments/:id/hidden", setHidden(false, audit.CommentUnhidden))
+
+	admin.Get("/bans", func(c *fiber.Ctx) error {
+		bans, err := GetBans(c.UserContext())
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(fiber.Map{"bans": bans})
+	})
+
+	admin.Delete("/bans/:ip", func(c *fiber.Ctx) error {
+		err := Unban(c.UserContext(), c.Params("ip"))
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(404, err.Error())
+		}
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		audit.FromRequest(c, audit.BanRemoved, "ip:"+c.Params("ip"), "")
+
+		return c.SendStatus(204)
+	})
+}
+
+// RejectBanned stops banned addresses with a 403
+func RejectBanned() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := clientip.IP(c)
+
+		if ip == nil {
+			ip = net.IPv4zero
+		}
+
+		banned, err := IsBanned(c.UserContext(), ip.String())
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		if banned {
+			return fiber.NewError(fiber.StatusForbidden, "address is banned")
+		}
+
+		return c.Next()
+	}
+}
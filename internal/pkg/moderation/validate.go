@@ -0,0 +1,47 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package moderation
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// ReportRequest represents a valid body object for the report request
+type ReportRequest struct {
+	Reason string
+}
+
+// Validate performs validation on the body
+func (r ReportRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Reason, validation.Required, validation.Length(1, 1000)),
+	)
+}
+
+// ResolveRequest represents a valid body object for the resolve request
+type ResolveRequest struct {
+	Action string
+	Note   string
+}
+
+// Validate performs validation on the body
+func (r ResolveRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Action, validation.Required, validation.In(ActionDismiss, ActionDelete, ActionBan)),
+		validation.Field(&r.Note, validation.Length(0, 1000)),
+	)
+}
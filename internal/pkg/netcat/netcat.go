@@ -0,0 +1,313 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * A termbin-style listener: everything a client sends over a plain TCP
+ * connection becomes a document, and the connection is answered with its URL.
+
+ *     $ cat file | nc paste.example.com 9999
+
+ * The document ends when the client closes its side of the connection or
+ * stops sending for `server.tcp.timeout`, and has to be sent within
+ * `server.tcp.max_duration`. There's no way to authenticate or
+ * answer a challenge, so every document is anonymous.
+ */
+
+package netcat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/ipfilter"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+	"github.com/spacebin-org/spirit/internal/pkg/maintenance"
+	"github.com/spacebin-org/spirit/internal/pkg/moderation"
+	"github.com/spacebin-org/spirit/internal/pkg/spam"
+)
+
+// Server accepts documents over plain TCP connections
+type Server struct {
+	filters       spam.Pipeline
+	allowed       []*net.IPNet
+	createAllowed []*net.IPNet
+	denied        []*net.IPNet
+	limit         *limiter
+	slots         chan struct{} // one per open connection, up to `server.tcp.max_connections`
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    sync.WaitGroup
+}
+
+// New creates a server checking new documents with `filters`. Clients are
+// subject to the same IP filters, bans and create rate limit as over HTTP.
+func New(filters spam.Pipeline) (*Server, error) {
+	allowed, err := clientip.ParseNetworks(config.Config().Server.IPFilter.Allow)
+
+	if err != nil {
+		return nil, err
+	}
+
+	createAllowed, err := clientip.ParseNetworks(config.Config().Server.IPFilter.CreateAllow)
+
+	if err != nil {
+		return nil, err
+	}
+
+	denied, err := clientip.ParseNetworks(config.Config().Server.IPFilter.Deny)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := createLimit(); err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		filters:       filters,
+		allowed:       allowed,
+		createAllowed: createAllowed,
+		denied:        denied,
+		limit:         &limiter{hits: map[string]*bucket{}},
+		slots:         make(chan struct{}, config.Config().Server.TCP.MaxConnections),
+	}, nil
+}
+
+// ListenAndServe accepts connections on `addr` until the server is closed
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		s.conns.Add(1)
+
+		go func() {
+			defer s.conns.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections and waits for open ones to finish
+func (s *Server) Close() error {
+	s.mu.Lock()
+	ln := s.listener
+	s.mu.Unlock()
+
+	var err error
+
+	if ln != nil {
+		err = ln.Close()
+	}
+
+	s.conns.Wait()
+
+	return err
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		reply(conn, "Too many connections, try again later")
+
+		return
+	}
+
+	ip := conn.RemoteAddr().(*net.TCPAddr).IP
+
+	if !ipfilter.Allowed(s.allowed, s.denied, ip) || !ipfilter.Allowed(s.createAllowed, nil, ip) {
+		reply(conn, "Forbidden")
+		return
+	}
+
+	if maintenance.Enabled() {
+		reply(conn, config.Config().Server.Maintenance.Message)
+		return
+	}
+
+	if !s.limit.allow(ip.String()) {
+		reply(conn, "Too many documents, try again later")
+		return
+	}
+
+	content, err := s.read(conn)
+
+	if err != nil {
+		reply(conn, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if banned, err := moderation.IsBanned(ctx, ip.String()); err != nil || banned {
+		reply(conn, "Forbidden")
+		return
+	}
+
+	id, err := document.Create(ctx, s.filters, &document.CreateRequest{
+		Content:   string(content),
+		Extension: "none",
+	}, nil, ip)
+
+	if err != nil {
+		if e, ok := err.(*fiber.Error); !ok || e.Code >= 500 {
+			log.Printf("Couldn't create document over TCP: %v", err)
+		}
+
+		reply(conn, err.Error())
+		return
+	}
+
+	// There's no request to guess the URL from, so `server.public_url` is
+	// required
+	reply(conn, links.Document(config.Config().Server.PublicURL, id))
+}
+
+// reply answers the client with `msg`. Clients that don't read it within
+// `server.tcp.timeout` are given up on, so they can't hold a connection
+// slot open.
+func reply(conn net.Conn, msg string) {
+	conn.SetWriteDeadline(time.Now().Add(time.Duration(config.Config().Server.TCP.Timeout) * time.Millisecond))
+	fmt.Fprintln(conn, msg)
+}
+
+// read reads until the client closes its side or goes quiet. Clients
+// trickling in data can't keep it reading for longer than
+// `server.tcp.max_duration`.
+func (s *Server) read(conn net.Conn) ([]byte, error) {
+	settings := config.Config().Server.TCP
+	timeout := time.Duration(settings.Timeout) * time.Millisecond
+	maxDuration := time.Duration(settings.MaxDuration) * time.Millisecond
+	deadline := time.Now().Add(maxDuration)
+	max := document.MaxLength(nil)
+
+	buf := make([]byte, 0, 4096)
+	chunk := make([]byte, 4096)
+
+	for {
+		if idle := time.Now().Add(timeout); idle.Before(deadline) {
+			conn.SetReadDeadline(idle)
+		} else {
+			conn.SetReadDeadline(deadline)
+		}
+
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+
+		if len(buf) > max {
+			return nil, fmt.Errorf("document is longer than %d bytes", max)
+		}
+
+		var netErr net.Error
+
+		switch {
+		case err == nil:
+			continue
+		case errors.As(err, &netErr) && netErr.Timeout() && !time.Now().Before(deadline):
+			return nil, fmt.Errorf("document took longer than %s to send", maxDuration)
+		case errors.Is(err, io.EOF), errors.As(err, &netErr) && netErr.Timeout():
+			return buf, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// bucket counts the documents a client created since `start`
+type bucket struct {
+	start time.Time
+	count int
+}
+
+// limiter is a fixed window rate limiter keyed by client address. Its
+// limit is read from the config on every call, so reloads apply to it.
+type limiter struct {
+	mu   sync.Mutex
+	hits map[string]*bucket
+}
+
+// createLimit returns how many documents a client may create per window,
+// `server.ratelimits.create` or else the general rate limit
+func createLimit() (int, time.Duration, error) {
+	limits := config.Config().Server.Ratelimits
+
+	if limits.Create != "" {
+		return config.ParseRateLimit(limits.Create)
+	}
+
+	return limits.Requests, time.Duration(limits.Duration) * time.Millisecond, nil
+}
+
+func (l *limiter) allow(key string) bool {
+	// The limit was validated when the config was loaded
+	max, window, _ := createLimit()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	for k, b := range l.hits {
+		if now.Sub(b.start) >= window {
+			delete(l.hits, k)
+		}
+	}
+
+	b, ok := l.hits[key]
+
+	if !ok {
+		b = &bucket{start: now}
+		l.hits[key] = b
+	}
+
+	b.count++
+
+	return b.count <= max
+}
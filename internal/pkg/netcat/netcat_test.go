@@ -0,0 +1,128 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package netcat
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+)
+
+const readConfig = `
+[server.tcp]
+timeout = 100
+max_duration = 300
+
+[documents]
+max_document_length = 16
+`
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string // Sent 40ms apart.
+		close  bool     // Whether the client closes its side afterwards.
+		want   string
+		err    string // Part of the error, empty if the document is read.
+	}{
+		{"closed", []string{"hello ", "world"}, true, "hello world", ""},
+		{"quiet", []string{"hello ", "world"}, false, "hello world", ""},
+		{"empty", nil, true, "", ""},
+		{"too long", []string{"0123456789", "0123456789"}, false, "", "longer than 16 bytes"},
+		{"trickling", strings.Split("0123456789", ""), false, "", "took longer than 300ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configtest.Load(t, readConfig)
+
+			server, client := net.Pipe()
+			defer server.Close()
+
+			go func() {
+				for _, chunk := range tt.chunks {
+					if _, err := client.Write([]byte(chunk)); err != nil {
+						return
+					}
+
+					time.Sleep(40 * time.Millisecond)
+				}
+
+				if tt.close {
+					client.Close()
+				}
+			}()
+
+			got, err := (&Server{}).read(server)
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("read() failed: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("read() = %v, want an error containing %q", err, tt.err)
+			case string(got) != tt.want:
+				t.Errorf("read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyDeadline(t *testing.T) {
+	configtest.Load(t, readConfig)
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+
+	// The client never reads the reply
+	go func() {
+		reply(server, "Forbidden")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reply is still waiting for the client")
+	}
+}
+
+func TestLimiterReload(t *testing.T) {
+	configtest.Load(t, "[server.ratelimits]\ncreate = \"2/min\"\n")
+
+	l := &limiter{hits: map[string]*bucket{}}
+
+	for i, want := range []bool{true, true, false} {
+		if got := l.allow("192.0.2.1"); got != want {
+			t.Errorf("document %d allowed: %v, want %v", i+1, got, want)
+		}
+	}
+
+	if !l.allow("192.0.2.2") {
+		t.Error("other client limited")
+	}
+
+	configtest.Reload(t, "[server.ratelimits]\ncreate = \"5/min\"\n")
+
+	if !l.allow("192.0.2.1") {
+		t.Error("reloaded limit not applied")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oembed
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/document"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// documentPath matches the paths of documents on this instance
+var documentPath = regexp.MustCompile(`^/v1/documents/([A-Za-z0-9_-]+)(?:/raw)?/?$`)
+
+// The heights of a line and of the footer in embeds, in pixels
+const (
+	lineHeight   = 18
+	footerHeight = 30
+)
+
+// Response is an oEmbed response of the "rich" type
+type Response struct {
+	Type         string `json:"type"`
+	Version      string `json:"version"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// Register loads the oEmbed endpoint
+func Register(app *fiber.App) {
+	app.Get("/v1/oembed", func(c *fiber.Ctx) error {
+		if format := c.Query("format", "json"); format != "json" {
+			return fiber.NewError(fiber.StatusNotImplemented, "only the json format is supported")
+		}
+
+		base := links.Base(c)
+		id, err := documentID(base, c.Query("url"))
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		doc, err := document.GetDocument(c.UserContext(), auth.FromRequest(c), id)
+
+		if err != nil {
+			return fiber.NewError(404, err.Error())
+		}
+
+		width, err := dimension(c.Query("maxwidth"), 600)
+
+		if err != nil {
+			return fiber.NewError(400, "maxwidth must be a positive number")
+		}
+
+		maxHeight, err := dimension(c.Query("maxheight"), 400)
+
+		if err != nil {
+			return fiber.NewError(400, "maxheight must be a positive number")
+		}
+
+		// The embed is sized to fit its content, down to its minimum height
+		height := (strings.Count(doc.Content, "\n") + 1) * lineHeight
+
+		if height > maxHeight-footerHeight {
+			height = maxHeight - footerHeight
+		}
+
+		if height < 50 {
+			height = 50
+		}
+
+		return c.Status(200).JSON(&Response{
+			Type:         "rich",
+			Version:      "1.0",
+			Title:        doc.ID + "." + document.FileExtension(doc.Extension),
+			ProviderName: "Spacebin",
+			ProviderURL:  base,
+			HTML: fmt.Sprintf(
+				`<iframe src="%s" width="%d" height="%d" frameborder="0"></iframe>`,
+				html.EscapeString(fmt.Sprintf("%s/embed/%s?height=%d", base, doc.ID, height)), width, height+footerHeight,
+			),
+			Width:  width,
+			Height: height + footerHeight,
+		})
+	})
+}
+
+// documentID returns the ID of the document `raw` links to, if it's a
+// document on this instance
+func documentID(base, raw string) (string, error) {
+	u, err := url.Parse(raw)
+
+	if err != nil {
+		return "", errors.New("invalid url")
+	}
+
+	b, err := url.Parse(base)
+
+	if err != nil || !strings.EqualFold(u.Host, b.Host) {
+		return "", errors.New("url isn't on this instance")
+	}
+
+	match := documentPath.FindStringSubmatch(u.Path)
+
+	if match == nil {
+		return "", errors.New("url isn't a document")
+	}
+
+	return match[1], nil
+}
+
+// dimension parses an optional maxwidth or maxheight, falling back to and
+// never exceeding `fallback`
+func dimension(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid dimension %q", value)
+	}
+
+	if n > fallback {
+		return fallback, nil
+	}
+
+	return n, nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package pdf is a minimal PDF writer for plain text. Pages are A4 and set
+// in Courier, one of the fonts every PDF reader has built in, so nothing has
+// to be embedded. Text is encoded as WinAnsi, characters outside of it are
+// replaced with question marks.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Page layout, in points
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 42
+	fontSize   = 9
+	leading    = 11
+
+	// Courier glyphs are 0.6 em wide
+	columns = (pageWidth - 2*margin) * 10 / (fontSize * 6)
+
+	// Room below the header and above the footer
+	linesPerPage = (pageHeight - 2*margin - 3*leading - 2*leading) / leading
+)
+
+// Document is text to be rendered, with a title and a line of details
+// above it on every page
+type Document struct {
+	Title    string
+	Subtitle string
+	Lines    []string
+	Numbered bool // prefix every line with its number
+}
+
+// Render returns `d` as a PDF file
+func Render(d Document) []byte {
+	pages := paginate(d)
+
+	w := &writer{}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 5 are fixed, every page then takes two: itself and its
+	// content stream
+	kids := make([]string, len(pages))
+
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+
+	w.object("<< /Type /Catalog /Pages 2 0 R >>")
+	w.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	w.object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	w.object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	w.object(fmt.Sprintf("<< /Title %s /Producer (Spacebin) >>", literal(d.Title)))
+
+	for i, lines := range pages {
+		var s strings.Builder
+		top := pageHeight - margin
+
+		fmt.Fprintf(&s, "BT /F2 11 Tf %d %d Td %s Tj ET\n", margin, top-leading, literal(d.Title))
+		fmt.Fprintf(&s, "BT /F1 8 Tf %d %d Td %s Tj ET\n", margin, top-2*leading, literal(d.Subtitle))
+		fmt.Fprintf(&s, "0.5 w %d %d m %d %d l S\n", margin, top-2*leading-4, pageWidth-margin, top-2*leading-4)
+		fmt.Fprintf(&s, "BT /F1 %d Tf %d TL %d %d Td\n", fontSize, leading, margin, top-4*leading)
+
+		for _, line := range lines {
+			fmt.Fprintf(&s, "%s Tj T*\n", literal(line))
+		}
+
+		s.WriteString("ET\n")
+		fmt.Fprintf(&s, "BT /F1 8 Tf %d %d Td %s Tj ET\n", pageWidth-margin-60, margin-leading, literal(fmt.Sprintf("%d / %d", i+1, len(pages))))
+
+		w.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 7+2*i))
+		w.object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", s.Len(), s.String()))
+	}
+
+	return w.finish()
+}
+
+// paginate wraps the lines of `d` to fit the page and splits them into
+// pages, there's always at least one
+func paginate(d Document) [][]string {
+	width := columns
+	gutter := 0
+
+	if d.Numbered {
+		gutter = len(fmt.Sprint(len(d.Lines))) + 2
+		width -= gutter
+	}
+
+	wrapped := []string{}
+
+	for i, line := range d.Lines {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		prefix := ""
+
+		if d.Numbered {
+			prefix = fmt.Sprintf("%*d  ", gutter-2, i+1)
+		}
+
+		for {
+			cut := len(line)
+
+			if utf8.RuneCountInString(line) > width {
+				cut = 0
+
+				for n := 0; n < width; n++ {
+					_, size := utf8.DecodeRuneInString(line[cut:])
+					cut += size
+				}
+			}
+
+			wrapped = append(wrapped, prefix+line[:cut])
+			line = line[cut:]
+			prefix = strings.Repeat(" ", gutter)
+
+			if line == "" {
+				break
+			}
+		}
+	}
+
+	pages := [][]string{}
+
+	for len(wrapped) > linesPerPage {
+		pages = append(pages, wrapped[:linesPerPage])
+		wrapped = wrapped[linesPerPage:]
+	}
+
+	return append(pages, wrapped)
+}
+
+// literal encodes `s` as a PDF string in WinAnsi
+func literal(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			// WinAnsi matches Latin-1 in this range
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+
+	b.WriteByte(')')
+
+	return b.String()
+}
+
+// writer numbers objects and remembers where they start for the
+// cross-reference table
+type writer struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// object appends the next object, holding `body`
+func (w *writer) object(body string) {
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", len(w.offsets), body)
+}
+
+// finish appends the cross-reference table and trailer, returning the file
+func (w *writer) finish() []byte {
+	xref := w.buf.Len()
+
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+
+	for _, offset := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, xref)
+
+	return w.buf.Bytes()
+}
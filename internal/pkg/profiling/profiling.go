@@ -0,0 +1,30 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiling
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+)
+
+// Register loads net/http/pprof's profiles on /debug/pprof and expvar's
+// variables on /debug/vars, for admin tokens only
+func Register(app *fiber.App) {
+	app.Group("/debug", auth.RequireAdmin(), pprof.New(), expvar.New())
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// refreshInterval is how long overrides are cached for, so changes made
+// on other instances are picked up
+const refreshInterval = 30 * time.Second
+
+var (
+	mu        sync.Mutex
+	overrides map[string]string // nil until they were first loaded
+	loadedAt  time.Time         // of the last attempt, successful or not
+)
+
+// TokenRule returns the rule the token named `name` is limited by, or
+// false if it isn't one of the `auth.tokens`. An administrator's override
+// comes first, then the token's `rate_limit`, then the `authenticated`
+// rule. An empty rule means the limit of the endpoint applies.
+func TokenRule(name string) (string, bool) {
+	for _, t := range config.Config().Auth.Tokens {
+		if t.Name != name {
+			continue
+		}
+
+		if rule, ok := cached()[name]; ok {
+			return rule, true
+		}
+
+		if t.RateLimit != "" {
+			return t.RateLimit, true
+		}
+
+		return config.Config().Server.Ratelimits.Authenticated, true
+	}
+
+	return "", false
+}
+
+// cached returns the overrides stored in the database, loading them again
+// once they're older than refreshInterval. Like feature flags, only one
+// caller loads them and the previous ones are kept if that fails.
+func cached() map[string]string {
+	mu.Lock()
+	current := overrides
+	stale := time.Since(loadedAt) >= refreshInterval
+
+	if stale {
+		loadedAt = time.Now()
+	}
+
+	mu.Unlock()
+
+	if !stale {
+		return current
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows := []models.RateLimit{}
+
+	if err := database.DBConn.WithContext(ctx).Find(&rows).Error; err != nil {
+		log.Printf("Couldn't load rate limit overrides: %v", err)
+		return current
+	}
+
+	loaded := make(map[string]string, len(rows))
+
+	for _, row := range rows {
+		loaded[row.Name] = row.Rule
+	}
+
+	mu.Lock()
+	overrides = loaded
+	mu.Unlock()
+
+	return loaded
+}
+
+// Override limits the token named `name` by `rule` regardless of the config
+func Override(ctx context.Context, name, rule, by string) error {
+	err := database.DBConn.WithContext(ctx).Save(&models.RateLimit{
+		Name:      name,
+		Rule:      rule,
+		UpdatedBy: by,
+		UpdatedAt: time.Now().Unix(),
+	}).Error
+
+	invalidate()
+
+	return err
+}
+
+// Reset removes the override of the token named `name`, so it follows the
+// config
+func Reset(ctx context.Context, name string) error {
+	err := database.DBConn.WithContext(ctx).Delete(&models.RateLimit{Name: name}).Error
+
+	invalidate()
+
+	return err
+}
+
+// invalidate makes the next caller load the overrides again
+func invalidate() {
+	mu.Lock()
+	loadedAt = time.Time{}
+	mu.Unlock()
+}
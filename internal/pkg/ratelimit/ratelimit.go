@@ -0,0 +1,175 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/clientip"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/metrics"
+)
+
+// New creates a limiter middleware for the rule returned by `rule`. An empty
+// rule falls back to the global `requests` and `duration` values in the
+// config.
+//
+// Authenticated requests are limited per identity instead of per IP, by
+// the rule TokenRule picks. Identities that aren't one of the
+// `auth.tokens`, e.g. ones from auth hooks, are limited like anonymous
+// requests.
+//
+// The limiter is rebuilt whenever the config is reloaded, which also resets
+// the request counts.
+func New(rule func() string) (fiber.Handler, error) {
+	var current atomic.Value
+
+	rebuild := func() error {
+		handler, err := build(rule())
+
+		if err != nil {
+			return err
+		}
+
+		current.Store(handler)
+
+		return nil
+	}
+
+	if err := rebuild(); err != nil {
+		return nil, err
+	}
+
+	config.OnReload(rebuild)
+
+	return func(c *fiber.Ctx) error {
+		return current.Load().(fiber.Handler)(c)
+	}, nil
+}
+
+func build(rule string) (fiber.Handler, error) {
+	limits := config.Config().Server.Ratelimits
+
+	max := limits.Requests
+	window := time.Duration(limits.Duration) * time.Millisecond
+
+	if rule != "" {
+		var err error
+
+		if max, window, err = config.ParseRateLimit(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	// Anonymous requests are limited per client, not per reverse proxy
+	anonymous := limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return clientip.IP(c).String()
+		},
+		LimitReached: limitReached(max),
+	})
+
+	var mu sync.Mutex
+	identities := map[string]identityLimiter{}
+
+	// Limiters of identities are made when they're first needed, and made
+	// again when an administrator changes their rule
+	forIdentity := func(name, rule string) (fiber.Handler, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if l, ok := identities[name]; ok && l.rule == rule {
+			return l.handler, nil
+		}
+
+		tokenMax, tokenWindow := max, window
+
+		if rule != "" {
+			var err error
+
+			if tokenMax, tokenWindow, err = config.ParseRateLimit(rule); err != nil {
+				return nil, err
+			}
+		}
+
+		// Every identity has its own limiter, so the key can be constant
+		handler := limiter.New(limiter.Config{
+			Max:        tokenMax,
+			Expiration: tokenWindow,
+			KeyGenerator: func(c *fiber.Ctx) string {
+				return "identity"
+			},
+			LimitReached: limitReached(tokenMax),
+		})
+
+		identities[name] = identityLimiter{rule: rule, handler: handler}
+
+		return handler, nil
+	}
+
+	return func(c *fiber.Ctx) error {
+		identity := auth.FromRequest(c)
+
+		if identity == nil {
+			return anonymous(c)
+		}
+
+		rule, ok := TokenRule(identity.Name)
+
+		if !ok {
+			return anonymous(c)
+		}
+
+		handler, err := forIdentity(identity.Name, rule)
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return handler(c)
+	}, nil
+}
+
+// identityLimiter is the limiter of one identity and the rule it was made
+// for
+type identityLimiter struct {
+	rule    string
+	handler fiber.Handler
+}
+
+// limitReached records the rejection and responds with a 429. The limiter
+// only sets Retry-After on rejections, the X-RateLimit-* headers it sends
+// with allowed requests are added so clients see them on both.
+func limitReached(max int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		metrics.RatelimitRejections.Inc(c.Route().Path)
+
+		c.Set("X-RateLimit-Limit", strconv.Itoa(max))
+		c.Set("X-RateLimit-Remaining", "0")
+		c.Set("X-RateLimit-Reset", c.GetRespHeader(fiber.HeaderRetryAfter))
+
+		return fiber.NewError(fiber.StatusTooManyRequests)
+	}
+}
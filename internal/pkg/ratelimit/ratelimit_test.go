@@ -0,0 +1,241 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config/configtest"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+)
+
+// Requests made with app.Test come from 0.0.0.0, which is trusted so tests
+// can pick the client's address
+const limitsConfig = `
+[server.proxy]
+trusted = ["0.0.0.0/32"]
+header = "X-Forwarded-For"
+
+[server.ratelimits]
+authenticated = "3/min"
+
+[[auth.tokens]]
+name = "alice"
+token = "alice-token"
+role = "user"
+
+[[auth.tokens]]
+name = "bob"
+token = "bob-token"
+role = "user"
+rate_limit = "1/min"
+`
+
+// openDatabase loads limitsConfig and migrates a new database for the
+// overrides
+func openDatabase(t *testing.T) {
+	t.Helper()
+
+	configtest.Load(t, limitsConfig)
+	database.Init()
+
+	t.Cleanup(func() {
+		database.Close()
+		invalidate()
+	})
+
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	invalidate()
+}
+
+// request is made from `ip` with `token`, if it isn't empty
+type request struct {
+	ip     string
+	token  string
+	status int
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests []request
+	}{
+		{"anonymous per address", []request{
+			{"192.0.2.1", "", 200},
+			{"192.0.2.1", "", 200},
+			{"192.0.2.1", "", 429},
+			{"192.0.2.2", "", 200},
+		}},
+		{"tokens across addresses", []request{
+			{"192.0.2.1", "alice-token", 200},
+			{"192.0.2.2", "alice-token", 200},
+			{"192.0.2.3", "alice-token", 200},
+			{"192.0.2.4", "alice-token", 429},
+		}},
+		{"tokens apart from anonymous requests", []request{
+			{"192.0.2.1", "", 200},
+			{"192.0.2.1", "", 200},
+			{"192.0.2.1", "alice-token", 200},
+			{"192.0.2.1", "", 429},
+		}},
+		{"each token on its own", []request{
+			{"192.0.2.1", "bob-token", 200},
+			{"192.0.2.1", "bob-token", 429},
+			{"192.0.2.1", "alice-token", 200},
+		}},
+		{"unknown tokens are anonymous", []request{
+			{"192.0.2.1", "mallory-token", 200},
+			{"192.0.2.1", "mallory-token", 200},
+			{"192.0.2.1", "", 429},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openDatabase(t)
+			app := limitedApp(t, "2/min")
+
+			for i, r := range tt.requests {
+				if status := send(t, app, r); status != r.status {
+					t.Errorf("request %d from %s: status %d, want %d", i+1, r.ip, status, r.status)
+				}
+			}
+		})
+	}
+}
+
+func TestOverride(t *testing.T) {
+	openDatabase(t)
+	app := limitedApp(t, "")
+
+	alice := request{"192.0.2.1", "alice-token", 200}
+
+	send(t, app, alice)
+
+	if err := Override(context.Background(), "alice", "1/min", "root"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new rule comes with a new limiter, so its count starts over
+	if status := send(t, app, alice); status != 200 {
+		t.Errorf("first request after the override: status %d, want 200", status)
+	}
+
+	if status := send(t, app, alice); status != 429 {
+		t.Errorf("second request after the override: status %d, want 429", status)
+	}
+
+	if err := Reset(context.Background(), "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := send(t, app, alice); status != 200 {
+		t.Errorf("request after the reset: status %d, want 200", status)
+	}
+}
+
+func TestTokenRule(t *testing.T) {
+	openDatabase(t)
+
+	if err := Override(context.Background(), "bob", "10/s", "root"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		known bool
+	}{
+		{"alice", "3/min", true},
+		{"bob", "10/s", true},
+		{"mallory", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, known := TokenRule(tt.name)
+
+			if rule != tt.rule || known != tt.known {
+				t.Errorf("TokenRule() = %q, %v, want %q, %v", rule, known, tt.rule, tt.known)
+			}
+		})
+	}
+}
+
+func TestReloadedTokens(t *testing.T) {
+	openDatabase(t)
+	app := limitedApp(t, "")
+
+	bob := request{"192.0.2.1", "bob-token", 200}
+	send(t, app, bob)
+
+	configtest.Reload(t, strings.Replace(limitsConfig, `rate_limit = "1/min"`, `rate_limit = "5/min"`, 1))
+
+	if rule, _ := TokenRule("bob"); rule != "5/min" {
+		t.Fatalf("bob is limited by %q after the reload, want 5/min", rule)
+	}
+
+	for i := 0; i < 2; i++ {
+		if status := send(t, app, bob); status != 200 {
+			t.Errorf("request %d after the reload: status %d, want 200", i+1, status)
+		}
+	}
+}
+
+// limitedApp serves 200s behind a limiter for `rule`
+func limitedApp(t *testing.T, rule string) *fiber.App {
+	t.Helper()
+
+	handler, err := New(func() string { return rule })
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/", handler, func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+
+	return app
+}
+
+func send(t *testing.T, app *fiber.App, r request) int {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", r.ip)
+
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	res, err := app.Test(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/audit"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// State is the rate limit of a token as administrators see it
+type State struct {
+	Name     string            `json:"name"`
+	Rule     string            `json:"rule"`               // in effect, empty if the endpoints' limits apply
+	Default  string            `json:"default"`            // from the config
+	Override *models.RateLimit `json:"override,omitempty"` // set by an administrator
+}
+
+// Register loads the endpoints administrators override the rate limits of
+// tokens with
+func Register(app *fiber.App) {
+	admin := app.Group("/v1/admin/ratelimits", auth.RequireAdmin())
+
+	admin.Get("/", func(c *fiber.Ctx) error {
+		rows := []models.RateLimit{}
+
+		if err := database.DBConn.WithContext(c.UserContext()).Find(&rows).Error; err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		tokens := config.Config().Auth.Tokens
+		states := make([]State, len(tokens))
+
+		for i, t := range tokens {
+			states[i] = State{Name: t.Name, Default: t.RateLimit}
+			states[i].Rule, _ = TokenRule(t.Name)
+
+			if t.RateLimit == "" {
+				states[i].Default = config.Config().Server.Ratelimits.Authenticated
+			}
+
+			for j := range rows {
+				if rows[j].Name == t.Name {
+					states[i].Override = &rows[j]
+				}
+			}
+		}
+
+		return c.Status(200).JSON(fiber.Map{"ratelimits": states})
+	})
+
+	admin.Put("/:name", func(c *fiber.Ctx) error {
+		if _, ok := TokenRule(c.Params("name")); !ok {
+			return fiber.NewError(404, "unknown token")
+		}
+
+		b := struct {
+			RateLimit string `json:"rate_limit"`
+		}{}
+
+		if err := c.BodyParser(&b); err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+
+		if _, _, err := config.ParseRateLimit(b.RateLimit); err != nil || b.RateLimit == "" {
+			return fiber.NewError(400, `rate_limit must be a rule like "5000/min"`)
+		}
+
+		if err := Override(c.UserContext(), c.Params("name"), b.RateLimit, auth.FromRequest(c).Name); err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		audit.FromRequest(c, audit.RateLimitOverridden, c.Params("name"), b.RateLimit)
+
+		return c.SendStatus(204)
+	})
+
+	admin.Delete("/:name", func(c *fiber.Ctx) error {
+		if _, ok := TokenRule(c.Params("name")); !ok {
+			return fiber.NewError(404, "unknown token")
+		}
+
+		if err := Reset(c.UserContext(), c.Params("name")); err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		audit.FromRequest(c, audit.RateLimitReset, c.Params("name"), "")
+
+		return c.SendStatus(204)
+	})
+}
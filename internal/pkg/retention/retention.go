@@ -0,0 +1,112 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * Documents are kept for `documents.max_age` seconds unless a retention rule
+ * says otherwise. Rules are checked in order and the first one matching a
+ * document decides how long it's kept, so more specific rules should come
+ * first. A max age of 0 keeps matching documents forever.
+
+ * A document can also carry its own expiry, set when it's created, which
+ * takes precedence over every rule.
+ */
+
+package retention
+
+import (
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+)
+
+// Creators a rule can be limited to
+const (
+	CreatorAny           = ""
+	CreatorAnonymous     = "anonymous"
+	CreatorAuthenticated = "authenticated"
+)
+
+// MaxAge returns how many seconds `doc` is kept for according to the rules,
+// 0 means forever
+func MaxAge(doc *models.Document) int64 {
+	for _, rule := range config.Config().Retention.Rules {
+		if matches(rule.Creator, rule.MinSize, doc) {
+			return rule.MaxAge
+		}
+	}
+
+	return config.Config().Documents.MaxAge
+}
+
+func matches(creator string, minSize int, doc *models.Document) bool {
+	switch creator {
+	case CreatorAnonymous:
+		if doc.Owner != "" {
+			return false
+		}
+	case CreatorAuthenticated:
+		if doc.Owner == "" {
+			return false
+		}
+	}
+
+	return size(doc) >= int64(minSize)
+}
+
+// size returns the length of the content of `doc` in bytes, which may have
+// been loaded without its content
+func size(doc *models.Document) int64 {
+	if doc.Content == "" {
+		return doc.ContentSize
+	}
+
+	return int64(len(doc.Content))
+}
+
+// NeedsSize reports whether any rule depends on the size of documents
+func NeedsSize() bool {
+	for _, rule := range config.Config().Retention.Rules {
+		if rule.MinSize > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExpiresAt returns the unix timestamp `doc` expires at, or 0 if it's kept
+// forever
+func ExpiresAt(doc *models.Document) int64 {
+	if doc.ExpiresAt != 0 {
+		return doc.ExpiresAt
+	}
+
+	maxAge := MaxAge(doc)
+
+	if maxAge == 0 {
+		return 0
+	}
+
+	return doc.CreatedAt + maxAge
+}
+
+// Expired reports whether `doc` should be deleted at `now`
+func Expired(doc *models.Document, now time.Time) bool {
+	expiresAt := ExpiresAt(doc)
+
+	return expiresAt != 0 && now.Unix() >= expiresAt
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retention
+
+import (
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"gorm.io/gorm"
+)
+
+// Dependents are the tables holding rows that belong to a document, in a
+// `document_id` column
+var Dependents = []interface{}{
+	&models.DocumentTag{}, &models.DocumentView{}, &models.Star{}, &models.Comment{},
+	&models.Annotation{}, &models.CollectionDocument{}, &models.ShareLink{}, &models.IdempotencyKey{},
+}
+
+// purgeBatch keeps the IDs deleted at once below every database's limit on
+// query parameters
+const purgeBatch = 500
+
+// Trash deletes `doc` on behalf of `by`, and sets when and by whom on it.
+// It's kept for `documents.trash_period` seconds so it can still be
+// restored, or deleted right away if that's 0.
+func Trash(tx *gorm.DB, doc *models.Document, by string) error {
+	doc.DeletedAt, doc.DeletedBy = time.Now().Unix(), by
+
+	if config.Config().Documents.TrashPeriod == 0 {
+		_, err := Purge(tx, []string{doc.ID})
+		return err
+	}
+
+	// Restoring the document doesn't bring its share links back
+	if err := tx.Where("document_id = ?", doc.ID).Delete(&models.ShareLink{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Document{}).Where("id = ? AND deleted_at = 0", doc.ID).Updates(map[string]interface{}{
+		"deleted_at": doc.DeletedAt,
+		"deleted_by": by,
+	}).Error
+}
+
+// Purge deletes the documents `ids` for good, along with every row in
+// Dependents belonging to them, so nothing is left over for a later
+// document given the same ID. `tx` should be a transaction.
+func Purge(tx *gorm.DB, ids []string) (int64, error) {
+	var deleted int64
+
+	for len(ids) > 0 {
+		batch := ids
+
+		if len(batch) > purgeBatch {
+			batch = batch[:purgeBatch]
+		}
+
+		ids = ids[len(batch):]
+
+		for _, table := range Dependents {
+			if err := tx.Where("document_id IN ?", batch).Delete(table).Error; err != nil {
+				return deleted, err
+			}
+		}
+
+		res := tx.Where("id IN ?", batch).Delete(&models.Document{})
+
+		if res.Error != nil {
+			return deleted, res.Error
+		}
+
+		deleted += res.RowsAffected
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package robots
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/features"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// Register loads the robots.txt endpoint
+func Register(app *fiber.App) {
+	app.Get("/robots.txt", func(c *fiber.Ctx) error {
+		robots := config.Config().Server.Robots
+
+		if robots != "" && !strings.HasSuffix(robots, "\n") {
+			robots += "\n"
+		}
+
+		// Public documents are only discoverable with listing enabled
+		if features.Enabled(features.PublicListing) {
+			robots += "Sitemap: " + links.Base(c) + "/sitemap.xml\n"
+		}
+
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+
+		return c.Status(200).SendString(robots)
+	})
+}
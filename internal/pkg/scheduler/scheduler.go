@@ -0,0 +1,173 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * Recurring tasks, such as the expiry sweep, are run by the scheduler.
+ * Every replica of Spirit runs its own scheduler, so before a job runs a
+ * lock is taken in the database and replicas that lose the race skip that
+ * run. Locks expire after `jobs.lock_ttl`, which is also how long a job may
+ * run for, so a replica that dies mid-job doesn't block the others forever.
+ */
+
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/metrics"
+)
+
+// Func is the work done by a job
+type Func func(ctx context.Context) error
+
+// Scheduler runs jobs on a cron schedule
+type Scheduler struct {
+	cron   *cron.Cron
+	holder string // Identifies this replica in job locks.
+	ttl    time.Duration
+}
+
+// New creates a scheduler, jobs have to be added before it's started
+func New() *Scheduler {
+	hostname, _ := os.Hostname()
+
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return &Scheduler{
+		// Runs of a job never overlap within a replica
+		cron:   cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+		holder: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(b)),
+		ttl:    time.Duration(config.Config().Jobs.LockTTL) * time.Millisecond,
+	}
+}
+
+// Add schedules `fn` to run on `spec`, an empty spec disables the job
+func (s *Scheduler) Add(name, spec string, fn Func) error {
+	if spec == "" {
+		return nil
+	}
+
+	_, err := s.cron.AddFunc(spec, func() {
+		s.run(name, fn)
+	})
+
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Start runs jobs in the background
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop stops scheduling jobs, the returned context is done once running
+// jobs have finished
+func (s *Scheduler) Stop() context.Context {
+	return s.cron.Stop()
+}
+
+func (s *Scheduler) run(name string, fn Func) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.ttl)
+	defer cancel()
+
+	acquired, err := s.lock(ctx, name)
+
+	if err != nil {
+		log.Printf("Couldn't lock job %s: %v", name, err)
+		metrics.JobRuns.Inc(name, "error")
+
+		return
+	}
+
+	if !acquired {
+		metrics.JobRuns.Inc(name, "skipped")
+
+		return
+	}
+
+	defer s.unlock(name)
+
+	start := time.Now()
+	err = fn(ctx)
+
+	metrics.JobDuration.Observe(time.Since(start).Seconds(), name)
+
+	if err != nil {
+		log.Printf("Job %s failed: %v", name, err)
+		metrics.JobRuns.Inc(name, "error")
+
+		return
+	}
+
+	metrics.JobRuns.Inc(name, "success")
+}
+
+// lock takes the lock for `name`, unless another replica holds it
+func (s *Scheduler) lock(ctx context.Context, name string) (bool, error) {
+	now := time.Now()
+	db := database.DBConn.WithContext(ctx)
+
+	// Take over an expired lock, or one we're already holding
+	res := db.Model(&models.JobLock{}).
+		Where("name = ? AND (expires_at < ? OR holder = ?)", name, now.UnixNano()/int64(time.Millisecond), s.holder).
+		Updates(map[string]interface{}{
+			"holder":     s.holder,
+			"expires_at": now.Add(s.ttl).UnixNano() / int64(time.Millisecond),
+		})
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// The job has never run before, if the insert fails another replica
+	// got there first
+	err := db.Create(&models.JobLock{
+		Name:      name,
+		Holder:    s.holder,
+		ExpiresAt: now.Add(s.ttl).UnixNano() / int64(time.Millisecond),
+	}).Error
+
+	return err == nil, nil
+}
+
+// unlock releases the lock for `name` so the next run can happen anywhere
+func (s *Scheduler) unlock(name string) {
+	err := database.DBConn.Model(&models.JobLock{}).
+		Where("name = ? AND holder = ?", name, s.holder).
+		Update("expires_at", 0).Error
+
+	if err != nil {
+		log.Printf("Couldn't unlock job %s: %v", name, err)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spam
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// URLDensity acts on documents that are mostly links, which is typical for
+// SEO spam
+type URLDensity struct {
+	MaxPerKB float64 // Allowed number of URLs per 1024 bytes of content.
+	Action   Decision
+}
+
+// Name returns the name of the filter
+func (f *URLDensity) Name() string {
+	return "url_density"
+}
+
+// Check counts the URLs in the content
+func (f *URLDensity) Check(s *Submission) (Decision, string) {
+	urls := len(urlPattern.FindAllStringIndex(s.Content, -1))
+
+	// Very short documents with a single link are fine
+	kb := float64(len(s.Content)) / 1024
+
+	if kb < 1 {
+		kb = 1
+	}
+
+	if density := float64(urls) / kb; density > f.MaxPerKB {
+		return f.Action, fmt.Sprintf("%.1f URLs per KB exceeds %.1f", density, f.MaxPerKB)
+	}
+
+	return Allow, ""
+}
+
+// Patterns acts on documents matching any of a list of regular expressions
+type Patterns struct {
+	Rules  []*regexp.Regexp
+	Action Decision
+}
+
+// Name returns the name of the filter
+func (f *Patterns) Name() string {
+	return "patterns"
+}
+
+// Check matches the content against every rule
+func (f *Patterns) Check(s *Submission) (Decision, string) {
+	for _, rule := range f.Rules {
+		if rule.MatchString(s.Content) {
+			return f.Action, fmt.Sprintf("matched %q", rule.String())
+		}
+	}
+
+	return Allow, ""
+}
+
+// Velocity acts on clients creating too many documents in a short time
+type Velocity struct {
+	Max    int
+	Window time.Duration
+	Action Decision
+
+	mu        sync.Mutex
+	creates   map[string][]time.Time
+	lastSweep time.Time
+}
+
+// Name returns the name of the filter
+func (f *Velocity) Name() string {
+	return "velocity"
+}
+
+// Check records the submission and counts recent ones from the same IP
+func (f *Velocity) Check(s *Submission) (Decision, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.creates == nil {
+		f.creates = map[string][]time.Time{}
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-f.Window)
+	key := s.IP.String()
+
+	// Every so often forget clients that have gone quiet, so the map
+	// doesn't grow forever
+	if now.Sub(f.lastSweep) > f.Window {
+		for ip, times := range f.creates {
+			if times[len(times)-1].Before(cutoff) {
+				delete(f.creates, ip)
+			}
+		}
+
+		f.lastSweep = now
+	}
+
+	// Drop timestamps outside of the window for this client
+
+	recent := f.creates[key][:0]
+
+	for _, t := range f.creates[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+
+	recent = append(recent, now)
+	f.creates[key] = recent
+
+	if len(recent) > f.Max {
+		return f.Action, fmt.Sprintf("%d documents created within %s", len(recent), f.Window)
+	}
+
+	return Allow, ""
+}
+
+// BlocklistRule is a single operator-supplied rule
+type BlocklistRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Action  Decision
+}
+
+// Blocklist acts on documents containing prohibited content, using the
+// most severe action of every matching rule
+type Blocklist struct {
+	Rules []BlocklistRule
+}
+
+// Name returns the name of the filter
+func (f *Blocklist) Name() string {
+	return "blocklist"
+}
+
+// Check matches the content against every rule
+func (f *Blocklist) Check(s *Submission) (Decision, string) {
+	decision, reason := Allow, ""
+
+	for _, rule := range f.Rules {
+		if rule.Action > decision && rule.Pattern.MatchString(s.Content) {
+			decision, reason = rule.Action, fmt.Sprintf("matched rule %q", rule.Name)
+		}
+	}
+
+	return decision, reason
+}
+
+// WordsPattern builds a case-insensitive pattern matching any of `words`
+// literally
+func WordsPattern(words []string) (*regexp.Regexp, error) {
+	quoted := make([]string, len(words))
+
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+
+	return regexp.Compile(`(?i)` + strings.Join(quoted, "|"))
+}
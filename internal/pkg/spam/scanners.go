@@ -0,0 +1,207 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spam
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Scanner sends content to an external virus scanner and reports what it
+// found, an empty result means the content is clean
+type Scanner interface {
+	Scan(content []byte) (string, error)
+}
+
+// Scan acts on documents an external scanner considers malicious
+type Scan struct {
+	Scanner Scanner
+	Action  Decision
+	OnError Decision // What to do when the scanner can't be reached.
+}
+
+// Name returns the name of the filter
+func (f *Scan) Name() string {
+	return "scan"
+}
+
+// Check sends the content to the scanner
+func (f *Scan) Check(s *Submission) (Decision, string) {
+	found, err := f.Scanner.Scan([]byte(s.Content))
+
+	if err != nil {
+		log.Printf("Virus scan failed: %v", err)
+
+		return f.OnError, "scan failed"
+	}
+
+	if found != "" {
+		return f.Action, "found " + found
+	}
+
+	return Allow, ""
+}
+
+func dial(address string, timeout time.Duration) (net.Conn, error) {
+	network := "tcp"
+
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+
+	conn, err := net.DialTimeout(network, address, timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, conn.SetDeadline(time.Now().Add(timeout))
+}
+
+// ClamAV scans content with clamd's INSTREAM command
+type ClamAV struct {
+	Address string // host:port, or the path of a unix socket
+	Timeout time.Duration
+}
+
+// clamd refuses chunks over its StreamMaxLength, keep them small
+const clamChunkSize = 64 * 1024
+
+// Scan streams `content` to clamd
+func (c *ClamAV) Scan(content []byte) (string, error) {
+	conn, err := dial(c.Address, c.Timeout)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+
+	for len(content) > 0 {
+		n := len(content)
+
+		if n > clamChunkSize {
+			n = clamChunkSize
+		}
+
+		binary.Write(w, binary.BigEndian, uint32(n))
+		w.Write(content[:n])
+		content = content[n:]
+	}
+
+	binary.Write(w, binary.BigEndian, uint32(0))
+
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+
+	if err != nil {
+		return "", err
+	}
+
+	// The reply is "stream: OK", "stream: <signature> FOUND" or an error
+	reply = strings.TrimPrefix(strings.TrimRight(reply, "\x00\n"), "stream: ")
+
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	}
+
+	return "", fmt.Errorf("clamd: %s", reply)
+}
+
+// ICAP scans content with an ICAP REQMOD request, as supported by most
+// antivirus gateways
+type ICAP struct {
+	Address string // host:port
+	Service string
+	Timeout time.Duration
+}
+
+// Scan sends `content` as the body of an encapsulated HTTP request
+func (c *ICAP) Scan(content []byte) (string, error) {
+	conn, err := dial(c.Address, c.Timeout)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	header := fmt.Sprintf("POST /document HTTP/1.1\r\nHost: spirit\r\nContent-Length: %d\r\n\r\n", len(content))
+
+	var req bytes.Buffer
+
+	fmt.Fprintf(&req, "REQMOD icap://%s/%s ICAP/1.0\r\n", c.Address, strings.TrimPrefix(c.Service, "/"))
+	fmt.Fprintf(&req, "Host: %s\r\n", c.Address)
+	req.WriteString("Allow: 204\r\n")
+	fmt.Fprintf(&req, "Encapsulated: req-hdr=0, req-body=%d\r\n\r\n", len(header))
+	req.WriteString(header)
+	fmt.Fprintf(&req, "%x\r\n", len(content))
+	req.Write(content)
+	req.WriteString("\r\n0\r\n\r\n")
+
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return "", err
+	}
+
+	r := textproto.NewReader(bufio.NewReader(conn))
+	status, err := r.ReadLine()
+
+	if err != nil {
+		return "", err
+	}
+
+	headers, err := r.ReadMIMEHeader()
+
+	if err != nil {
+		return "", err
+	}
+
+	// 204 means the content is unmodified, anything the server had to change
+	// or block is treated as malicious
+	switch fields := strings.Fields(status); {
+	case len(fields) < 2:
+		return "", fmt.Errorf("icap: malformed status %q", status)
+	case fields[1] == "204":
+		return "", nil
+	case fields[1] != "200":
+		return "", fmt.Errorf("icap: %s", status)
+	}
+
+	for _, key := range []string{"X-Infection-Found", "X-Virus-Id", "X-Violations-Found"} {
+		if value := headers.Get(key); value != "" {
+			return value, nil
+		}
+	}
+
+	return "malicious content", nil
+}
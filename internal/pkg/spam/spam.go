@@ -0,0 +1,254 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spam
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Decision is what should happen to a submitted document
+type Decision int
+
+// Decisions are ordered by severity, a pipeline returns the most severe one
+const (
+	Allow      Decision = iota // Store and serve the document as usual.
+	Flag                       // Store and serve it, but mark it for review.
+	Quarantine                 // Pretend it was created, but never serve it.
+	Reject                     // Refuse to create it.
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Flag:
+		return "flag"
+	case Quarantine:
+		return "quarantine"
+	case Reject:
+		return "reject"
+	}
+
+	return "allow"
+}
+
+// ParseDecision reads a decision as written in the config
+func ParseDecision(s string) (Decision, error) {
+	for _, d := range []Decision{Allow, Flag, Quarantine, Reject} {
+		if d.String() == s {
+			return d, nil
+		}
+	}
+
+	return Allow, fmt.Errorf("unknown spam action %q", s)
+}
+
+// Submission is a document being checked before it's stored
+type Submission struct {
+	Content   string
+	Extension string
+	IP        net.IP
+}
+
+// Filter inspects a submission and decides what to do with it
+type Filter interface {
+	// Name identifies the filter in metrics and moderation reasons
+	Name() string
+
+	// Check returns a decision, and why it was made if it isn't Allow
+	Check(s *Submission) (Decision, string)
+}
+
+// Result is the outcome of running a pipeline
+type Result struct {
+	Decision Decision
+	Filter   string // The filter that made the decision.
+	Reason   string
+}
+
+// Pipeline runs filters in order and keeps the most severe decision
+type Pipeline []Filter
+
+// Run checks `s` against every filter, stopping early on a rejection
+func (p Pipeline) Run(s *Submission) Result {
+	result := Result{Decision: Allow}
+
+	for _, filter := range p {
+		decision, reason := filter.Check(s)
+
+		if decision > result.Decision {
+			result = Result{Decision: decision, Filter: filter.Name(), Reason: reason}
+		}
+
+		if result.Decision == Reject {
+			break
+		}
+	}
+
+	return result
+}
+
+// New builds the pipeline described in the config. The blocklist is always
+// applied, the heuristics only when spam filtering is enabled.
+func New() (Pipeline, error) {
+	var pipeline Pipeline
+
+	if len(config.Config().Blocklist.Rules) > 0 {
+		blocklist, err := newBlocklist()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipeline = append(pipeline, blocklist)
+	}
+
+	if config.Config().Scan.Engine != "" {
+		scan, err := newScan()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipeline = append(pipeline, scan)
+	}
+
+	cfg := config.Config().Spam
+
+	if !cfg.Enabled {
+		return pipeline, nil
+	}
+
+	if cfg.URLDensity.MaxPerKB > 0 {
+		action, err := ParseDecision(cfg.URLDensity.Action)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipeline = append(pipeline, &URLDensity{MaxPerKB: cfg.URLDensity.MaxPerKB, Action: action})
+	}
+
+	if len(cfg.Patterns.Rules) > 0 {
+		action, err := ParseDecision(cfg.Patterns.Action)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filter := &Patterns{Action: action}
+
+		for _, rule := range cfg.Patterns.Rules {
+			re, err := regexp.Compile(rule)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid spam pattern %q: %w", rule, err)
+			}
+
+			filter.Rules = append(filter.Rules, re)
+		}
+
+		pipeline = append(pipeline, filter)
+	}
+
+	if cfg.Velocity.Max > 0 {
+		action, err := ParseDecision(cfg.Velocity.Action)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipeline = append(pipeline, &Velocity{
+			Max:    cfg.Velocity.Max,
+			Window: time.Duration(cfg.Velocity.Window) * time.Millisecond,
+			Action: action,
+		})
+	}
+
+	return pipeline, nil
+}
+
+func newBlocklist() (*Blocklist, error) {
+	blocklist := &Blocklist{}
+
+	for i, rule := range config.Config().Blocklist.Rules {
+		action, err := ParseDecision(rule.Action)
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := rule.Name
+
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		var pattern *regexp.Regexp
+
+		if rule.Pattern != "" {
+			pattern, err = regexp.Compile(rule.Pattern)
+		} else {
+			pattern, err = WordsPattern(rule.Words)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist rule %s: %w", name, err)
+		}
+
+		blocklist.Rules = append(blocklist.Rules, BlocklistRule{
+			Name:    name,
+			Pattern: pattern,
+			Action:  action,
+		})
+	}
+
+	return blocklist, nil
+}
+
+func newScan() (*Scan, error) {
+	cfg := config.Config().Scan
+
+	action, err := ParseDecision(cfg.Action)
+
+	if err != nil {
+		return nil, err
+	}
+
+	onError, err := ParseDecision(cfg.OnError)
+
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Millisecond
+	filter := &Scan{Action: action, OnError: onError}
+
+	switch cfg.Engine {
+	case "clamav":
+		filter.Scanner = &ClamAV{Address: cfg.Address, Timeout: timeout}
+	case "icap":
+		filter.Scanner = &ICAP{Address: cfg.Address, Service: cfg.Service, Timeout: timeout}
+	default:
+		return nil, fmt.Errorf("unknown scan engine %q", cfg.Engine)
+	}
+
+	return filter, nil
+}
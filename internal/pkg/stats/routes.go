@@ -0,0 +1,43 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+// Register loads the statistics endpoint, which only admins can use
+// unless `stats.public` is set
+func Register(app *fiber.App) {
+	handler := func(c *fiber.Ctx) error {
+		stats, err := Get(c.UserContext())
+
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+
+		return c.Status(200).JSON(stats)
+	}
+
+	if config.Config().Stats.Public {
+		app.Get("/v1/stats", handler)
+	} else {
+		app.Get("/v1/stats", auth.RequireAdmin(), handler)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/spacebin-org/spirit/internal/pkg/database"
+	"github.com/spacebin-org/spirit/internal/pkg/database/models"
+	"github.com/spacebin-org/spirit/internal/pkg/version"
+	"gorm.io/gorm"
+)
+
+// cacheFor is how long collected statistics are reused, since counting
+// every document is expensive on large instances
+const cacheFor = time.Minute
+
+// Stats describes the instance
+type Stats struct {
+	Documents   int64  `json:"documents"` // Not counting the ones in the trash.
+	Bytes       int64  `json:"bytes"`     // Total length of every document's content.
+	CreatedDay  int64  `json:"created_24h"`
+	CreatedWeek int64  `json:"created_7d"`
+	Version     string `json:"version"`
+	GoVersion   string `json:"go_version"`
+	CollectedAt int64  `json:"collected_at"`
+}
+
+var (
+	mu     sync.Mutex
+	cached *Stats
+)
+
+// Get returns the instance's statistics, collecting them again once the
+// cached ones are older than a minute
+func Get(ctx context.Context) (*Stats, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cached != nil && time.Since(time.Unix(cached.CollectedAt, 0)) < cacheFor {
+		return cached, nil
+	}
+
+	stats, err := collect(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cached = stats
+
+	return stats, nil
+}
+
+// collect counts the documents that aren't in the trash and measures
+// their content. Every query starts from a fresh statement, since gorm
+// keeps the conditions and selects of one it's reused for.
+func collect(ctx context.Context) (*Stats, error) {
+	now := time.Now()
+	stats := Stats{Version: version.Version, GoVersion: runtime.Version(), CollectedAt: now.Unix()}
+	documents := func() *gorm.DB {
+		return database.DBConn.WithContext(ctx).Model(&models.Document{}).Where("deleted_at = 0")
+	}
+
+	if err := documents().Count(&stats.Documents).Error; err != nil {
+		return nil, err
+	}
+
+	bytes := "COALESCE(SUM(" + database.ByteLength("content") + "), 0)"
+
+	if err := documents().Select(bytes).Row().Scan(&stats.Bytes); err != nil {
+		return nil, err
+	}
+
+	if err := documents().Where("created_at >= ?", now.Add(-24*time.Hour).Unix()).Count(&stats.CreatedDay).Error; err != nil {
+		return nil, err
+	}
+
+	if err := documents().Where("created_at >= ?", now.Add(-7*24*time.Hour).Unix()).Count(&stats.CreatedWeek).Error; err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timeout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/config"
+)
+
+const (
+	baseKey   = "timeout_base"
+	cancelKey = "timeout_cancel"
+)
+
+// Middleware bounds the context of every request by `server.timeouts.handler`,
+// routes can change the deadline with Set. Database queries run with
+// c.UserContext() are cancelled once it passes, and the request is answered
+// with a 503 instead of whatever error the handler ran into.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(baseKey, c.UserContext())
+		apply(c, config.Config().Server.Timeouts.Handler)
+
+		err := c.Next()
+		expired := errors.Is(c.UserContext().Err(), context.DeadlineExceeded)
+
+		c.Locals(cancelKey).(context.CancelFunc)()
+
+		if err != nil && expired {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "Request timed out")
+		}
+
+		return err
+	}
+}
+
+// Set replaces the deadline of the requests it handles with the one returned
+// by `timeout`, in milliseconds
+func Set(timeout func() int) fiber.Handler {
+	return Wrap(timeout, func(c *fiber.Ctx) error {
+		return c.Next()
+	})
+}
+
+// Wrap is like Set, but runs `handler` afterwards. It's meant for handlers
+// shared by several routes, like rate limiters.
+func Wrap(timeout func() int, handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apply(c, timeout())
+
+		return handler(c)
+	}
+}
+
+// Detach returns a context that outlives the handler, for response bodies
+// that are streamed after it returns. Writing the response has its own
+// deadline, `server.timeouts.write`, so that's what bounds it rather than the
+// route's. The caller has to cancel it once done.
+func Detach(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	base, ok := c.Locals(baseKey).(context.Context)
+
+	if !ok {
+		base = c.UserContext()
+	}
+
+	ctx := values{Context: base, from: c.UserContext()}
+
+	if timeout := config.Config().Server.Timeouts.Write; timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// values is a context with the deadline of one context and the values of
+// another, so a new deadline doesn't drop whatever handlers added to the
+// request's context since the middleware ran
+type values struct {
+	context.Context
+	from context.Context
+}
+
+func (v values) Value(key interface{}) interface{} {
+	return v.from.Value(key)
+}
+
+func apply(c *fiber.Ctx, timeout int) {
+	base, ok := c.Locals(baseKey).(context.Context)
+
+	// Without the middleware nothing would cancel the context
+	if !ok {
+		return
+	}
+
+	if cancel, ok := c.Locals(cancelKey).(context.CancelFunc); ok {
+		cancel()
+	}
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	parent := values{Context: base, from: c.UserContext()}
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, time.Duration(timeout)*time.Millisecond)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	c.SetUserContext(ctx)
+	c.Locals(cancelKey, cancel)
+}
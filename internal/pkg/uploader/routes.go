@@ -0,0 +1,120 @@
+/*
+ * Copyright 2020-2021 Luke Whrit, Jack Dorland
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ *     http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uploader
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spacebin-org/spirit/internal/pkg/auth"
+	"github.com/spacebin-org/spirit/internal/pkg/links"
+)
+
+// Descriptor is a tool-agnostic description of how to upload text to this
+// instance
+type Descriptor struct {
+	Name         string            `json:"name"`
+	RequestURL   string            `json:"request_url"`
+	Method       string            `json:"method"`
+	Headers      map[string]string `json:"headers"`
+	Body         string            `json:"body"`          // Body template, `{content}` is replaced with the text as a JSON string.
+	ResponseID   string            `json:"response_id"`   // JSON path of the document ID in the response.
+	DocumentURL  string            `json:"document_url"`  // `{id}` is replaced with the document ID.
+	ErrorMessage string            `json:"error_message"` // JSON path of the error in the response.
+}
+
+// ShareX is a ShareX custom uploader (.sxcu)
+type ShareX struct {
+	Version         string            `json:"Version"`
+	Name            string            `json:"Name"`
+	DestinationType string            `json:"DestinationType"`
+	RequestMethod   string            `json:"RequestMethod"`
+	RequestURL      string            `json:"RequestURL"`
+	Headers         map[string]string `json:"Headers,omitempty"`
+	Body            string            `json:"Body"`
+	Data            string            `json:"Data"`
+	URL             string            `json:"URL"`
+	ErrorMessage    string            `json:"ErrorMessage"`
+}
+
+// Register loads the endpoints generating uploader configs. The caller's
+// auth token is embedded when they send one.
+func Register(app *fiber.App) {
+	api := app.Group("/v1/config")
+
+	api.Get("/uploader", func(c *fiber.Ctx) error {
+		base := links.Base(c)
+
+		return c.Status(200).JSON(&Descriptor{
+			Name:         name(base),
+			RequestURL:   base + "/v1/documents/",
+			Method:       "POST",
+			Headers:      headers(c, map[string]string{"Content-Type": "application/json"}),
+			Body:         `{"content": {content}, "extension": "none"}`,
+			ResponseID:   "payload.id",
+			DocumentURL:  links.Document(base, "{id}"),
+			ErrorMessage: "error",
+		})
+	})
+
+	api.Get("/sharex", func(c *fiber.Ctx) error {
+		base := links.Base(c)
+
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s.sxcu\"", host(base)))
+
+		return c.Status(200).JSON(&ShareX{
+			Version:         "13.7.0",
+			Name:            name(base),
+			DestinationType: "TextUploader",
+			RequestMethod:   "POST",
+			RequestURL:      base + "/v1/documents/",
+			Headers:         headers(c, nil),
+			Body:            "JSON",
+			Data:            `{"content": "$input$", "extension": "none"}`,
+			URL:             links.Document(base, "$json:payload.id$"),
+			ErrorMessage:    "$json:error$",
+		})
+	})
+}
+
+// headers adds the caller's auth token to `h`
+func headers(c *fiber.Ctx, h map[string]string) map[string]string {
+	if h == nil {
+		h = map[string]string{}
+	}
+
+	if auth.FromRequest(c) != nil {
+		h[fiber.HeaderAuthorization] = "Bearer " + auth.Bearer(c)
+	}
+
+	return h
+}
+
+func name(base string) string {
+	return "Spacebin (" + host(base) + ")"
+}
+
+func host(base string) string {
+	u, err := url.Parse(base)
+
+	if err != nil || u.Hostname() == "" {
+		return "spacebin"
+	}
+
+	return u.Hostname()
+}